@@ -32,3 +32,23 @@ func TestASFMessageFromBytes(t *testing.T) {
 	_, err = asfMessageFromBytes(buf)
 	assert.NoError(t, err)
 }
+
+func FuzzASFMessageFromBytes(f *testing.F) {
+	m := &asfMessage{
+		rmcpHeader: &rmcpHeader{Version: rmcpVersion1, Class: rmcpClassASF, RMCPSequenceNumber: 0xff},
+		asfHeader:  &asfHeader{IANAEnterpriseNumber: asfIANA, MessageType: asfMessageTypePong},
+	}
+	f.Add(m.toBytes(&asfPong{IANAEnterpriseNumber: asfIANA, SupportedEntities: 0x81}))
+	f.Add(m.toBytes(nil))
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		m, err := asfMessageFromBytes(buf)
+		if err != nil {
+			return
+		}
+		pong := &asfPong{}
+		if m.response(pong) == nil {
+			_ = pong.valid()
+		}
+	})
+}
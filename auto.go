@@ -0,0 +1,128 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// auto transport selects the interface based on the BMC capabilities
+// when the session is opened.
+type auto struct {
+	*Connection
+	transport
+	intf   string
+	reason string
+}
+
+func newAutoTransport(c *Connection) transport {
+	return &auto{Connection: c}
+}
+
+func (a *auto) open() error {
+	if a.transport == nil {
+		intf, reason, err := a.probe()
+		if err != nil {
+			return err
+		}
+		a.logger().Info("auto selected interface", "host", a.Hostname, "interface", intf, "reason", reason)
+
+		c := *a.Connection
+		c.Interface = intf
+		t, err := newTransport(&c)
+		if err != nil {
+			return err
+		}
+
+		a.intf = intf
+		a.reason = reason
+		a.transport = t
+	}
+
+	return a.transport.open()
+}
+
+func (a *auto) close() error {
+	if a.transport == nil {
+		return nil
+	}
+	return a.transport.close()
+}
+
+func (a *auto) send(req *Request, res Response) error {
+	if a.transport == nil {
+		return errors.New("auto: interface not selected, session is not open")
+	}
+	return a.transport.send(req, res)
+}
+
+func (a *auto) Console() error {
+	if a.transport == nil {
+		return errors.New("auto: interface not selected, session is not open")
+	}
+	return a.transport.Console()
+}
+
+// probe the BMC natively and return the interface to use and why:
+// "lanplus" if IPMI v2.0 sessions are accepted and ipmitool is available,
+// as RMCP+ authentication is the stronger, "lan" if IPMI v1.5 sessions are
+// accepted otherwise. Whether "lan" is native or ipmitool depends on
+// Connection.Path, as it does for an explicit Interface. "lanplus" is only
+// supported by ipmitool, which is also the fallback when the BMC does not
+// answer the probe.
+func (a *auto) probe() (string, string, error) {
+	l := newLanTransport(a.Connection).(*lan)
+	if err := l.connect(); err != nil {
+		return "", "", err
+	}
+	defer func() { _ = l.close() }()
+
+	// not all BMCs answer the presence ping, but a pong without IPMI is final
+	ping := l.ping()
+	if ping == errNoIPMI {
+		return "", "", fmt.Errorf("auto: %s: %s", a.Hostname, ping)
+	}
+
+	path := toolPath(a.Connection)
+	_, lerr := exec.LookPath(path)
+
+	res, err := l.capabilities()
+	if err != nil {
+		if ping != nil {
+			err = fmt.Errorf("%s, presence ping: %s", err, ping)
+		}
+		if lerr != nil {
+			return "", "", fmt.Errorf("auto: %s probe failed (%s) and %s is not available for lanplus: %s",
+				a.Hostname, err, path, lerr)
+		}
+		return "lanplus", fmt.Sprintf("probe failed (%s), falling back to %s", err, path), nil
+	}
+
+	switch {
+	case res.SupportsIPMIv20() && lerr == nil:
+		return "lanplus", "BMC supports IPMI v2.0", nil
+	case res.SupportsIPMIv15() && res.SupportsIPMIv20():
+		return "lan", fmt.Sprintf("BMC supports IPMI v2.0, but %s is not available: %s", path, lerr), nil
+	case res.SupportsIPMIv15():
+		return "lan", "BMC only supports IPMI v1.5", nil
+	}
+
+	return "", "", fmt.Errorf("auto: %s only supports IPMI v2.0, which requires ipmitool: %s",
+		a.Hostname, lerr)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoInterface(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	// an IPMI v1.5 only BMC, lan does not depend on ipmitool being installed
+	s.SetHandler(NetworkFunctionApp, CommandGetAuthCapabilities, func(*Message) Response {
+		return &AuthCapabilitiesResponse{AuthTypeSupport: authTypeSupport}
+	})
+
+	c := s.NewConnection()
+	c.Interface = "auto"
+
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "", client.SelectedInterface())
+	assert.Equal(t, "", client.SelectionReason())
+
+	_, err = client.DeviceID()
+	assert.Error(t, err)
+
+	err = client.Open()
+	assert.NoError(t, err)
+	assert.Equal(t, "lan", client.SelectedInterface())
+	assert.Equal(t, "BMC only supports IPMI v1.5", client.SelectionReason())
+	assert.Equal(t, "auto", c.Interface)
+
+	_, err = client.DeviceID()
+	assert.NoError(t, err)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestAutoProbe(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	c.Interface = "auto"
+	// lanplus is only selected when ipmitool can be run
+	c.Path = os.Args[0]
+	a := newAutoTransport(c).(*auto)
+
+	tests := []struct {
+		should string
+		res    Response
+		expect string
+	}{
+		{
+			"should select lanplus for IPMI v2.0 only BMCs",
+			&AuthCapabilitiesResponse{AuthTypeSupport: 0x80, Reserved: 0x02},
+			"lanplus",
+		},
+		{
+			"should prefer lanplus for IPMI v1.5 and v2.0 BMCs",
+			&AuthCapabilitiesResponse{AuthTypeSupport: 0x80, Reserved: 0x03},
+			"lanplus",
+		},
+		{
+			"should select lan for BMCs without extended capabilities",
+			&AuthCapabilitiesResponse{AuthTypeSupport: 1 << AuthTypeMD5},
+			"lan",
+		},
+	}
+
+	for _, test := range tests {
+		res := test.res
+		s.SetHandler(NetworkFunctionApp, CommandGetAuthCapabilities, func(*Message) Response {
+			return res
+		})
+		intf, reason, err := a.probe()
+		assert.NoError(t, err, test.should)
+		assert.Equal(t, test.expect, intf, test.should)
+		assert.NotEmpty(t, reason, test.should)
+	}
+
+	// IPMI v1.5 BMCs may reject the extended bit
+	s.SetHandler(NetworkFunctionApp, CommandGetAuthCapabilities, func(m *Message) Response {
+		if m.Data[0]&channelExtended != 0 {
+			return ErrInvalidPacket
+		}
+		return &AuthCapabilitiesResponse{AuthTypeSupport: 1 << AuthTypeMD5}
+	})
+	intf, _, err := a.probe()
+	assert.NoError(t, err)
+	assert.Equal(t, "lan", intf)
+
+	// ipmitool is the fallback when the BMC does not answer the probe
+	s.SetHandler(NetworkFunctionApp, CommandGetAuthCapabilities, func(*Message) Response {
+		return ErrInvalidPacket
+	})
+	intf, reason, err := a.probe()
+	assert.NoError(t, err)
+	assert.Equal(t, "lanplus", intf)
+	assert.Contains(t, reason, "probe failed")
+
+	c.Path = "/nonexistent/ipmitool"
+	_, _, err = a.probe()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "probe failed")
+
+	// without ipmitool, BMCs supporting both fall back to lan
+	s.SetHandler(NetworkFunctionApp, CommandGetAuthCapabilities, func(*Message) Response {
+		return &AuthCapabilitiesResponse{AuthTypeSupport: 0x80, Reserved: 0x03}
+	})
+	intf, reason, err = a.probe()
+	assert.NoError(t, err)
+	assert.Equal(t, "lan", intf)
+	assert.Contains(t, reason, "/nonexistent/ipmitool is not available")
+
+	s.SetHandler(NetworkFunctionApp, CommandGetAuthCapabilities, func(*Message) Response {
+		return &AuthCapabilitiesResponse{AuthTypeSupport: 0x80, Reserved: 0x02}
+	})
+	_, _, err = a.probe()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "requires ipmitool")
+
+	s.Stop()
+}
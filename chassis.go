@@ -91,7 +91,7 @@ type ChassisStatusResponse struct {
 	PowerState        uint8
 	LastPowerEvent    uint8
 	State             uint8
-	FrontControlPanel uint8
+	FrontControlPanel uint8 `ipmi:"optional"`
 }
 
 // ChassisControlRequest per section 28.3
@@ -130,14 +130,6 @@ type SystemBootOptionsResponse struct {
 	Data    []uint8
 }
 
-// MarshalBinary implementation to handle variable length Data
-func (r *SetSystemBootOptionsRequest) MarshalBinary() ([]byte, error) {
-	buf := make([]byte, 1+len(r.Data))
-	buf[0] = r.Param
-	copy(buf[1:], r.Data)
-	return buf, nil
-}
-
 var validSetBootOptionsDataLength = map[uint8]int{
 	BootParamInfoAck:   2,
 	BootParamBootFlags: 5,
@@ -158,46 +150,10 @@ func (r *SetSystemBootOptionsRequest) UnmarshalBinary(buf []byte) error {
 	return nil
 }
 
-// MarshalBinary implementation to handle variable length Data
-func (r *SystemBootOptionsResponse) MarshalBinary() ([]byte, error) {
-	buf := make([]byte, 3+len(r.Data))
-	buf[0] = byte(r.CompletionCode)
-	buf[1] = r.Version
-	buf[2] = r.Param
-	copy(buf[3:], r.Data)
-	return buf, nil
-}
-
-// UnmarshalBinary implementation to handle variable length Data
-func (r *SystemBootOptionsResponse) UnmarshalBinary(buf []byte) error {
-	if len(buf) < 3 {
-		return ErrShortPacket
-	}
-	r.CompletionCode = CompletionCode(buf[0])
-	r.Version = buf[1]
-	r.Param = buf[2]
-	r.Data = buf[3:]
-	return nil
-}
-
-// UnmarshalBinary implementation to handle variable length Data
-func (r *ChassisStatusResponse) UnmarshalBinary(buf []byte) error {
-	if len(buf) < 4 {
-		return ErrShortPacket
-	}
-	r.CompletionCode = CompletionCode(buf[0])
-	r.PowerState = buf[1]
-	r.LastPowerEvent =  buf[2]
-	r.State = buf[3]
-	if len(buf) > 4 {
-		r.FrontControlPanel = buf[4]
-	} else {
-		r.FrontControlPanel = 0
-	}
-	return nil
-}
-
 func (r *SystemBootOptionsResponse) BootDeviceSelector() BootDevice {
+	if len(r.Data) < 2 {
+		return BootDeviceNone
+	}
 	return BootDevice(((r.Data[1] >> 2) & 0x0f) << 2)
 }
 
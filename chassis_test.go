@@ -28,7 +28,8 @@ func TestChassisStatusRequest(t *testing.T) {
 		CommandChassisStatus,
 		&ChassisStatusRequest{},
 	}
-	raw := requestToStrings(req)
+	raw, err := requestToStrings(req)
+	assert.NoError(t, err)
 	assert.Equal(t, []string{"0x00", "0x01"}, raw)
 }
 
@@ -60,7 +61,8 @@ func TestBootFlagsRequest(t *testing.T) {
 			Param: BootParamBootFlags,
 		},
 	}
-	raw := requestToStrings(req)
+	raw, err := requestToStrings(req)
+	assert.NoError(t, err)
 	assert.Equal(t, []string{"0x00", "0x09", "0x05", "0x00", "0x00"}, raw)
 }
 
@@ -70,3 +72,10 @@ func TestBootFlagsParse(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, BootDeviceFloppy, res.BootDeviceSelector())
 }
+
+func TestBootFlagsParseShort(t *testing.T) {
+	res := &SystemBootOptionsResponse{}
+	err := responseFromString("01 05", res)
+	assert.NoError(t, err)
+	assert.Equal(t, BootDeviceNone, res.BootDeviceSelector())
+}
@@ -16,10 +16,25 @@ limitations under the License.
 
 package ipmi
 
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// minKeepalive is the shortest Keepalive interval, a keepalive more
+// frequent than a round trip to the BMC serves no purpose
+const minKeepalive = 10 * time.Millisecond
+
 // Client provides common high level functionality around the underlying transport
 type Client struct {
 	*Connection
 	transport
+
+	mu       sync.Mutex
+	lastSend time.Time
+	stop     chan struct{}
+	wg       sync.WaitGroup
 }
 
 // NewClient creates a new Client with the given Connection properties
@@ -28,6 +43,9 @@ func NewClient(c *Connection) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if c.Recorder != nil {
+		t = &recording{transport: t, recorder: c.Recorder}
+	}
 	return &Client{
 		Connection: c,
 		transport:  t,
@@ -36,19 +54,175 @@ func NewClient(c *Connection) (*Client, error) {
 
 // Open a new IPMI session
 func (c *Client) Open() error {
-	// TODO: auto-select transport based on BMC capabilities
-	return c.open()
+	if c.Keepalive > 0 && c.Keepalive < minKeepalive {
+		return fmt.Errorf("keepalive interval %s is less than %s", c.Keepalive, minKeepalive)
+	}
+
+	c.mu.Lock()
+	err := c.open()
+	c.lastSend = time.Now()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if c.Keepalive > 0 {
+		c.stop = make(chan struct{})
+		c.wg.Add(1)
+		go c.keepalive(c.Keepalive, c.stop)
+	}
+
+	return nil
+}
+
+// SelectedInterface returns the interface in use by the Client.
+// When the Connection Interface is "auto", this is the interface chosen
+// by Open based on the BMC capabilities.
+func (c *Client) SelectedInterface() string {
+	t := c.transport
+	if r, ok := t.(*recording); ok {
+		t = r.transport
+	}
+	if a, ok := t.(*auto); ok {
+		return a.intf
+	}
+	return c.Interface
+}
+
+// SelectionReason returns why Open chose the SelectedInterface when the
+// Connection Interface is "auto", or "" otherwise.
+func (c *Client) SelectionReason() string {
+	t := c.transport
+	if r, ok := t.(*recording); ok {
+		t = r.transport
+	}
+	if a, ok := t.(*auto); ok {
+		return a.reason
+	}
+	return ""
 }
 
 // Close the IPMI session
 func (c *Client) Close() error {
+	if c.stop != nil {
+		close(c.stop)
+		c.wg.Wait()
+		c.stop = nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.close()
 }
 
-// Send a Request and unmarshal to given Response type
+// Send a Request and unmarshal to given Response type.
+// If the BMC rejects the session, it is re-established and the Request
+// is sent once more. Without a response, which is also how BMCs treat
+// an expired session, only idempotent requests are sent once more, as
+// the BMC may have executed the request and only the response was lost.
 func (c *Client) Send(req *Request, res Response) error {
-	// TODO: handle retry, timeouts, etc.
-	return c.send(req, res)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start := time.Now()
+	retries := 0
+	err := c.send(req, res)
+	if isSessionError(err) || (isTimeout(err) && idempotent(req)) {
+		if err = c.reopen(); err == nil {
+			retries++
+			err = c.send(req, res)
+		}
+	}
+	c.lastSend = time.Now()
+
+	if c.Metrics != nil {
+		c.Metrics.ObserveRequest(newRequestStats(c.Connection, req, res, start, retries, err))
+	}
+
+	return err
+}
+
+func (c *Client) reopen() error {
+	_ = c.close()
+	return c.open()
+}
+
+// keepalive sends a Get Device ID request whenever the session has been
+// idle for the given interval, so the BMC does not expire it.
+func (c *Client) keepalive(interval time.Duration, stop chan struct{}) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			idle := time.Since(c.lastSend)
+			c.mu.Unlock()
+			if idle >= interval/2 {
+				_, _ = c.DeviceID()
+			}
+		}
+	}
+}
+
+// isSessionError returns true if the BMC reports that it no longer
+// recognizes the session
+func isSessionError(err error) bool {
+	return err == ErrInvalidSession
+}
+
+// idempotentCommands are read-only, sending them twice has no effect
+var idempotentCommands = map[NetworkFunction]map[Command]bool{
+	NetworkFunctionApp: {
+		CommandGetDeviceID:            true,
+		CommandGetAuthCapabilities:    true,
+		CommandGetUserName:            true,
+		CommandGetChannelCipherSuites: true,
+	},
+	NetworkFunctionChassis: {
+		CommandChassisStatus:        true,
+		CommandGetSystemBootOptions: true,
+	},
+	NetworkFunctionSensorEvent: {
+		CommandGetSensorReading: true,
+	},
+	NetworkFunctionStorage: {
+		CommandGetFRUInventoryAreaInfo: true,
+		CommandReadFRUData:             true,
+		CommandGetSDRRepositoryInfo:    true,
+		CommandGetSDR:                  true,
+		CommandGetSELInfo:              true,
+		CommandGetSELEntry:             true,
+	},
+	NetworkFunctionTransport: {
+		CommandGetLANConfig: true,
+	},
+}
+
+func idempotent(req *Request) bool {
+	return idempotentCommands[req.NetworkFunction][req.Command]
+}
+
+// Raw sends a request with the given data bytes, returning the completion code
+// and response data bytes as is. A completion code other than CommandCompleted
+// is not an error, err is only set if the request could not be sent. The data
+// following such a completion code is returned as well, except by ipmitool,
+// which does not print it.
+func (c *Client) Raw(netfn NetworkFunction, cmd Command, data []byte) (CompletionCode, []byte, error) {
+	res := &rawResponse{}
+	err := c.Send(&Request{netfn, cmd, data}, res)
+	if cc, ok := err.(CompletionCode); ok {
+		return cc, res.Data, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return res.CompletionCode, res.Data, nil
 }
 
 // DeviceID get the Device ID of the BMC
@@ -109,6 +283,17 @@ func (c *Client) SetBootDevice(dev BootDevice) error {
 	return err
 }
 
+// ChassisStatus returns the chassis power state and last power event
+func (c *Client) ChassisStatus() (*ChassisStatusResponse, error) {
+	req := &Request{
+		NetworkFunctionChassis,
+		CommandChassisStatus,
+		&ChassisStatusRequest{},
+	}
+	res := &ChassisStatusResponse{}
+	return res, c.Send(req, res)
+}
+
 // Control sends a chassis power control command
 func (c *Client) Control(ctl ChassisControl) error {
 	r := &Request{
@@ -143,3 +328,313 @@ func (c *Client) SetUserName(userID byte, username string) (*SetUserNameResponse
 	res := &SetUserNameResponse{}
 	return res, c.Send(req, res)
 }
+
+// SELEntries returns all System Event Log entries
+func (c *Client) SELEntries() ([]*SELEntry, error) {
+	if cmd, ok := nativeCommands(c.transport); ok {
+		return cmd.selEntries()
+	}
+
+	info := &SELInfoResponse{}
+	err := c.Send(&Request{NetworkFunctionStorage, CommandGetSELInfo, &SELInfoRequest{}}, info)
+	if err != nil || info.Entries == 0 {
+		return nil, err
+	}
+
+	var entries []*SELEntry
+	visited := make(map[uint16]bool)
+	for id := uint16(0); id != 0xffff; {
+		if visited[id] {
+			return entries, recordCycleError("SEL", id)
+		}
+		visited[id] = true
+
+		req := &Request{
+			NetworkFunctionStorage,
+			CommandGetSELEntry,
+			&GetSELEntryRequest{
+				RecordID: id,
+				Length:   0xff, // entire record
+			},
+		}
+		res := &GetSELEntryResponse{}
+		if err := c.Send(req, res); err != nil {
+			return entries, err
+		}
+
+		entry := &SELEntry{}
+		if err := entry.UnmarshalBinary(res.Data); err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+
+		if res.NextRecordID == id {
+			break
+		}
+		id = res.NextRecordID
+	}
+
+	return entries, nil
+}
+
+// clearSELPollInterval is the delay between polls of SEL erasure progress
+const clearSELPollInterval = 100 * time.Millisecond
+
+// ClearSEL erases all System Event Log entries, waiting up to the
+// Connection timeout for erasure to complete
+func (c *Client) ClearSEL() error {
+	action := uint8(ClearSELInitiate)
+	deadline := time.Now().Add(c.timeout())
+	for {
+		resv := &ReserveSELResponse{}
+		if err := c.Send(&Request{NetworkFunctionStorage, CommandReserveSEL, &ReserveSELRequest{}}, resv); err != nil {
+			return err
+		}
+
+		req := &Request{
+			NetworkFunctionStorage,
+			CommandClearSEL,
+			&ClearSELRequest{
+				ReservationID: resv.ReservationID,
+				Signature:     clearSELSignature,
+				Action:        action,
+			},
+		}
+		res := &ClearSELResponse{}
+		if err := c.Send(req, res); err != nil {
+			return err
+		}
+		if res.Progress == ClearSELCompleted {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("SEL erasure did not complete within %s", c.timeout())
+		}
+		action = ClearSELGetStatus
+		time.Sleep(clearSELPollInterval)
+	}
+}
+
+// SDRs returns all records in the Sensor Data Record repository
+func (c *Client) SDRs() ([]*SDR, error) {
+	var records []*SDR
+	var resv uint16
+	reserve := func() error {
+		res := &ReserveSDRRepositoryResponse{}
+		err := c.Send(&Request{NetworkFunctionStorage, CommandReserveSDRRepository, &ReserveSDRRepositoryRequest{}}, res)
+		resv = res.ReservationID
+		return err
+	}
+
+	if err := reserve(); err != nil {
+		return nil, err
+	}
+
+	retries := 3
+	visited := make(map[uint16]bool)
+	for id := uint16(0); id != 0xffff; {
+		if visited[id] {
+			return records, recordCycleError("SDR", id)
+		}
+		visited[id] = true
+
+		data, next, err := c.readSDR(resv, id)
+		if err == ErrInvalidResv && retries > 0 {
+			// the repository changed, start over
+			retries--
+			if err = reserve(); err == nil {
+				records = nil
+				visited = make(map[uint16]bool)
+				id = 0
+				continue
+			}
+		}
+		if err != nil {
+			return records, err
+		}
+
+		sdr := &SDR{}
+		if err := sdr.UnmarshalBinary(data); err != nil {
+			return records, err
+		}
+		records = append(records, sdr)
+
+		if next == id {
+			break
+		}
+		id = next
+	}
+
+	return records, nil
+}
+
+// recordCycleError is returned when the NextRecordID of a record leads back
+// to one already read, which would otherwise loop forever
+func recordCycleError(repo string, id uint16) error {
+	return fmt.Errorf("%s record ID 0x%04x repeats", repo, id)
+}
+
+// sdrReadSize is the number of bytes requested by each partial Get SDR,
+// which all BMCs support regardless of their message size limit
+const sdrReadSize = 16
+
+// readSDR reads the header of the given record, then the rest in chunks
+func (c *Client) readSDR(resv, id uint16) ([]byte, uint16, error) {
+	var data []byte
+	var next uint16
+	header := false
+
+	for length := sdrHeaderSize; len(data) < length; {
+		n := length - len(data)
+		if n > sdrReadSize {
+			n = sdrReadSize
+		}
+		req := &Request{
+			NetworkFunctionStorage,
+			CommandGetSDR,
+			&GetSDRRequest{
+				ReservationID: resv,
+				RecordID:      id,
+				Offset:        uint8(len(data)),
+				Length:        uint8(n),
+			},
+		}
+		res := &GetSDRResponse{}
+		if err := c.Send(req, res); err != nil {
+			return nil, 0, err
+		}
+		if len(res.Data) == 0 {
+			return nil, 0, ErrShortPacket
+		}
+
+		data = append(data, res.Data...)
+		next = res.NextRecordID
+		// the header may be returned in more or fewer bytes than requested
+		if !header && len(data) >= sdrHeaderSize {
+			header = true
+			length += int(data[4])
+		}
+	}
+
+	return data, next, nil
+}
+
+// Sensors returns the current reading of every sensor in the SDR repository
+func (c *Client) Sensors() ([]*SensorReading, error) {
+	if cmd, ok := nativeCommands(c.transport); ok {
+		return cmd.sensors()
+	}
+
+	records, err := c.SDRs()
+	if err != nil {
+		return nil, err
+	}
+
+	var sensors []*SensorReading
+	for _, sdr := range records {
+		if !sdr.IsSensor() {
+			continue
+		}
+
+		req := &Request{
+			NetworkFunctionSensorEvent,
+			CommandGetSensorReading,
+			&SensorReadingRequest{sdr.SensorNumber},
+		}
+		res := &SensorReadingResponse{}
+		err := c.Send(req, res)
+		if err != nil {
+			if _, ok := err.(CompletionCode); !ok {
+				return sensors, err
+			}
+			// a sensor without a reading is listed as not available
+			res.Flags = 0x20
+		}
+
+		sensors = append(sensors, newSensorReading(sdr, res))
+	}
+
+	return sensors, nil
+}
+
+// fruReadSize is the number of bytes requested by each Read FRU Data
+const fruReadSize = 16
+
+// FRU returns the inventory information of the given FRU device
+func (c *Client) FRU(id uint8) (*FRUInfo, error) {
+	if cmd, ok := nativeCommands(c.transport); ok {
+		return cmd.fru(id)
+	}
+
+	info := &FRUInventoryAreaInfoResponse{}
+	err := c.Send(&Request{NetworkFunctionStorage, CommandGetFRUInventoryAreaInfo, &FRUInventoryAreaInfoRequest{id}}, info)
+	if err != nil {
+		return nil, err
+	}
+
+	shift := info.Access & 0x01 // word access
+	data := make([]byte, 0, info.AreaSize)
+	for len(data) < int(info.AreaSize) {
+		n := int(info.AreaSize) - len(data)
+		if n > fruReadSize {
+			n = fruReadSize
+		}
+		req := &Request{
+			NetworkFunctionStorage,
+			CommandReadFRUData,
+			&ReadFRUDataRequest{
+				DeviceID: id,
+				Offset:   uint16(len(data)) >> shift,
+				Count:    uint8(n) >> shift,
+			},
+		}
+		res := &ReadFRUDataResponse{}
+		if err := c.Send(req, res); err != nil {
+			return nil, err
+		}
+		if len(res.Data) == 0 {
+			return nil, ErrShortPacket
+		}
+		data = append(data, res.Data...)
+	}
+
+	fru := &FRUInfo{}
+	return fru, fru.UnmarshalBinary(data)
+}
+
+// WriteFRUData writes data to the inventory area of the given FRU device
+// at offset, which is in bytes even if the device is accessed by words
+func (c *Client) WriteFRUData(id uint8, offset uint16, data []byte) error {
+	info := &FRUInventoryAreaInfoResponse{}
+	err := c.Send(&Request{NetworkFunctionStorage, CommandGetFRUInventoryAreaInfo, &FRUInventoryAreaInfoRequest{id}}, info)
+	if err != nil {
+		return err
+	}
+
+	shift := info.Access & 0x01 // word access
+	for len(data) > 0 {
+		n := min(len(data), fruReadSize)
+		req := &Request{
+			NetworkFunctionStorage,
+			CommandWriteFRUData,
+			&WriteFRUDataRequest{
+				DeviceID: id,
+				Offset:   offset >> shift,
+				Data:     data[:n],
+			},
+		}
+		res := &WriteFRUDataResponse{}
+		if err := c.Send(req, res); err != nil {
+			return err
+		}
+		written := int(res.Count) << shift
+		if written == 0 || written > n {
+			return ErrShortPacket
+		}
+		offset += uint16(written)
+		data = data[written:]
+	}
+
+	return nil
+}
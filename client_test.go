@@ -18,7 +18,9 @@ package ipmi
 
 import (
 	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -58,6 +60,7 @@ func TestDeviceID(t *testing.T) {
 	}
 
 	for _, test := range tests {
+		test := test
 		s.SetHandler(NetworkFunctionApp, CommandGetDeviceID, func(*Message) Response {
 			return &DeviceIDResponse{
 				CompletionCode: CommandCompleted,
@@ -75,3 +78,317 @@ func TestDeviceID(t *testing.T) {
 	assert.NoError(t, err)
 	s.Stop()
 }
+
+func TestKeepalive(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	var calls int32
+	s.SetHandler(NetworkFunctionApp, CommandGetDeviceID, func(*Message) Response {
+		atomic.AddInt32(&calls, 1)
+		return &DeviceIDResponse{}
+	})
+
+	c := s.NewConnection()
+	c.Keepalive = 20 * time.Millisecond
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+
+	err = client.Open()
+	assert.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	assert.NotZero(t, atomic.LoadInt32(&calls))
+	s.Stop()
+}
+
+func TestReopenSession(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	c.Timeout = 100 * time.Millisecond
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+
+	err = client.Open()
+	assert.NoError(t, err)
+
+	var challenges, calls atomic.Int32
+	challenge := s.handlers[NetworkFunctionApp][CommandGetSessionChallenge]
+	s.SetHandler(NetworkFunctionApp, CommandGetSessionChallenge, func(m *Message) Response {
+		challenges.Add(1)
+		return challenge(m)
+	})
+	s.SetHandler(NetworkFunctionApp, CommandGetDeviceID, func(m *Message) Response {
+		if calls.Add(1) == 1 {
+			// simulate an expired session
+			m.SessionID = 0
+		}
+		return &DeviceIDResponse{}
+	})
+
+	_, err = client.DeviceID()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, int32(1), challenges.Load())
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestSendTimeout(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	c.Timeout = 50 * time.Millisecond
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+
+	err = client.Open()
+	assert.NoError(t, err)
+
+	var ids, controls atomic.Int32
+	s.SetHandler(NetworkFunctionApp, CommandGetDeviceID, func(m *Message) Response {
+		ids.Add(1)
+		return &DeviceIDResponse{}
+	})
+	s.SetHandler(NetworkFunctionChassis, CommandChassisControl, func(m *Message) Response {
+		controls.Add(1)
+		return &ChassisControlResponse{}
+	})
+	s.SetFault(NetworkFunctionApp, CommandGetDeviceID, Fault{Drop: 1})
+	s.SetFault(NetworkFunctionChassis, CommandChassisControl, Fault{Drop: 1})
+
+	// idempotent requests are sent once more in a new session
+	_, err = client.DeviceID()
+	assert.True(t, isTimeout(err))
+	assert.Equal(t, int32(2), ids.Load())
+
+	// others are not, as only the response may have been lost
+	err = client.Control(ControlPowerCycle)
+	assert.True(t, isTimeout(err))
+	assert.Equal(t, int32(1), controls.Load())
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestKeepaliveInterval(t *testing.T) {
+	c := &Connection{Interface: "lan", Keepalive: time.Nanosecond}
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+	assert.Error(t, client.Open())
+}
+
+func TestClientInventory(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+
+	err = client.Open()
+	assert.NoError(t, err)
+
+	// SEL with a single entry
+	entry := &SELEntry{RecordID: 1, RecordType: 0x02, Timestamp: time.Unix(1589443200, 0).UTC(), SensorType: 0x01, SensorNumber: 0x30}
+	s.SetHandler(NetworkFunctionStorage, CommandGetSELInfo, func(*Message) Response {
+		return &SELInfoResponse{CompletionCode: CommandCompleted, Version: 0x51, Entries: 1}
+	})
+	s.SetHandler(NetworkFunctionStorage, CommandGetSELEntry, func(*Message) Response {
+		data, _ := entry.MarshalBinary()
+		return &GetSELEntryResponse{CompletionCode: CommandCompleted, NextRecordID: 0xffff, Data: data}
+	})
+
+	entries, err := client.SELEntries()
+	assert.NoError(t, err)
+	assert.Equal(t, []*SELEntry{entry}, entries)
+
+	// SDR repository with a single sensor, read in chunks
+	record := testFullSensorRecord(0x30, "CPU Temp")
+	s.SetHandler(NetworkFunctionStorage, CommandReserveSDRRepository, func(*Message) Response {
+		return &ReserveSDRRepositoryResponse{CompletionCode: CommandCompleted, ReservationID: 1}
+	})
+	s.SetHandler(NetworkFunctionStorage, CommandGetSDR, func(m *Message) Response {
+		req := &GetSDRRequest{}
+		if err := m.Request(req); err != nil {
+			return err
+		}
+		end := int(req.Offset) + int(req.Length)
+		if end > len(record) {
+			end = len(record)
+		}
+		return &GetSDRResponse{CompletionCode: CommandCompleted, NextRecordID: 0xffff, Data: record[req.Offset:end]}
+	})
+	s.SetHandler(NetworkFunctionSensorEvent, CommandGetSensorReading, func(*Message) Response {
+		return &SensorReadingResponse{CompletionCode: CommandCompleted, Reading: 40, Flags: 0xc0}
+	})
+
+	sensors, err := client.Sensors()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(sensors))
+	assert.Equal(t, "CPU Temp", sensors[0].Name)
+	assert.InDelta(t, 9.0, sensors[0].Value, 0.001)
+	assert.Equal(t, "ok", sensors[0].Status)
+
+	// FRU inventory read in chunks
+	fru := &FRUInfo{ChassisType: 0x17, BoardManufacturer: "VMware", ProductName: "goipmi"}
+	area, err := fru.MarshalBinary()
+	assert.NoError(t, err)
+	s.SetHandler(NetworkFunctionStorage, CommandGetFRUInventoryAreaInfo, func(*Message) Response {
+		return &FRUInventoryAreaInfoResponse{CompletionCode: CommandCompleted, AreaSize: uint16(len(area))}
+	})
+	s.SetHandler(NetworkFunctionStorage, CommandReadFRUData, func(m *Message) Response {
+		req := &ReadFRUDataRequest{}
+		if err := m.Request(req); err != nil {
+			return err
+		}
+		data := area[req.Offset : int(req.Offset)+int(req.Count)]
+		return &ReadFRUDataResponse{CompletionCode: CommandCompleted, Count: uint8(len(data)), Data: data}
+	})
+
+	info, err := client.FRU(0)
+	assert.NoError(t, err)
+	assert.Equal(t, fru, info)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestClientBrokenRepositories(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	c.Timeout = 200 * time.Millisecond
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+
+	err = client.Open()
+	assert.NoError(t, err)
+
+	// NextRecordID cycles between records 1 and 2
+	entry := &SELEntry{RecordType: 0x02}
+	s.SetHandler(NetworkFunctionStorage, CommandGetSELInfo, func(*Message) Response {
+		return &SELInfoResponse{CompletionCode: CommandCompleted, Version: 0x51, Entries: 2}
+	})
+	s.SetHandler(NetworkFunctionStorage, CommandGetSELEntry, func(m *Message) Response {
+		req := &GetSELEntryRequest{}
+		if err := m.Request(req); err != nil {
+			return err
+		}
+		data, _ := entry.MarshalBinary()
+		return &GetSELEntryResponse{CompletionCode: CommandCompleted, NextRecordID: req.RecordID%2 + 1, Data: data}
+	})
+
+	entries, err := client.SELEntries()
+	assert.Error(t, err)
+	assert.Equal(t, 3, len(entries))
+
+	// the first read returns more than the requested header
+	record := testFullSensorRecord(0x30, "CPU Temp")
+	s.SetHandler(NetworkFunctionStorage, CommandReserveSDRRepository, func(*Message) Response {
+		return &ReserveSDRRepositoryResponse{CompletionCode: CommandCompleted, ReservationID: 1}
+	})
+	s.SetHandler(NetworkFunctionStorage, CommandGetSDR, func(m *Message) Response {
+		req := &GetSDRRequest{}
+		if err := m.Request(req); err != nil {
+			return err
+		}
+		end := min(int(req.Offset)+int(req.Length), len(record))
+		if req.Offset == 0 {
+			end = sdrHeaderSize + 3
+		}
+		return &GetSDRResponse{CompletionCode: CommandCompleted, NextRecordID: 0xffff, Data: record[req.Offset:end]}
+	})
+
+	records, err := client.SDRs()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "CPU Temp", records[0].Name)
+
+	// the first record leads back to itself through the second
+	s.SetHandler(NetworkFunctionStorage, CommandGetSDR, func(m *Message) Response {
+		req := &GetSDRRequest{}
+		if err := m.Request(req); err != nil {
+			return err
+		}
+		end := min(int(req.Offset)+int(req.Length), len(record))
+		return &GetSDRResponse{CompletionCode: CommandCompleted, NextRecordID: req.RecordID%2 + 1, Data: record[req.Offset:end]}
+	})
+
+	records, err = client.SDRs()
+	assert.Error(t, err)
+	assert.Equal(t, 3, len(records))
+
+	// erasure that never completes
+	s.SetHandler(NetworkFunctionStorage, CommandClearSEL, func(*Message) Response {
+		return &ClearSELResponse{CompletionCode: CommandCompleted, Progress: ClearSELInProgress}
+	})
+
+	err = client.ClearSEL()
+	assert.Error(t, err)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestRaw(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+
+	err = client.Open()
+	assert.NoError(t, err)
+
+	s.SetHandler(NetworkFunction(0x30), 0x01, func(m *Message) Response {
+		return &rawResponse{CompletionCode: CommandCompleted, Data: append([]byte{0xaa}, m.Data...)}
+	})
+
+	cc, data, err := client.Raw(NetworkFunction(0x30), 0x01, []byte{0x01, 0x02})
+	assert.NoError(t, err)
+	assert.Equal(t, CommandCompleted, cc)
+	assert.Equal(t, []byte{0xaa, 0x01, 0x02}, data)
+
+	cc, data, err = client.Raw(NetworkFunctionApp, CommandGetDeviceID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, CommandCompleted, cc)
+	id := &DeviceIDResponse{}
+	assert.NoError(t, responseFromBytes(data, id))
+	assert.Equal(t, uint8(0x51), id.IPMIVersion)
+
+	cc, data, err = client.Raw(NetworkFunction(0x30), 0x02, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrInvalidCommand, cc)
+	assert.Nil(t, data)
+
+	// OEM commands may return data along with an error
+	s.SetHandler(NetworkFunction(0x30), 0x03, func(*Message) Response {
+		return &rawResponse{CompletionCode: CompletionCode(0x80), Data: []byte{0xde, 0xad}}
+	})
+	cc, data, err = client.Raw(NetworkFunction(0x30), 0x03, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, CompletionCode(0x80), cc)
+	assert.Equal(t, []byte{0xde, 0xad}, data)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
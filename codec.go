@@ -0,0 +1,619 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message data is encoded by Marshal and decoded by Unmarshal, unless the type
+// implements encoding.BinaryMarshaler and encoding.BinaryUnmarshaler.
+// Fields are little endian in the order they are declared, as with
+// encoding/binary, and are described further by an "ipmi" struct tag:
+//
+//	bits=N    packs the field into N bits, least significant bits first.
+//	          Consecutive bit fields share bytes and must add up to whole bytes.
+//	len=N     fixed length string or byte slice, NUL padded.
+//	bcd       unsigned integer encoded as binary coded decimal, 2 digits per byte.
+//	optional  trailing field, which may be absent. Zero values are not encoded.
+//	-         the field is ignored.
+//
+// A string or byte slice without len must be the last field and holds the
+// remaining data. Fields named _ are encoded as zeros and skipped when decoding.
+
+// Marshal returns the IPMI encoding of v, which may be a pointer
+func Marshal(v interface{}) ([]byte, error) {
+	val := reflect.ValueOf(v)
+	if !val.IsValid() || (val.Kind() == reflect.Ptr && val.IsNil()) {
+		return nil, fmt.Errorf("ipmi: Marshal of nil %T", v)
+	}
+	val = reflect.Indirect(val)
+	c, err := codecFor(val.Type())
+	if err != nil {
+		return nil, err
+	}
+	e := &encoder{cut: -1}
+	if err := c.encode(e, val); err != nil {
+		return nil, err
+	}
+	if e.cut >= 0 {
+		e.buf = e.buf[:e.cut]
+	}
+	return e.buf, nil
+}
+
+// Unmarshal decodes the IPMI encoding in buf into v, which must be a pointer.
+// Data beyond the fields of v is ignored.
+func Unmarshal(buf []byte, v interface{}) error {
+	_, err := unmarshal(buf, v)
+	return err
+}
+
+// unmarshal decodes buf into v, returning the number of bytes decoded
+func unmarshal(buf []byte, v interface{}) (int, error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return 0, fmt.Errorf("ipmi: Unmarshal of non-pointer %T", v)
+	}
+	val = val.Elem()
+	c, err := codecFor(val.Type())
+	if err != nil {
+		return 0, err
+	}
+	d := &decoder{buf: buf}
+	if err := c.decode(d, val); err != nil {
+		return 0, err
+	}
+	return d.off, nil
+}
+
+type encoder struct {
+	buf []byte
+	// cut is the length to truncate to if the trailing optional fields are zero
+	cut int
+}
+
+type decoder struct {
+	buf []byte
+	off int
+	// done is set once an absent optional field is reached
+	done bool
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if len(d.buf)-d.off < n {
+		return nil, ErrShortPacket
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+// codec encodes and decodes a value of a given type
+type codec interface {
+	encode(*encoder, reflect.Value) error
+	decode(*decoder, reflect.Value) error
+}
+
+var codecs sync.Map // map[reflect.Type]codec
+
+func codecFor(t reflect.Type) (codec, error) {
+	if c, ok := codecs.Load(t); ok {
+		return c.(codec), nil
+	}
+	c, err := newCodec(t, fieldTag{})
+	if err != nil {
+		return nil, err
+	}
+	codecs.Store(t, c)
+	return c, nil
+}
+
+// fieldTag is the parsed "ipmi" struct tag of a field
+type fieldTag struct {
+	skip     bool
+	bits     int
+	length   int
+	bcd      bool
+	optional bool
+}
+
+func parseFieldTag(f reflect.StructField) (fieldTag, error) {
+	var tag fieldTag
+	s, ok := f.Tag.Lookup("ipmi")
+	if !ok || s == "" {
+		return tag, nil
+	}
+	if s == "-" {
+		tag.skip = true
+		return tag, nil
+	}
+
+	for _, opt := range strings.Split(s, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		var err error
+		switch name {
+		case "bits":
+			tag.bits, err = strconv.Atoi(arg)
+			if err == nil && (tag.bits < 1 || tag.bits > 64) {
+				err = fmt.Errorf("out of range")
+			}
+		case "len":
+			tag.length, err = strconv.Atoi(arg)
+			if err == nil && tag.length < 1 {
+				err = fmt.Errorf("out of range")
+			}
+		case "bcd":
+			tag.bcd = true
+		case "optional":
+			tag.optional = true
+		default:
+			err = fmt.Errorf("unknown option")
+		}
+		if err != nil {
+			return tag, fmt.Errorf("ipmi: field %s tag %q: %s", f.Name, opt, err)
+		}
+	}
+
+	return tag, nil
+}
+
+func newCodec(t reflect.Type, tag fieldTag) (codec, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return boolCodec{}, nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c := intCodec{size: int(t.Size()), bcd: tag.bcd}
+		if c.bcd && isSigned(t) {
+			return nil, fmt.Errorf("ipmi: bcd %s must be unsigned", t)
+		}
+		return c, nil
+	case reflect.String:
+		return bytesCodec{length: tag.length, str: true}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return nil, fmt.Errorf("ipmi: unsupported slice type %s", t)
+		}
+		return bytesCodec{length: tag.length}, nil
+	case reflect.Array:
+		elem, err := newCodec(t.Elem(), fieldTag{})
+		if err != nil {
+			return nil, err
+		}
+		return arrayCodec{elem}, nil
+	case reflect.Struct:
+		return newStructCodec(t)
+	default:
+		return nil, fmt.Errorf("ipmi: unsupported type %s", t)
+	}
+}
+
+type structField struct {
+	index int
+	name  string
+	codec codec
+	// bit fields are encoded by the struct rather than a codec
+	bits  int
+	shift int
+	// group is the number of bytes and members the number of fields
+	// of the bit group starting at this field
+	group    int
+	members  int
+	optional bool
+	padding  bool
+}
+
+type structCodec []structField
+
+func newStructCodec(t reflect.Type) (structCodec, error) {
+	var fields structCodec
+	var optional, trailing string
+	var groupStart, groupBits int
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, err := parseFieldTag(f)
+		if err != nil {
+			return nil, err
+		}
+		if tag.skip {
+			continue
+		}
+		if f.PkgPath != "" && f.Name != "_" {
+			return nil, fmt.Errorf("ipmi: %s field %s is not exported", t, f.Name)
+		}
+		if trailing != "" {
+			return nil, fmt.Errorf("ipmi: %s field %s follows variable length field %s", t, f.Name, trailing)
+		}
+		if optional != "" && !tag.optional {
+			return nil, fmt.Errorf("ipmi: %s field %s follows optional field %s", t, f.Name, optional)
+		}
+		if tag.optional {
+			optional = f.Name
+		}
+
+		sf := structField{
+			index:    i,
+			name:     f.Name,
+			optional: tag.optional,
+			padding:  f.Name == "_",
+		}
+
+		if tag.bits > 0 {
+			if !isInteger(f.Type) && f.Type.Kind() != reflect.Bool {
+				return nil, fmt.Errorf("ipmi: %s bit field %s must be an integer or bool", t, f.Name)
+			}
+			if f.Type.Kind() != reflect.Bool && tag.bits > int(f.Type.Size())*8 {
+				return nil, fmt.Errorf("ipmi: %s bit field %s does not fit %s", t, f.Name, f.Type)
+			}
+			if groupBits == 0 {
+				groupStart = len(fields)
+			}
+			sf.bits = tag.bits
+			sf.shift = groupBits
+			groupBits += tag.bits
+			if groupBits > 64 {
+				return nil, fmt.Errorf("ipmi: %s bit field %s exceeds 64 bits", t, f.Name)
+			}
+			fields = append(fields, sf)
+			if groupBits%8 == 0 {
+				fields[groupStart].group = groupBits / 8
+				fields[groupStart].members = len(fields) - groupStart
+				groupBits = 0
+			}
+			continue
+		}
+
+		if groupBits != 0 {
+			return nil, fmt.Errorf("ipmi: %s bit fields before %s do not end on a byte boundary", t, f.Name)
+		}
+
+		sf.codec, err = newCodec(f.Type, tag)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := sf.codec.(bytesCodec); ok && b.length == 0 {
+			trailing = f.Name
+		}
+		fields = append(fields, sf)
+	}
+
+	if groupBits != 0 {
+		return nil, fmt.Errorf("ipmi: %s bit fields do not end on a byte boundary", t)
+	}
+
+	return fields, nil
+}
+
+func (c structCodec) encode(e *encoder, v reflect.Value) error {
+	for i := 0; i < len(c); i++ {
+		f := c[i]
+
+		if f.bits > 0 {
+			group := c[i : i+f.members]
+			var bits uint64
+			for _, g := range group {
+				if !g.padding {
+					bits |= (toUint(v.Field(g.index)) & mask(g.bits)) << uint(g.shift)
+				}
+			}
+			e.optional(f.optional, bits == 0, len(e.buf))
+			e.buf = appendUint(e.buf, bits, f.group)
+			i += f.members - 1
+			continue
+		}
+
+		fv := v.Field(f.index)
+		if f.padding {
+			e.optional(f.optional, true, len(e.buf))
+			e.buf = append(e.buf, make([]byte, fv.Type().Size())...)
+			continue
+		}
+
+		e.optional(f.optional, fv.IsZero(), len(e.buf))
+		if err := f.codec.encode(e, fv); err != nil {
+			return fmt.Errorf("ipmi: field %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// optional tracks where the encoding can be cut, if the optional fields
+// from the given offset to the end are all zero
+func (e *encoder) optional(optional, zero bool, offset int) {
+	switch {
+	case !optional:
+	case !zero:
+		e.cut = -1
+	case e.cut < 0:
+		e.cut = offset
+	}
+}
+
+func (c structCodec) decode(d *decoder, v reflect.Value) error {
+	for i := 0; i < len(c); i++ {
+		f := c[i]
+
+		if f.optional && d.off == len(d.buf) {
+			d.done = true
+		}
+		if d.done {
+			if !f.padding {
+				fv := v.Field(f.index)
+				fv.Set(reflect.Zero(fv.Type()))
+			}
+			continue
+		}
+
+		if f.bits > 0 {
+			b, err := d.next(f.group)
+			if err != nil {
+				return err
+			}
+			bits := readUint(b)
+			for _, g := range c[i : i+f.members] {
+				if !g.padding {
+					setUint(v.Field(g.index), (bits>>uint(g.shift))&mask(g.bits), g.bits)
+				}
+			}
+			i += f.members - 1
+			continue
+		}
+
+		fv := v.Field(f.index)
+		if f.padding {
+			if _, err := d.next(int(fv.Type().Size())); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := f.codec.decode(d, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type boolCodec struct{}
+
+func (boolCodec) encode(e *encoder, v reflect.Value) error {
+	var b byte
+	if v.Bool() {
+		b = 1
+	}
+	e.buf = append(e.buf, b)
+	return nil
+}
+
+func (boolCodec) decode(d *decoder, v reflect.Value) error {
+	b, err := d.next(1)
+	if err != nil {
+		return err
+	}
+	v.SetBool(b[0] != 0)
+	return nil
+}
+
+type intCodec struct {
+	size int
+	bcd  bool
+}
+
+func (c intCodec) encode(e *encoder, v reflect.Value) error {
+	x := toUint(v)
+	if c.bcd {
+		var err error
+		if x, err = toBCD(x, c.size); err != nil {
+			return err
+		}
+	}
+	e.buf = appendUint(e.buf, x, c.size)
+	return nil
+}
+
+func (c intCodec) decode(d *decoder, v reflect.Value) error {
+	b, err := d.next(c.size)
+	if err != nil {
+		return err
+	}
+	x := readUint(b)
+	if c.bcd {
+		if x, err = fromBCD(x, c.size); err != nil {
+			return err
+		}
+	}
+	setUint(v, x, c.size*8)
+	return nil
+}
+
+type bytesCodec struct {
+	// length is 0 for the remaining data
+	length int
+	str    bool
+}
+
+func (c bytesCodec) encode(e *encoder, v reflect.Value) error {
+	var b []byte
+	if c.str {
+		b = []byte(v.String())
+	} else {
+		b = v.Bytes()
+	}
+	if c.length == 0 {
+		e.buf = append(e.buf, b...)
+		return nil
+	}
+	if len(b) > c.length {
+		return ErrLongPacket
+	}
+	e.buf = append(e.buf, b...)
+	e.buf = append(e.buf, make([]byte, c.length-len(b))...)
+	return nil
+}
+
+func (c bytesCodec) decode(d *decoder, v reflect.Value) error {
+	n := c.length
+	if n == 0 {
+		n = len(d.buf) - d.off
+	}
+	b, err := d.next(n)
+	if err != nil {
+		return err
+	}
+	if c.str {
+		v.SetString(strings.TrimRight(string(b), "\000"))
+		return nil
+	}
+	if c.length != 0 {
+		b = trimNUL(b)
+	}
+	v.SetBytes(append([]byte{}, b...))
+	return nil
+}
+
+func trimNUL(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+type arrayCodec struct {
+	elem codec
+}
+
+func (c arrayCodec) encode(e *encoder, v reflect.Value) error {
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		for i := 0; i < v.Len(); i++ {
+			e.buf = append(e.buf, uint8(v.Index(i).Uint()))
+		}
+		return nil
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := c.elem.encode(e, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c arrayCodec) decode(d *decoder, v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		if err := c.elem.decode(d, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isSigned(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isInteger(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func mask(bits int) uint64 {
+	if bits >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<uint(bits) - 1
+}
+
+func toUint(v reflect.Value) uint64 {
+	switch {
+	case v.Kind() == reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	case isSigned(v.Type()):
+		return uint64(v.Int())
+	default:
+		return v.Uint()
+	}
+}
+
+// setUint sets v to x, sign extending signed integers from the given
+// number of encoded bits
+func setUint(v reflect.Value, x uint64, bits int) {
+	switch {
+	case v.Kind() == reflect.Bool:
+		v.SetBool(x != 0)
+	case isSigned(v.Type()):
+		shift := uint(64 - bits)
+		v.SetInt(int64(x<<shift) >> shift)
+	default:
+		v.SetUint(x)
+	}
+}
+
+func appendUint(buf []byte, x uint64, size int) []byte {
+	for i := 0; i < size; i++ {
+		buf = append(buf, uint8(x>>(8*uint(i))))
+	}
+	return buf
+}
+
+func readUint(b []byte) uint64 {
+	var x uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		x = x<<8 | uint64(b[i])
+	}
+	return x
+}
+
+// toBCD encodes x in size bytes, with the least significant digits first
+func toBCD(x uint64, size int) (uint64, error) {
+	var bcd uint64
+	for i := 0; i < size*2; i++ {
+		bcd |= (x % 10) << (4 * uint(i))
+		x /= 10
+	}
+	if x != 0 {
+		return 0, ErrLongPacket
+	}
+	return bcd, nil
+}
+
+func fromBCD(bcd uint64, size int) (uint64, error) {
+	var x uint64
+	for i := size*2 - 1; i >= 0; i-- {
+		digit := (bcd >> (4 * uint(i))) & 0x0f
+		if digit > 9 {
+			return 0, ErrInvalidPacket
+		}
+		x = x*10 + digit
+	}
+	return x, nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCodecMessage struct {
+	CompletionCode
+	ChannelNumber uint8  `ipmi:"bits=4"`
+	_             uint8  `ipmi:"bits=3"`
+	Enabled       bool   `ipmi:"bits=1"`
+	Major         uint8  `ipmi:"bits=7"`
+	Minor         uint16 `ipmi:"bits=9"`
+	Revision      uint8  `ipmi:"bcd"`
+	Offset        int16
+	Name          string `ipmi:"len=8"`
+	Cache         []byte `ipmi:"-"`
+	Aux           [2]uint8
+	Flags         uint8  `ipmi:"optional"`
+	Data          []byte `ipmi:"optional"`
+}
+
+func TestCodec(t *testing.T) {
+	m := &testCodecMessage{
+		CompletionCode: CommandCompleted,
+		ChannelNumber:  0x0e,
+		Enabled:        true,
+		Major:          0x51,
+		Minor:          0x1ff,
+		Revision:       42,
+		Offset:         -2,
+		Name:           "bmc",
+		Aux:            [2]uint8{1, 2},
+		Flags:          0x80,
+		Data:           []byte{0xaa, 0xbb},
+	}
+
+	buf, err := Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x00,
+		0x8e,       // channel and enabled
+		0xd1, 0xff, // major and minor
+		0x42,       // BCD
+		0xfe, 0xff, // -2
+		'b', 'm', 'c', 0, 0, 0, 0, 0,
+		0x01, 0x02,
+		0x80,
+		0xaa, 0xbb,
+	}, buf)
+
+	out := &testCodecMessage{Cache: []byte{1}}
+	err = Unmarshal(buf, out)
+	assert.NoError(t, err)
+	out.Cache = nil
+	assert.Equal(t, m, out)
+
+	// trailing optional fields are not encoded when zero
+	m.Flags = 0
+	m.Data = nil
+	buf, err = Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, 17, len(buf))
+
+	// and are zeroed when absent
+	out.Flags = 0xff
+	err = Unmarshal(buf, out)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0), out.Flags)
+	assert.Nil(t, out.Data)
+
+	err = Unmarshal(buf[:16], out)
+	assert.Equal(t, ErrShortPacket, err)
+
+	// invalid BCD digits
+	buf[4] = 0x4a
+	err = Unmarshal(buf, out)
+	assert.Equal(t, ErrInvalidPacket, err)
+
+	m.Revision = 100
+	_, err = Marshal(m)
+	assert.True(t, errors.Is(err, ErrLongPacket))
+
+	m.Revision = 0
+	m.Name = "too long name"
+	_, err = Marshal(m)
+	assert.True(t, errors.Is(err, ErrLongPacket))
+}
+
+func TestCodecValues(t *testing.T) {
+	buf, err := Marshal(ErrInvalidCommand)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xc1}, buf)
+
+	buf, err = Marshal([]byte{1, 2, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, buf)
+
+	var cc CompletionCode
+	err = Unmarshal([]byte{0xc1, 0x00}, &cc)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrInvalidCommand, cc)
+
+	err = Unmarshal([]byte{0xc1}, cc)
+	assert.Error(t, err)
+
+	_, err = Marshal(nil)
+	assert.Error(t, err)
+	_, err = Marshal((*DeviceIDResponse)(nil))
+	assert.Error(t, err)
+	_, err = messageDataToBytes((*DeviceIDRequest)(nil))
+	assert.True(t, errors.Is(err, ErrInvalidPacket))
+}
+
+func TestCodecSigned(t *testing.T) {
+	type nibbles struct {
+		Low  int8 `ipmi:"bits=4"`
+		High int8 `ipmi:"bits=4"`
+	}
+
+	m := &nibbles{}
+	err := Unmarshal([]byte{0x7f}, m)
+	assert.NoError(t, err)
+	assert.Equal(t, &nibbles{Low: -1, High: 7}, m)
+
+	buf, err := Marshal(&nibbles{Low: -1, High: -8})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x8f}, buf)
+
+	buf, err = Marshal(&nibbles{Low: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0f}, buf)
+
+	var x int16
+	err = Unmarshal([]byte{0xfe, 0xff}, &x)
+	assert.NoError(t, err)
+	assert.Equal(t, int16(-2), x)
+}
+
+func TestCodecTrailingData(t *testing.T) {
+	m := &Message{Data: []byte{0x02, 0x00}}
+	assert.Equal(t, ErrLongPacket, m.Request(&GetUserNameRequest{}))
+	assert.Nil(t, m.Request(&struct {
+		UserID uint8
+		Data   []byte
+	}{}))
+
+	// responses may have data beyond the fields, such as OEM extensions
+	assert.NoError(t, messageDataFromBytes([]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0xff}, &ChassisStatusResponse{}))
+}
+
+func TestCodecTags(t *testing.T) {
+	tests := []interface{}{
+		&struct {
+			A uint8 `ipmi:"bits=3"`
+			B uint8
+		}{},
+		&struct {
+			A uint8 `ipmi:"bits=9"`
+		}{},
+		&struct {
+			A []byte
+			B uint8
+		}{},
+		&struct {
+			A uint8 `ipmi:"optional"`
+			B uint8
+		}{},
+		&struct {
+			A int8 `ipmi:"bcd"`
+		}{},
+		&struct {
+			A uint8 `ipmi:"size=1"`
+		}{},
+		&struct {
+			A []uint16
+		}{},
+		&struct {
+			A int
+		}{},
+		&struct {
+			a uint8
+		}{},
+	}
+
+	for _, test := range tests {
+		_, err := Marshal(test)
+		assert.Error(t, err, "%T", test)
+		err = Unmarshal(make([]byte, 8), test)
+		assert.Error(t, err, "%T", test)
+	}
+}
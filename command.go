@@ -27,12 +27,28 @@ const (
 	CommandActivateSession          = Command(0x3a)
 	CommandSetSessionPrivilegeLevel = Command(0x3b)
 	CommandCloseSession             = Command(0x3c)
+	CommandActivatePayload          = Command(0x48)
+	CommandDeactivatePayload        = Command(0x49)
+	CommandGetChannelCipherSuites   = Command(0x54)
 	CommandChassisControl           = Command(0x02)
 	CommandChassisStatus            = Command(0x01)
 	CommandSetSystemBootOptions     = Command(0x08)
 	CommandGetSystemBootOptions     = Command(0x09)
 	CommandSetUserName              = Command(0x45)
 	CommandGetUserName              = Command(0x46)
+	CommandGetSensorReading         = Command(0x2d)
+	CommandGetFRUInventoryAreaInfo  = Command(0x10)
+	CommandReadFRUData              = Command(0x11)
+	CommandWriteFRUData             = Command(0x12)
+	CommandGetSDRRepositoryInfo     = Command(0x20)
+	CommandReserveSDRRepository     = Command(0x22)
+	CommandGetSDR                   = Command(0x23)
+	CommandGetSELInfo               = Command(0x40)
+	CommandReserveSEL               = Command(0x42)
+	CommandGetSELEntry              = Command(0x43)
+	CommandAddSELEntry              = Command(0x44)
+	CommandClearSEL                 = Command(0x47)
+	CommandGetLANConfig             = Command(0x02)
 )
 
 // Request structure
@@ -47,6 +63,12 @@ type Response interface {
 	Code() uint8
 }
 
+// rawResponse keeps the response data as is, for commands without a Response type
+type rawResponse struct {
+	CompletionCode
+	Data []byte
+}
+
 // DeviceIDRequest per section 20.1
 type DeviceIDRequest struct{}
 
@@ -80,6 +102,21 @@ type AuthCapabilitiesResponse struct {
 	OEMAux          uint8
 }
 
+// ExtendedCapabilities returns true if the BMC reports IPMI v2.0+ extended capabilities
+func (r *AuthCapabilitiesResponse) ExtendedCapabilities() bool {
+	return r.AuthTypeSupport&0x80 != 0
+}
+
+// SupportsIPMIv15 returns true if the BMC accepts IPMI v1.5 sessions
+func (r *AuthCapabilitiesResponse) SupportsIPMIv15() bool {
+	return !r.ExtendedCapabilities() || r.Reserved&0x01 != 0
+}
+
+// SupportsIPMIv20 returns true if the BMC accepts IPMI v2.0 (RMCP+) sessions
+func (r *AuthCapabilitiesResponse) SupportsIPMIv20() bool {
+	return r.ExtendedCapabilities() && r.Reserved&0x02 != 0
+}
+
 // AuthType
 const (
 	AuthTypeNone = iota
@@ -15,3 +15,111 @@ limitations under the License.
 */
 
 package ipmi
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// messageDataTypes returns a new value of every request and response type
+func messageDataTypes() []interface{} {
+	return []interface{}{
+		&ChassisStatusRequest{}, &ChassisStatusResponse{},
+		&ChassisControlRequest{}, &ChassisControlResponse{},
+		&SetSystemBootOptionsRequest{}, &SetSystemBootOptionsResponse{},
+		&SystemBootOptionsRequest{}, &SystemBootOptionsResponse{},
+		&rawResponse{},
+		&DeviceIDRequest{}, &DeviceIDResponse{},
+		&AuthCapabilitiesRequest{}, &AuthCapabilitiesResponse{},
+		&SessionChallengeRequest{}, &SessionChallengeResponse{},
+		&ActivateSessionRequest{}, &ActivateSessionResponse{},
+		&SessionPrivilegeLevelRequest{}, &SessionPrivilegeLevelResponse{},
+		&CloseSessionRequest{}, &CloseSessionResponse{},
+		&FRUInventoryAreaInfoRequest{}, &FRUInventoryAreaInfoResponse{},
+		&ReadFRUDataRequest{}, &ReadFRUDataResponse{},
+		&WriteFRUDataRequest{}, &WriteFRUDataResponse{},
+		&SDRRepositoryInfoRequest{}, &SDRRepositoryInfoResponse{},
+		&ReserveSDRRepositoryRequest{}, &ReserveSDRRepositoryResponse{},
+		&GetSDRRequest{}, &GetSDRResponse{},
+		&SensorReadingRequest{}, &SensorReadingResponse{},
+		&SELInfoRequest{}, &SELInfoResponse{},
+		&ReserveSELRequest{}, &ReserveSELResponse{},
+		&GetSELEntryRequest{}, &GetSELEntryResponse{},
+		&AddSELEntryRequest{}, &AddSELEntryResponse{},
+		&ClearSELRequest{}, &ClearSELResponse{},
+		&GetUserNameRequest{}, &GetUserNameResponse{},
+		&SetUserNameRequest{}, &SetUserNameResponse{},
+		&LANConfigRequest{}, &LANConfigResponse{},
+		&ChannelCipherSuitesRequest{}, &ChannelCipherSuitesResponse{},
+		&OpenSessionRequest{}, &OpenSessionResponse{},
+		&RAKPMessage1{}, &RAKPMessage2{}, &RAKPMessage3{}, &RAKPMessage4{},
+		&ActivatePayloadRequest{}, &ActivatePayloadResponse{},
+		&DeactivatePayloadRequest{}, &DeactivatePayloadResponse{},
+		&solPacket{},
+	}
+}
+
+// TestMessageDataTypes checks every message type declared in the package
+// is fuzzed by FuzzMessageData
+func TestMessageDataTypes(t *testing.T) {
+	listed := make(map[string]bool)
+	for _, data := range messageDataTypes() {
+		listed[reflect.TypeOf(data).Elem().Name()] = true
+	}
+
+	name := regexp.MustCompile(`^([A-Z]\w*(Request|Response)|RAKPMessage\d)$`)
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		ast.Inspect(pkg, func(n ast.Node) bool {
+			if spec, ok := n.(*ast.TypeSpec); ok && name.MatchString(spec.Name.Name) && !listed[spec.Name.Name] {
+				t.Errorf("%s is missing from messageDataTypes", spec.Name.Name)
+			}
+			return true
+		})
+	}
+}
+
+// FuzzMessageData decodes every request and response type
+func FuzzMessageData(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x00, 0x01, 0x05, 0x80, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00})
+	f.Add(make([]byte, 32))
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		types := messageDataTypes()
+
+		for _, data := range types {
+			if messageDataFromBytes(buf, data) != nil {
+				continue
+			}
+			if _, err := messageDataToBytes(data); err != nil {
+				t.Errorf("%T: %s", data, err)
+			}
+
+			switch r := data.(type) {
+			case *SystemBootOptionsResponse:
+				_ = r.BootDeviceSelector()
+			case *ChassisStatusResponse:
+				_ = r.String()
+				_ = r.PowerRestorePolicy()
+			case *AuthCapabilitiesResponse:
+				_ = r.SupportsIPMIv15()
+				_ = r.SupportsIPMIv20()
+			case *SensorReadingResponse:
+				_ = r.Unavailable()
+			}
+		}
+	})
+}
@@ -49,6 +49,40 @@ const (
 	ErrUnspecified       = CompletionCode(0xff)
 )
 
+// Command specific Completion Codes of the session commands per section 22,
+// the same values have a different meaning in responses to other commands
+const (
+	// ErrInvalidUsername is returned by Get Session Challenge
+	ErrInvalidUsername = CompletionCode(0x81)
+	// ErrNullUserDisabled is returned by Get Session Challenge
+	ErrNullUserDisabled = CompletionCode(0x82)
+	// ErrNoSessionSlot is returned by Activate Session
+	ErrNoSessionSlot = CompletionCode(0x81)
+	// ErrSessionSeqRange is returned by Activate Session
+	ErrSessionSeqRange = CompletionCode(0x84)
+	// ErrInvalidSessionID is returned by Activate Session
+	ErrInvalidSessionID = CompletionCode(0x85)
+	// ErrPrivLimitExceeded is returned by Activate Session
+	ErrPrivLimitExceeded = CompletionCode(0x86)
+	// ErrSessionPrivLimit is returned by Set Session Privilege Level
+	ErrSessionPrivLimit = CompletionCode(0x81)
+	// ErrCloseInvalidSessionID is returned by Close Session
+	ErrCloseInvalidSessionID = CompletionCode(0x87)
+)
+
+// Command specific Completion Codes of the payload commands per section 24
+const (
+	// ErrPayloadActive is returned by Activate Payload
+	ErrPayloadActive = CompletionCode(0x80)
+	// ErrPayloadInactive is returned by Deactivate Payload
+	ErrPayloadInactive = CompletionCode(0x80)
+)
+
+// ErrParamNotSupported is the command specific Completion Code of the
+// Get LAN Configuration Parameters and Get System Boot Options commands
+// for parameters the BMC does not implement, per sections 23.2 and 28.13
+const ErrParamNotSupported = CompletionCode(0x80)
+
 var completionCodes = map[CompletionCode]string{
 	CommandCompleted:     "Command completed normally",
 	ErrNodeBusy:          "Node busy",
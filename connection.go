@@ -17,8 +17,10 @@ limitations under the License.
 package ipmi
 
 import (
-	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Connection properties for a Client
@@ -29,26 +31,87 @@ type Connection struct {
 	Username  string
 	Password  string
 	Interface string
+	// Privilege level requested for the session, defaults to PrivLevelAdmin
+	Privilege uint8
+	// LUN of the BMC commands are addressed to
+	LUN uint8
+	// AuthTypes allowed for the session in order of preference,
+	// defaults to MD5, MD2, Password, None
+	AuthTypes []uint8
+	// BMCKey is the Kg key for IPMI v2.0 sessions
+	BMCKey string
+	// CipherSuite ID for IPMI v2.0 sessions, zero uses the ipmitool default
+	CipherSuite int
+	// Timeout waiting for a response, defaults to 5 seconds
+	Timeout time.Duration
+	// Retries of a request without response, used by ipmitool only
+	Retries int
+	// TargetAddress and TargetChannel bridge requests to a satellite
+	// controller behind the BMC, used by ipmitool only
+	TargetAddress uint8
+	TargetChannel uint8
+	// PasswordFile, if set, is read by ipmitool instead of Password
+	PasswordFile string
+	// Keepalive is the interval after which an idle session is kept
+	// alive with a no-op request. Zero disables the keepalive.
+	Keepalive time.Duration
+	// Tracer, if set, receives every datagram of the native lan transport
+	Tracer Tracer
+	// Logger for session errors, defaults to slog.Default()
+	Logger Logger
+	// Metrics, if set, observes every request sent by a Client
+	Metrics Metrics
+	// Recorder, if set, records every request sent by a Client
+	// and its response, for replay by NewReplayClient
+	Recorder *Recorder
 }
 
-// RemoteIP returns the remote (bmc) IP address of the Connection
+// defaultTimeout waiting for a response
+const defaultTimeout = time.Second * 5
+
+func (c *Connection) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return defaultTimeout
+}
+
+// host returns the Hostname with any brackets around an IPv6 literal removed
+func (c *Connection) host() string {
+	return strings.TrimSuffix(strings.TrimPrefix(c.Hostname, "["), "]")
+}
+
+// RemoteIP returns the remote (bmc) IP address of the Connection.
+// Hostnames are resolved for both IPv4 and IPv6, preferring IPv4.
 func (c *Connection) RemoteIP() string {
-	if net.ParseIP(c.Hostname) == nil {
-		addrs, err := net.LookupHost(c.Hostname)
-		if err != nil && len(addrs) > 0 {
+	host := c.host()
+	if net.ParseIP(host) == nil {
+		addrs, err := net.LookupHost(host)
+		if err == nil && len(addrs) > 0 {
+			for _, addr := range addrs {
+				if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+					return addr
+				}
+			}
 			return addrs[0]
 		}
 	}
-	return c.Hostname
+	return host
+}
+
+// remoteAddr returns the address to dial, resolving the hostname once
+// such that the address family is the one RemoteIP reports
+func (c *Connection) remoteAddr() string {
+	return net.JoinHostPort(c.RemoteIP(), strconv.Itoa(c.Port))
 }
 
 // LocalIP returns the local (client) IP address of the Connection
 func (c *Connection) LocalIP() string {
-	conn, err := net.Dial("udp", fmt.Sprintf("%s:%d", c.Hostname, c.Port))
+	conn, err := net.Dial("udp", c.remoteAddr())
 	if err != nil {
 		// don't bother returning an error, since this value will never
 		// make it to the bmc if we can't connect to it.
-		return c.Hostname
+		return c.host()
 	}
 	_ = conn.Close()
 	host, _, _ := net.SplitHostPort(conn.LocalAddr().String())
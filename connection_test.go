@@ -17,6 +17,7 @@ limitations under the License.
 package ipmi
 
 import (
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,9 +26,31 @@ import (
 func TestRemoteIP(t *testing.T) {
 	c := Connection{Hostname: "127.0.0.1"}
 	assert.Equal(t, c.Hostname, c.RemoteIP())
+
+	c = Connection{Hostname: "[::1]"}
+	assert.Equal(t, "::1", c.RemoteIP())
+
+	c = Connection{Hostname: "localhost"}
+	assert.Equal(t, "127.0.0.1", c.RemoteIP())
 }
 
 func TestLocalIP(t *testing.T) {
 	c := Connection{Hostname: "127.0.0.1"}
 	assert.Equal(t, c.Hostname, c.LocalIP())
+
+	c = Connection{Hostname: "::1", Port: 623}
+	conn, err := net.Dial("udp", "[::1]:623")
+	if err != nil {
+		t.Skipf("IPv6 not available: %s", err)
+	}
+	_ = conn.Close()
+	assert.Equal(t, c.Hostname, c.LocalIP())
+}
+
+func TestRemoteAddr(t *testing.T) {
+	c := Connection{Hostname: "localhost", Port: 623}
+	assert.Equal(t, net.JoinHostPort(c.RemoteIP(), "623"), c.remoteAddr())
+
+	c = Connection{Hostname: "[::1]", Port: 623}
+	assert.Equal(t, "[::1]:623", c.remoteAddr())
 }
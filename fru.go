@@ -0,0 +1,274 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FRUInventoryAreaInfoRequest per section 34.1
+type FRUInventoryAreaInfoRequest struct {
+	DeviceID uint8
+}
+
+// FRUInventoryAreaInfoResponse per section 34.1
+type FRUInventoryAreaInfoResponse struct {
+	CompletionCode
+	AreaSize uint16
+	// Access bit 0 is set if the device is accessed by words
+	Access uint8
+}
+
+// ReadFRUDataRequest per section 34.2
+type ReadFRUDataRequest struct {
+	DeviceID uint8
+	Offset   uint16
+	Count    uint8
+}
+
+// ReadFRUDataResponse per section 34.2
+type ReadFRUDataResponse struct {
+	CompletionCode
+	Count uint8
+	Data  []uint8
+}
+
+// UnmarshalBinary implementation to limit Data to Count
+func (r *ReadFRUDataResponse) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 2 {
+		return ErrShortPacket
+	}
+	r.CompletionCode = CompletionCode(buf[0])
+	r.Count = buf[1]
+	r.Data = buf[2:]
+	if int(r.Count) < len(r.Data) {
+		r.Data = r.Data[:r.Count]
+	}
+	return nil
+}
+
+// WriteFRUDataRequest per section 34.3
+type WriteFRUDataRequest struct {
+	DeviceID uint8
+	Offset   uint16
+	Data     []uint8
+}
+
+// WriteFRUDataResponse per section 34.3
+type WriteFRUDataResponse struct {
+	CompletionCode
+	Count uint8
+}
+
+// FRUInfo is the chassis, board and product information of a FRU device
+// per the Platform Management FRU Information Storage Definition,
+// as printed by ipmitool fru print
+type FRUInfo struct {
+	ChassisType         ChassisType
+	ChassisPartNumber   string
+	ChassisSerial       string
+	BoardMfgDate        time.Time
+	BoardManufacturer   string
+	BoardProduct        string
+	BoardSerial         string
+	BoardPartNumber     string
+	ProductManufacturer string
+	ProductName         string
+	ProductPartNumber   string
+	ProductVersion      string
+	ProductSerial       string
+	ProductAssetTag     string
+}
+
+// ChassisType per SMBIOS, as referenced by the FRU chassis info area
+type ChassisType uint8
+
+var chassisTypeStrings = []string{
+	"Unspecified", "Other", "Unknown", "Desktop", "Low Profile Desktop",
+	"Pizza Box", "Mini Tower", "Tower", "Portable", "LapTop", "Notebook",
+	"Hand Held", "Docking Station", "All in One", "Sub Notebook",
+	"Space-saving", "Lunch Box", "Main Server Chassis", "Expansion Chassis",
+	"SubChassis", "Bus Expansion Chassis", "Peripheral Chassis",
+	"RAID Chassis", "Rack Mount Chassis", "Sealed-case PC",
+	"Multi-system Chassis", "CompactPCI", "AdvancedTCA", "Blade",
+	"Blade Enclosure",
+}
+
+func (t ChassisType) String() string {
+	if int(t) < len(chassisTypeStrings) {
+		return chassisTypeStrings[t]
+	}
+	return fmt.Sprintf("Unknown (0x%02x)", uint8(t))
+}
+
+// fruEpoch is the base of board manufacturing dates
+var fruEpoch = time.Date(1996, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// fruEndOfFields is the type/length byte terminating an area
+const fruEndOfFields = 0xc1
+
+// UnmarshalBinary implementation to parse the FRU common header and
+// the chassis, board and product info areas
+func (f *FRUInfo) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 8 {
+		return ErrShortPacket
+	}
+	if buf[0]&0x0f != 0x01 || checksum(buf[:8]...) != 0 {
+		return ErrInvalidPacket
+	}
+
+	area := func(n int) []byte {
+		offset := int(buf[n]) * 8
+		if offset == 0 || offset+2 > len(buf) {
+			return nil
+		}
+		end := offset + int(buf[offset+1])*8
+		if end > len(buf) || end < offset+2 {
+			end = len(buf)
+		}
+		return buf[offset:end]
+	}
+
+	if a := area(2); a != nil && len(a) > 2 {
+		f.ChassisType = ChassisType(a[2])
+		fields := fruFields(a[3:], 2)
+		f.ChassisPartNumber, f.ChassisSerial = fields[0], fields[1]
+	}
+
+	if a := area(3); a != nil && len(a) > 6 {
+		minutes := uint32(a[3]) | uint32(a[4])<<8 | uint32(a[5])<<16
+		if minutes != 0 {
+			f.BoardMfgDate = fruEpoch.Add(time.Duration(minutes) * time.Minute)
+		}
+		fields := fruFields(a[6:], 4)
+		f.BoardManufacturer, f.BoardProduct = fields[0], fields[1]
+		f.BoardSerial, f.BoardPartNumber = fields[2], fields[3]
+	}
+
+	if a := area(4); a != nil && len(a) > 3 {
+		fields := fruFields(a[3:], 6)
+		f.ProductManufacturer, f.ProductName = fields[0], fields[1]
+		f.ProductPartNumber, f.ProductVersion = fields[2], fields[3]
+		f.ProductSerial, f.ProductAssetTag = fields[4], fields[5]
+	}
+
+	return nil
+}
+
+// fruFields decodes up to n type/length encoded fields
+func fruFields(buf []byte, n int) []string {
+	fields := make([]string, n)
+
+	for i := 0; i < n && len(buf) > 0 && buf[0] != fruEndOfFields; i++ {
+		length := int(buf[0] & 0x3f)
+		typ := buf[0] >> 6
+		buf = buf[1:]
+		if length > len(buf) {
+			length = len(buf)
+		}
+		fields[i] = fruDecode(typ, buf[:length])
+		buf = buf[length:]
+	}
+
+	return fields
+}
+
+// fruDecode a field per section 13 of the FRU storage definition
+func fruDecode(typ uint8, data []byte) string {
+	switch typ {
+	case 0: // binary
+		return hex.EncodeToString(data)
+	case 1: // BCD plus
+		const digits = "0123456789 -.:,_"
+		var s strings.Builder
+		for _, b := range data {
+			s.WriteByte(digits[b>>4])
+			s.WriteByte(digits[b&0x0f])
+		}
+		return s.String()
+	case 2: // 6-bit ASCII packed
+		var s strings.Builder
+		var acc uint32
+		var bits uint
+		for _, b := range data {
+			acc |= uint32(b) << bits
+			bits += 8
+			for bits >= 6 {
+				s.WriteByte(byte(acc&0x3f) + 0x20)
+				acc >>= 6
+				bits -= 6
+			}
+		}
+		return strings.TrimRight(s.String(), " ")
+	}
+	// 8-bit ASCII + Latin 1
+	return strings.TrimRight(string(data), "\000 ")
+}
+
+// fruEncode a field as 8-bit ASCII
+func fruEncode(s string) []byte {
+	if len(s) > 0x3f {
+		s = s[:0x3f]
+	}
+	return append([]byte{0xc0 | uint8(len(s))}, s...)
+}
+
+// MarshalBinary implementation to encode the FRU common header and
+// the chassis, board and product info areas
+func (f *FRUInfo) MarshalBinary() ([]byte, error) {
+	chassis := []byte{0x01, 0, uint8(f.ChassisType)}
+	chassis = append(chassis, fruEncode(f.ChassisPartNumber)...)
+	chassis = append(chassis, fruEncode(f.ChassisSerial)...)
+
+	board := []byte{0x01, 0, 0x19} // English
+	var minutes uint32
+	if !f.BoardMfgDate.IsZero() {
+		minutes = uint32(f.BoardMfgDate.Sub(fruEpoch) / time.Minute)
+	}
+	board = append(board, uint8(minutes), uint8(minutes>>8), uint8(minutes>>16))
+	for _, s := range []string{f.BoardManufacturer, f.BoardProduct, f.BoardSerial, f.BoardPartNumber, ""} {
+		board = append(board, fruEncode(s)...)
+	}
+
+	product := []byte{0x01, 0, 0x19}
+	for _, s := range []string{f.ProductManufacturer, f.ProductName, f.ProductPartNumber,
+		f.ProductVersion, f.ProductSerial, f.ProductAssetTag, ""} {
+		product = append(product, fruEncode(s)...)
+	}
+
+	buf := []byte{0x01, 0, 0, 0, 0, 0, 0, 0}
+	for i, a := range [][]byte{chassis, board, product} {
+		buf[2+i] = uint8(len(buf) / 8)
+		buf = append(buf, fruArea(a)...)
+	}
+	buf[7] = checksum(buf[:7]...)
+
+	return buf, nil
+}
+
+// fruArea terminates, pads and checksums an info area
+func fruArea(a []byte) []byte {
+	a = append(a, fruEndOfFields)
+	for (len(a)+1)%8 != 0 {
+		a = append(a, 0)
+	}
+	a[1] = uint8((len(a) + 1) / 8)
+	return append(a, checksum(a...))
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFRUInfo(t *testing.T) {
+	fru := &FRUInfo{
+		ChassisType:         0x17,
+		ChassisPartNumber:   "CPN-1",
+		ChassisSerial:       "CSN-1",
+		BoardMfgDate:        time.Date(2018, time.September, 21, 6, 9, 0, 0, time.UTC),
+		BoardManufacturer:   "Dell Inc.",
+		BoardProduct:        "PowerEdge R640",
+		BoardSerial:         "BSN-1",
+		BoardPartNumber:     "BPN-1",
+		ProductManufacturer: "Dell Inc.",
+		ProductName:         "PowerEdge R640",
+		ProductPartNumber:   "PPN-1",
+		ProductVersion:      "01",
+		ProductSerial:       "PSN-1",
+		ProductAssetTag:     "asset",
+	}
+
+	buf, err := fru.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(buf)%8)
+
+	out := &FRUInfo{}
+	err = out.UnmarshalBinary(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, fru, out)
+	assert.Equal(t, "Rack Mount Chassis", out.ChassisType.String())
+
+	buf[7]++
+	err = out.UnmarshalBinary(buf)
+	assert.Equal(t, ErrInvalidPacket, err)
+}
+
+func TestFRUDecode(t *testing.T) {
+	// "IPMI" in 6-bit packed ASCII
+	assert.Equal(t, "IPMI", fruDecode(2, []byte{0x29, 0xdc, 0xa6}))
+	assert.Equal(t, "1234-", fruDecode(1, []byte{0x12, 0x34, 0xb0})[:5])
+	assert.Equal(t, "0102", fruDecode(0, []byte{0x01, 0x02}))
+	assert.Equal(t, "abc", fruDecode(3, []byte("abc\000")))
+}
+
+func FuzzFRUInfo(f *testing.F) {
+	buf, _ := (&FRUInfo{ChassisType: 0x17, BoardProduct: "goipmi", ProductName: "goipmi"}).MarshalBinary()
+	f.Add(buf)
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		fru := &FRUInfo{}
+		if fru.UnmarshalBinary(buf) != nil {
+			return
+		}
+		_ = fru.ChassisType.String()
+	})
+}
@@ -1,7 +1,13 @@
 module github.com/vmware/goipmi
 
+go 1.22
+
+require (
+	github.com/stretchr/testify v1.2.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.2.2
 )
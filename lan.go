@@ -17,17 +17,29 @@ limitations under the License.
 package ipmi
 
 import (
-	"crypto/md5"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"log"
 	"net"
 	"os"
-	"strconv"
 	"time"
 )
 
+const (
+	lanChannelE     = 0x0e // the channel this request is being received over
+	channelExtended = 0x80 // request IPMI v2.0+ extended data
+
+	authStatusPerMessageDisabled = 0x10
+	authStatusUserLevelDisabled  = 0x08
+)
+
+// ErrInvalidSession is returned when the BMC only responds outside of the active session
+var ErrInvalidSession = errors.New("invalid session")
+
+// errNoIPMI is returned when the presence pong does not report IPMI support
+var errNoIPMI = errors.New("IPMI not supported")
+
 type lan struct {
 	*Connection
 	ipmiSession
@@ -35,6 +47,13 @@ type lan struct {
 	conn     net.Conn
 	active   bool
 	authcode [16]uint8
+	// authStatus from Get Channel Authentication Capabilities
+	authStatus uint8
+	// authRequired is false once the session is activated if the BMC has
+	// per-message or user level authentication disabled
+	authRequired bool
+	// inbound sequence number window of the active session
+	inbound  *sequenceWindow
 	username [16]uint8
 	priv     uint8
 	lun      uint8
@@ -51,34 +70,44 @@ func newLanTransport(c *Connection) transport {
 }
 
 func (l *lan) dial() (net.Conn, error) {
-	// TODO: support more than just udp4
-	addr := net.JoinHostPort(l.Hostname, strconv.Itoa(l.Port))
-	return net.Dial("udp4", addr)
+	return net.Dial("udp", l.remoteAddr())
 }
 
 func (l *lan) open() error {
+	if err := l.connect(); err != nil {
+		return err
+	}
+
+	return l.openSession()
+}
+
+func (l *lan) connect() error {
 	conn, err := l.dial()
 	if err != nil {
 		return err
 	}
 	l.conn = conn
 
-	// TODO: options
-	l.priv = PrivLevelAdmin
-	l.timeout = time.Second * 5
-	l.lun = 0
+	l.priv = l.Privilege
+	if l.priv == PrivLevelNone {
+		l.priv = PrivLevelAdmin
+	}
+	l.timeout = l.Connection.timeout()
+	l.lun = l.LUN & 3
 
-	return l.openSession()
+	return nil
 }
 
 func (l *lan) close() error {
 	if l.active {
 		err := l.closeSession()
 		if err != nil {
-			log.Printf("error closing session: %s", err)
+			l.logger().Warn("error closing session", "host", l.Hostname, "err", err)
 		}
 		l.active = false
 	}
+	l.ipmiSession = ipmiSession{}
+	l.inbound = nil
 
 	if l.conn != nil {
 		_ = l.conn.Close()
@@ -89,10 +118,13 @@ func (l *lan) close() error {
 }
 
 func (l *lan) send(req *Request, res Response) error {
-	err := l.sendPacket(l.message(req))
+	msg, err := l.message(req)
 	if err != nil {
 		return err
 	}
+	if err := l.sendPacket(msg); err != nil {
+		return err
+	}
 
 	m, err := l.recvMessage()
 	if err != nil {
@@ -110,14 +142,15 @@ func (*lan) Console() error {
 }
 
 func (l *lan) sendPacket(buf []byte) error {
+	l.trace(false, buf)
 	_, err := l.conn.Write(buf)
 	return err
 }
 
-func (l *lan) recvPacket() ([]byte, error) {
+func (l *lan) recvPacket(deadline time.Time) ([]byte, error) {
 	buf := make([]byte, ipmiBufSize)
 
-	err := l.conn.SetReadDeadline(time.Now().Add(l.timeout))
+	err := l.conn.SetReadDeadline(deadline)
 	if err != nil {
 		return nil, err
 	}
@@ -126,31 +159,121 @@ func (l *lan) recvPacket() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	l.trace(true, buf[:n])
 
 	return buf[:n], nil
 }
 
+// recvMessage returns the first response of the session received before
+// the timeout. Responses of another session, failing authentication or
+// outside of the sequence number window are discarded, so spoofed and
+// replayed packets cannot fail a request. If the responses discarded
+// before the timeout were all of another session ErrInvalidSession is
+// returned, if all failed authentication or the sequence number check
+// the timeout wraps ErrAuthCode or the *SequenceError.
 func (l *lan) recvMessage() (*Message, error) {
-	buf, err := l.recvPacket()
-	if err != nil {
-		return nil, err
+	deadline := time.Now().Add(l.timeout)
+	var discarded error
+	mixed := false
+	discard := func(err error) {
+		if discarded != nil && !sameDiscard(discarded, err) {
+			mixed = true
+		}
+		discarded = err
 	}
 
-	header, err := rmcpHeaderFromBytes(buf)
-	if err != nil {
-		return nil, err
+	for {
+		buf, err := l.recvPacket(deadline)
+		if err != nil {
+			if discarded == ErrInvalidSession && !mixed && isTimeout(err) {
+				return nil, discarded
+			}
+			if discarded != nil && !mixed && isTimeout(err) {
+				return nil, &discardedError{discarded}
+			}
+			return nil, err
+		}
+
+		header, err := rmcpHeaderFromBytes(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Class != rmcpClassIPMI {
+			return nil, header.unsupportedClass()
+		}
+
+		m, err := messageFromBytes(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if l.active && m.SessionID != l.SessionID {
+			l.logger().Debug("discarded response of another session", "host", l.Hostname, "id", m.SessionID)
+			discard(ErrInvalidSession)
+			continue
+		}
+
+		if l.inbound != nil {
+			if err := l.verify(m, buf); err != nil {
+				l.logger().Debug("discarded response", "host", l.Hostname, "err", err)
+				discard(err)
+				continue
+			}
+		}
+
+		return m, nil
 	}
+}
+
+// discardedError is a timeout after discarding responses that failed
+// authentication or the sequence number check
+type discardedError struct {
+	err error
+}
+
+func (e *discardedError) Error() string {
+	return "timeout after discarding responses: " + e.err.Error()
+}
 
-	if header.Class != rmcpClassIPMI {
-		return nil, header.unsupportedClass()
+func (e *discardedError) Unwrap() error {
+	return e.err
+}
+
+// Timeout implements net.Error
+func (e *discardedError) Timeout() bool {
+	return true
+}
+
+// Temporary implements net.Error
+func (e *discardedError) Temporary() bool {
+	return true
+}
+
+// sameDiscard reports whether two responses were discarded for the same reason
+func sameDiscard(a, b error) bool {
+	var sa, sb *SequenceError
+	if errors.As(a, &sa) && errors.As(b, &sb) {
+		return true
 	}
+	return a == b
+}
 
-	return messageFromBytes(buf)
+// verify the auth code of a session response before it can move the
+// sequence number window, so spoofed packets are rejected as well as replays
+func (l *lan) verify(m *Message, buf []byte) error {
+	if m.AuthType != l.messageAuthType() {
+		return ErrAuthCode
+	}
+	if err := m.verify(buf, l.authcode); err != nil {
+		return err
+	}
+	return l.inbound.accept(m.Sequence)
 }
 
 func (l *lan) nextSequence() uint32 {
 	if l.Sequence != 0 {
-		l.Sequence++
+		l.Sequence = nextSequence(l.Sequence)
 	}
 	return l.Sequence
 }
@@ -160,7 +283,7 @@ func (l *lan) nextRqSeq() uint8 {
 	return l.rqSeq << 2
 }
 
-func (l *lan) message(r *Request) []byte {
+func (l *lan) message(r *Request) ([]byte, error) {
 	m := &Message{
 		rmcpHeader: &rmcpHeader{
 			Version:            rmcpVersion1,
@@ -180,36 +303,27 @@ func (l *lan) message(r *Request) []byte {
 		},
 	}
 
-	if l.active && l.AuthType != 0 {
+	if authType := l.messageAuthType(); authType != AuthTypeNone {
 		copy(m.AuthCode[:], l.authcode[:])
-		m.AuthType = l.AuthType
+		m.AuthType = authType
 	}
 
-	msg := m.toBytes(r.Data)
-
-	if l.active && l.AuthType == AuthTypeMD5 {
-		hlen := rmcpHeaderSize + ipmiSessionSize
-		// offset is location of ipmiHeader.RsAddr
-		offset := hlen + len(m.AuthCode) + 1
-		// rewrite m.AuthCode field
-		md5 := l.authMD5(msg[offset:])
-		copy(msg[hlen:], md5)
+	msg, err := m.toBytes(r.Data)
+	if err != nil {
+		return nil, err
 	}
+	m.authenticate(msg, l.authcode)
 
-	return msg
+	return msg, nil
 }
 
-// per section 22.17.1
-func (l *lan) authMD5(data []uint8) []uint8 {
-	h := md5.New()
-
-	binaryWrite(h, l.authcode)
-	binaryWrite(h, l.SessionID)
-	binaryWrite(h, data)
-	binaryWrite(h, l.Sequence)
-	binaryWrite(h, l.authcode)
-
-	return h.Sum(nil)
+// messageAuthType returns the AuthType of the next outbound message.
+// The straight password is sent as is, MD2 and MD5 are computed per message.
+func (l *lan) messageAuthType() uint8 {
+	if !l.active || !l.authRequired {
+		return AuthTypeNone
+	}
+	return l.AuthType
 }
 
 func (l *lan) openSession() error {
@@ -250,7 +364,7 @@ func (l *lan) ping() error {
 		return err
 	}
 
-	buf, err := l.recvPacket()
+	buf, err := l.recvPacket(time.Now().Add(l.timeout))
 	if err != nil {
 		return err
 	}
@@ -267,37 +381,78 @@ func (l *lan) ping() error {
 		return err
 	}
 	if !pong.valid() {
-		return errors.New("IPMI not supported")
+		return errNoIPMI
 	}
 
 	return nil
 }
 
-func (l *lan) getAuthCapabilities() error {
+func (l *lan) authCapabilities(channel uint8) (*AuthCapabilitiesResponse, error) {
 	req := &Request{
 		NetworkFunctionApp,
 		CommandGetAuthCapabilities,
 		AuthCapabilitiesRequest{
-			ChannelNumber: 0x0e, // lanChannelE
+			ChannelNumber: channel,
 			PrivLevel:     l.priv,
 		},
 	}
 	res := &AuthCapabilitiesResponse{}
 
 	if err := l.send(req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// capabilities probes the BMC outside of a session, requesting the IPMI v2.0
+// extended capabilities and falling back to a plain IPMI v1.5 request for
+// BMCs that reject the extended bit.
+func (l *lan) capabilities() (*AuthCapabilitiesResponse, error) {
+	res, err := l.authCapabilities(channelExtended | lanChannelE)
+	if _, ok := err.(CompletionCode); ok {
+		return l.authCapabilities(lanChannelE)
+	}
+	return res, err
+}
+
+func (l *lan) getAuthCapabilities() error {
+	res, err := l.authCapabilities(lanChannelE)
+	if err != nil {
 		return err
 	}
 
-	for _, t := range []uint8{AuthTypeMD5, AuthTypePassword, AuthTypeNone} {
-		if (res.AuthTypeSupport & (1 << t)) != 0 {
+	l.authStatus = res.Status
+
+	for _, t := range l.authTypePreference() {
+		if res.AuthTypeSupport&(1<<t) != 0 && supportedAuthType(t) {
 			l.AuthType = t
-			break
+			return nil
 		}
-		log.Printf("BMC did not offer a supported AuthType")
-		return CompletionCode(0xd4)
 	}
 
-	return nil
+	l.logger().Warn("BMC did not offer a supported AuthType", "host", l.Hostname,
+		"supported", fmt.Sprintf("0x%02x", res.AuthTypeSupport))
+	return ErrPrivLevel
+}
+
+// authTypes in order of preference
+var authTypes = []uint8{AuthTypeMD5, AuthTypeMD2, AuthTypePassword, AuthTypeNone}
+
+func supportedAuthType(t uint8) bool {
+	for _, supported := range authTypes {
+		if t == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lan) authTypePreference() []uint8 {
+	if len(l.AuthTypes) != 0 {
+		return l.AuthTypes
+	}
+	return authTypes
 }
 
 func (l *lan) getSessionChallenge() (*SessionChallengeResponse, error) {
@@ -324,6 +479,8 @@ func (l *lan) inSeq() [4]uint8 {
 	if _, err := rand.Read(seq[:]); err != nil {
 		panic(err)
 	}
+	// 0 is reserved for messages outside of a session
+	seq[0] |= 1
 	return seq
 }
 
@@ -339,8 +496,10 @@ func (l *lan) activateSession(sc *SessionChallengeResponse) error {
 		},
 	}
 	res := &ActivateSessionResponse{}
+	inSeq := req.Data.(ActivateSessionRequest).InSeq
 
 	l.active = true
+	l.authRequired = true
 
 	if err := l.send(req, res); err != nil {
 		l.active = false
@@ -350,6 +509,13 @@ func (l *lan) activateSession(sc *SessionChallengeResponse) error {
 	l.SessionID = res.SessionID
 	l.AuthType = res.AuthType
 	l.Sequence = res.InboundSeq
+	l.inbound = newSequenceWindow(seqWindowV15, binary.LittleEndian.Uint32(inSeq[:])-1)
+
+	// per section 22.13, authentication can be disabled after activation
+	if l.authStatus&authStatusPerMessageDisabled != 0 ||
+		(l.authStatus&authStatusUserLevelDisabled != 0 && l.priv <= PrivLevelUser) {
+		l.authRequired = false
+	}
 
 	return nil
 }
@@ -0,0 +1,52 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+// LAN Configuration Parameters per section 23.2
+const (
+	LANParamIPAddress      = 0x03
+	LANParamIPSource       = 0x04
+	LANParamMACAddress     = 0x05
+	LANParamSubnetMask     = 0x06
+	LANParamDefaultGateway = 0x0c
+	LANParamVLANID         = 0x14
+)
+
+// LAN IP address sources per section 23.2
+const (
+	LANIPSourceStatic = 0x01
+	LANIPSourceDHCP   = 0x02
+)
+
+// lanConfigRevisionOnly in the ChannelNumber field requests the
+// parameter revision without the parameter data
+const lanConfigRevisionOnly = 0x80
+
+// LANConfigRequest per section 23.2
+type LANConfigRequest struct {
+	ChannelNumber uint8
+	Param         uint8
+	SetSelector   uint8
+	BlockSelector uint8
+}
+
+// LANConfigResponse per section 23.2
+type LANConfigResponse struct {
+	CompletionCode
+	Revision uint8
+	Data     []uint8
+}
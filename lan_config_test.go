@@ -0,0 +1,34 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLANConfig(t *testing.T) {
+	req := &LANConfigRequest{ChannelNumber: lanChannelE, Param: LANParamIPAddress}
+	assert.Equal(t, []byte{lanChannelE, LANParamIPAddress, 0, 0}, mustBytes(messageDataToBytes(req)))
+
+	res := &LANConfigResponse{}
+	err := messageDataFromBytes([]byte{0x00, 0x11, 192, 168, 1, 10}, res)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0x11), res.Revision)
+	assert.Equal(t, []byte{192, 168, 1, 10}, res.Data)
+}
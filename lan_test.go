@@ -17,14 +17,20 @@ limitations under the License.
 package ipmi
 
 import (
+	"bytes"
+	"crypto/md5"
+	"errors"
 	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestLAN(t *testing.T) {
 	s := NewSimulator(net.UDPAddr{Port: 0})
+	s.SetPassword("vmware", "cow")
 	err := s.Run()
 	assert.NoError(t, err)
 
@@ -62,3 +68,232 @@ func TestLAN(t *testing.T) {
 	assert.NoError(t, err)
 	s.Stop()
 }
+
+func TestLANOptions(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{Port: 0})
+	s.SetPassword("monitor", "")
+	err := s.Run()
+	assert.NoError(t, err)
+
+	var priv atomic.Uint32
+	s.SetHandler(NetworkFunctionApp, CommandSetSessionPrivilegeLevel, func(m *Message) Response {
+		priv.Store(uint32(m.Data[0]))
+		return &SessionPrivilegeLevelResponse{NewPrivilegeLevel: m.Data[0]}
+	})
+
+	tests := []struct {
+		should    string
+		privilege uint8
+		authTypes []uint8
+		expect    uint8
+		err       error
+	}{
+		{"should default to admin and MD5", 0, nil, AuthTypeMD5, nil},
+		{"should request user privilege", PrivLevelUser, nil, AuthTypeMD5, nil},
+		{"should prefer password", PrivLevelOperator, []uint8{AuthTypePassword, AuthTypeMD5}, AuthTypePassword, nil},
+		{"should prefer none", PrivLevelUser, []uint8{AuthTypeNone, AuthTypeMD5}, AuthTypeNone, nil},
+		{"should skip unsupported types", PrivLevelUser, []uint8{AuthTypeOEM, AuthTypeMD2}, AuthTypeMD2, nil},
+		{"should fail without a common auth type", 0, []uint8{AuthTypeOEM}, 0, ErrPrivLevel},
+	}
+
+	for _, test := range tests {
+		c := s.NewConnection()
+		c.Username = "monitor"
+		c.Privilege = test.privilege
+		c.AuthTypes = test.authTypes
+
+		l := newLanTransport(c).(*lan)
+		err = l.open()
+		assert.Equal(t, test.err, err, test.should)
+		if err == nil {
+			expect := test.privilege
+			if expect == 0 {
+				expect = PrivLevelAdmin
+			}
+			assert.Equal(t, uint32(expect), priv.Load(), test.should)
+			assert.Equal(t, test.expect, l.AuthType, test.should)
+
+			err = l.send(&Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}, &DeviceIDResponse{})
+			assert.NoError(t, err, test.should)
+		}
+		_ = l.close()
+	}
+
+	s.Stop()
+}
+
+func TestLANAuthCode(t *testing.T) {
+	c := &Connection{Password: "cow"}
+	l := newLanTransport(c).(*lan)
+	l.active = true
+	l.authRequired = true
+	l.SessionID = 0x01020304
+	l.Sequence = 0x10
+
+	req := &Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}
+
+	for _, authType := range []uint8{AuthTypeMD2, AuthTypeMD5} {
+		l.AuthType = authType
+		m, err := messageFromBytes(mustBytes(l.message(req)))
+		assert.NoError(t, err)
+		assert.Equal(t, authType, m.AuthType)
+
+		// per section 22.17.1
+		h := newMD2()
+		if authType == AuthTypeMD5 {
+			h = md5.New()
+		}
+		data := []byte{0x20, 0x18, 0xc8, 0x81, m.RqSeq, 0x01, -(0x81 + m.RqSeq + 0x01)}
+		binaryWrite(h, l.authcode)
+		binaryWrite(h, l.SessionID)
+		binaryWrite(h, data)
+		binaryWrite(h, m.Sequence)
+		binaryWrite(h, l.authcode)
+		assert.Equal(t, h.Sum(nil), m.AuthCode[:])
+	}
+
+	l.AuthType = AuthTypePassword
+	m, err := messageFromBytes(mustBytes(l.message(req)))
+	assert.NoError(t, err)
+	assert.Equal(t, "cow", string(bytes.TrimRight(m.AuthCode[:], "\000")))
+
+	l.authRequired = false
+	m, err = messageFromBytes(mustBytes(l.message(req)))
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(AuthTypeNone), m.AuthType)
+}
+
+func TestLANAuthStatus(t *testing.T) {
+	tests := []struct {
+		should    string
+		status    uint8
+		privilege uint8
+		expect    uint8
+	}{
+		{"should authenticate every message", 0, PrivLevelAdmin, AuthTypeMD2},
+		{"should not authenticate with per-message auth disabled", authStatusPerMessageDisabled, PrivLevelAdmin, AuthTypeNone},
+		{"should authenticate admin with user level auth disabled", authStatusUserLevelDisabled, PrivLevelAdmin, AuthTypeMD2},
+		{"should not authenticate user with user level auth disabled", authStatusUserLevelDisabled, PrivLevelUser, AuthTypeNone},
+	}
+
+	for _, test := range tests {
+		s := NewSimulator(net.UDPAddr{Port: 0})
+		s.authStatus = test.status
+		err := s.Run()
+		assert.NoError(t, err)
+
+		status := test.status
+		s.SetHandler(NetworkFunctionApp, CommandGetAuthCapabilities, func(*Message) Response {
+			return &AuthCapabilitiesResponse{
+				AuthTypeSupport: 1 << AuthTypeMD2,
+				Status:          status,
+			}
+		})
+
+		var authType atomic.Uint32
+		s.SetHandler(NetworkFunctionApp, CommandGetDeviceID, func(m *Message) Response {
+			authType.Store(uint32(m.AuthType))
+			return &DeviceIDResponse{}
+		})
+
+		c := s.NewConnection()
+		c.Privilege = test.privilege
+		l := newLanTransport(c).(*lan)
+		err = l.open()
+		assert.NoError(t, err, test.should)
+		assert.Equal(t, uint8(AuthTypeMD2), l.AuthType, test.should)
+
+		err = l.send(&Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}, &DeviceIDResponse{})
+		assert.NoError(t, err, test.should)
+		assert.Equal(t, uint32(test.expect), authType.Load(), test.should)
+		_ = l.close()
+		s.Stop()
+	}
+}
+
+func TestLANVerify(t *testing.T) {
+	c := &Connection{Password: "cow"}
+	l := newLanTransport(c).(*lan)
+	l.active = true
+	l.authRequired = true
+	l.AuthType = AuthTypeMD5
+	l.SessionID = 42
+	l.inbound = newSequenceWindow(seqWindowV15, 9)
+
+	response := func(seq uint32, authType uint8) (*Message, []byte) {
+		m := &Message{
+			rmcpHeader:  &rmcpHeader{Version: rmcpVersion1, Class: rmcpClassIPMI},
+			ipmiSession: &ipmiSession{AuthType: authType, Sequence: seq, SessionID: l.SessionID},
+			AuthCode:    l.authcode,
+			ipmiHeader:  &ipmiHeader{RsAddr: 0x81, Command: CommandGetDeviceID},
+		}
+		buf := mustBytes(m.toBytes(CommandCompleted))
+		m.authenticate(buf, l.authcode)
+		m, err := messageFromBytes(buf)
+		assert.NoError(t, err)
+		return m, buf
+	}
+
+	m, buf := response(10, AuthTypeMD5)
+	assert.NoError(t, l.verify(m, buf))
+
+	// replayed response
+	err := l.verify(m, buf)
+	assert.IsType(t, &SequenceError{}, err)
+
+	// spoofed response must not move the window
+	m, buf = response(11, AuthTypeMD5)
+	m.SessionID = 0
+	assert.Equal(t, ErrAuthCode, l.verify(m, buf))
+	m, buf = response(11, AuthTypeNone)
+	assert.Equal(t, ErrAuthCode, l.verify(m, buf))
+
+	m, buf = response(11, AuthTypeMD5)
+	assert.NoError(t, l.verify(m, buf))
+}
+
+func TestLANDiscard(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	c.Timeout = 100 * time.Millisecond
+	l := newLanTransport(c).(*lan)
+	err = l.open()
+	assert.NoError(t, err)
+
+	req := &Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}
+
+	// the duplicate is read first by the next request, as a replay
+	s.SetFault(NetworkFunctionApp, CommandGetDeviceID, Fault{Duplicate: 1})
+	err = l.send(req, &DeviceIDResponse{})
+	assert.NoError(t, err)
+	s.ClearFaults()
+	err = l.send(req, &DeviceIDResponse{})
+	assert.NoError(t, err)
+
+	// a replay alone is reported once the timeout passes
+	s.SetFault(NetworkFunctionApp, CommandGetDeviceID, Fault{Duplicate: 1})
+	err = l.send(req, &DeviceIDResponse{})
+	assert.NoError(t, err)
+	s.SetFault(NetworkFunctionApp, CommandGetDeviceID, Fault{Drop: 1})
+	err = l.send(req, &DeviceIDResponse{})
+	var serr *SequenceError
+	if assert.True(t, errors.As(err, &serr), "%v", err) {
+		assert.True(t, serr.Replay)
+	}
+	assert.True(t, isTimeout(err))
+	s.ClearFaults()
+
+	// responses of another session are discarded until the timeout
+	s.SetHandler(NetworkFunctionApp, CommandGetDeviceID, func(m *Message) Response {
+		m.SessionID = 0
+		return &DeviceIDResponse{}
+	})
+	err = l.send(req, &DeviceIDResponse{})
+	assert.Equal(t, ErrInvalidSession, err)
+
+	_ = l.close()
+	s.Stop()
+}
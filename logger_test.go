@@ -0,0 +1,56 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	var simlog, lanlog bytes.Buffer
+	s := NewSimulator(net.UDPAddr{})
+	s.SetLogger(slog.New(slog.NewTextHandler(&simlog, nil)))
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	c.AuthTypes = []uint8{AuthTypeOEM}
+	c.Logger = slog.New(slog.NewTextHandler(&lanlog, nil))
+
+	l := newLanTransport(c).(*lan)
+	err = l.open()
+	assert.Equal(t, ErrPrivLevel, err)
+	assert.Contains(t, lanlog.String(), `msg="BMC did not offer a supported AuthType"`)
+	assert.Contains(t, lanlog.String(), "supported=0x17")
+
+	// an invalid RMCP class
+	_, err = l.conn.Write([]byte{rmcpVersion1, 0, 0xff, 0x09})
+	assert.NoError(t, err)
+	// the simulator has logged the invalid request once it answers the ping
+	err = l.ping()
+	assert.NoError(t, err)
+	_ = l.close()
+
+	s.Stop()
+	assert.Contains(t, simlog.String(), `msg="invalid RMCP request"`)
+	assert.Contains(t, simlog.String(), "unsupported RMCP class: 9")
+}
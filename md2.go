@@ -0,0 +1,119 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import "hash"
+
+// MD2 message digest per RFC 1319, as used by the IPMI v1.5 MD2 auth type.
+// Not provided by the standard library, since MD2 is long obsolete.
+
+const md2BlockSize = 16
+
+// md2S is the RFC 1319 permutation of 0..255 constructed from the digits of pi
+var md2S = [256]uint8{
+	41, 46, 67, 201, 162, 216, 124, 1, 61, 54, 84, 161, 236, 240, 6, 19,
+	98, 167, 5, 243, 192, 199, 115, 140, 152, 147, 43, 217, 188, 76, 130, 202,
+	30, 155, 87, 60, 253, 212, 224, 22, 103, 66, 111, 24, 138, 23, 229, 18,
+	190, 78, 196, 214, 218, 158, 222, 73, 160, 251, 245, 142, 187, 47, 238, 122,
+	169, 104, 121, 145, 21, 178, 7, 63, 148, 194, 16, 137, 11, 34, 95, 33,
+	128, 127, 93, 154, 90, 144, 50, 39, 53, 62, 204, 231, 191, 247, 151, 3,
+	255, 25, 48, 179, 72, 165, 181, 209, 215, 94, 146, 42, 172, 86, 170, 198,
+	79, 184, 56, 210, 150, 164, 125, 182, 118, 252, 107, 226, 156, 116, 4, 241,
+	69, 157, 112, 89, 100, 113, 135, 32, 134, 91, 207, 101, 230, 45, 168, 2,
+	27, 96, 37, 173, 174, 176, 185, 246, 28, 70, 97, 105, 52, 64, 126, 15,
+	85, 71, 163, 35, 221, 81, 175, 58, 195, 92, 249, 206, 186, 197, 234, 38,
+	44, 83, 13, 110, 133, 40, 132, 9, 211, 223, 205, 244, 65, 129, 77, 82,
+	106, 220, 55, 200, 108, 193, 171, 250, 36, 225, 123, 8, 12, 189, 177, 74,
+	120, 136, 149, 139, 227, 99, 232, 109, 233, 203, 213, 254, 59, 0, 29, 57,
+	242, 239, 183, 14, 102, 88, 208, 228, 166, 119, 114, 248, 235, 117, 75, 10,
+	49, 68, 80, 180, 143, 237, 31, 26, 219, 153, 141, 51, 159, 17, 131, 20,
+}
+
+type md2 struct {
+	x   [48]uint8
+	c   [md2BlockSize]uint8
+	buf [md2BlockSize]uint8
+	n   int
+}
+
+func newMD2() hash.Hash {
+	return &md2{}
+}
+
+func (d *md2) Reset() {
+	*d = md2{}
+}
+
+func (d *md2) Size() int {
+	return md2BlockSize
+}
+
+func (d *md2) BlockSize() int {
+	return md2BlockSize
+}
+
+func (d *md2) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		c := copy(d.buf[d.n:], p)
+		d.n += c
+		p = p[c:]
+		if d.n == md2BlockSize {
+			d.block(d.buf[:])
+			d.n = 0
+		}
+	}
+	return n, nil
+}
+
+func (d *md2) Sum(in []byte) []byte {
+	// operate on a copy, so the caller can keep writing
+	s := *d
+
+	pad := md2BlockSize - s.n
+	for i := s.n; i < md2BlockSize; i++ {
+		s.buf[i] = uint8(pad)
+	}
+	s.block(s.buf[:])
+
+	c := s.c
+	s.block(c[:])
+
+	return append(in, s.x[:md2BlockSize]...)
+}
+
+func (d *md2) block(m []uint8) {
+	l := d.c[md2BlockSize-1]
+	for j := 0; j < md2BlockSize; j++ {
+		d.c[j] ^= md2S[m[j]^l]
+		l = d.c[j]
+	}
+
+	for j := 0; j < md2BlockSize; j++ {
+		d.x[16+j] = m[j]
+		d.x[32+j] = d.x[16+j] ^ d.x[j]
+	}
+
+	var t uint8
+	for j := 0; j < 18; j++ {
+		for k := 0; k < 48; k++ {
+			d.x[k] ^= md2S[t]
+			t = d.x[k]
+		}
+		t += uint8(j)
+	}
+}
@@ -20,7 +20,8 @@ import (
 	"bytes"
 	"encoding"
 	"encoding/binary"
-
+	"errors"
+	"fmt"
 	"io"
 )
 
@@ -45,8 +46,11 @@ type NetworkFunction uint8
 
 // Network Function Codes per section 5.1
 var (
-	NetworkFunctionChassis = NetworkFunction(0x00)
-	NetworkFunctionApp     = NetworkFunction(0x06)
+	NetworkFunctionChassis     = NetworkFunction(0x00)
+	NetworkFunctionSensorEvent = NetworkFunction(0x04)
+	NetworkFunctionApp         = NetworkFunction(0x06)
+	NetworkFunctionStorage     = NetworkFunction(0x0a)
+	NetworkFunctionTransport   = NetworkFunction(0x0c)
 )
 
 var (
@@ -72,6 +76,9 @@ func (m *Message) NetFn() NetworkFunction {
 
 // CompletionCode of an IPMI command response
 func (m *Message) CompletionCode() CompletionCode {
+	if len(m.Data) == 0 {
+		return ErrUnspecified
+	}
 	return CompletionCode(m.Data[0])
 }
 
@@ -79,10 +86,11 @@ func (m *Message) CompletionCode() CompletionCode {
 // Unmarshal errors are returned as a Response such that they can be
 // propagated to the client.
 func (m *Message) Request(data interface{}) Response {
-	err := messageDataFromBytes(m.Data, data)
+	err := requestDataFromBytes(m.Data, data)
 	if err != nil {
-		if e, ok := err.(CompletionCode); ok {
-			return e
+		var cc CompletionCode
+		if errors.As(err, &cc) {
+			return cc
 		}
 		return ErrUnspecified
 	}
@@ -92,16 +100,44 @@ func (m *Message) Request(data interface{}) Response {
 // Response specific to the request IPMI command
 func (m *Message) Response(data Response) error {
 	if m.CompletionCode() != CommandCompleted {
+		errorData(m.Data, data)
 		return m.CompletionCode()
 	}
 	return messageDataFromBytes(m.Data, data)
 }
 
+// errorData keeps the data of a response with a completion code other
+// than CommandCompleted in a rawResponse, as some OEM commands return
+// data along with an error. Other Response types do not describe it.
+func errorData(buf []byte, data Response) {
+	raw, ok := data.(*rawResponse)
+	if !ok || len(buf) == 0 {
+		return
+	}
+	raw.CompletionCode = CompletionCode(buf[0])
+	if len(buf) > 1 {
+		raw.Data = append([]byte(nil), buf[1:]...)
+	}
+}
+
 func messageDataFromBytes(buf []byte, data interface{}) error {
 	if decoder, ok := data.(encoding.BinaryUnmarshaler); ok {
 		return decoder.UnmarshalBinary(buf)
 	}
-	return binary.Read(bytes.NewBuffer(buf), binary.LittleEndian, data)
+	return Unmarshal(buf, data)
+}
+
+// requestDataFromBytes decodes request data, which unlike response data
+// fails with ErrLongPacket if it has bytes beyond the request fields
+func requestDataFromBytes(buf []byte, data interface{}) error {
+	if decoder, ok := data.(encoding.BinaryUnmarshaler); ok {
+		return decoder.UnmarshalBinary(buf)
+	}
+	n, err := unmarshal(buf, data)
+	if err == nil && n < len(buf) {
+		return ErrLongPacket
+	}
+	return err
 }
 
 func messageFromBytes(buf []byte) (*Message, error) {
@@ -115,33 +151,39 @@ func messageFromBytes(buf []byte) (*Message, error) {
 		ipmiHeader:  &ipmiHeader{},
 	}
 	reader := bytes.NewReader(buf)
+	read := func(data interface{}) error {
+		if err := binary.Read(reader, binary.LittleEndian, data); err != nil {
+			return ErrShortPacket
+		}
+		return nil
+	}
 
-	if err := binary.Read(reader, binary.LittleEndian, m.rmcpHeader); err != nil {
+	if err := read(m.rmcpHeader); err != nil {
 		return nil, err
 	}
-	if err := binary.Read(reader, binary.LittleEndian, m.ipmiSession); err != nil {
+	if err := read(m.ipmiSession); err != nil {
 		return nil, err
 	}
 	if m.AuthType != 0 {
-		if err := binary.Read(reader, binary.LittleEndian, &m.AuthCode); err != nil {
+		if err := read(&m.AuthCode); err != nil {
 			return nil, err
 		}
 	}
-	if err := binary.Read(reader, binary.LittleEndian, m.ipmiHeader); err != nil {
+	if err := read(m.ipmiHeader); err != nil {
 		return nil, err
 	}
 	if m.headerChecksum() != m.Checksum {
 		return nil, ErrInvalidPacket
 	}
 
-	if m.MsgLen <= 0 {
+	// MsgLen includes the header after the first checksum and the second checksum
+	if int(m.MsgLen) < ipmiHeaderSize {
 		return nil, ErrInvalidPacket
 	}
 	dataLen := int(m.MsgLen) - ipmiHeaderSize
 	data := make([]byte, dataLen+1)
-	_, err := reader.Read(data)
-	if err != nil {
-		return nil, err
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, ErrShortPacket
 	}
 	m.Data = data[:dataLen]
 	if m.payloadChecksum(m.Data) != data[dataLen] {
@@ -151,21 +193,32 @@ func messageFromBytes(buf []byte) (*Message, error) {
 	return m, nil
 }
 
-func messageDataToBytes(data interface{}) []byte {
+// messageDataToBytes encodes request or response data, failing with
+// ErrLongPacket if a field is too long for its encoding and ErrInvalidPacket
+// for any other encoding error
+func messageDataToBytes(data interface{}) ([]byte, error) {
+	var buf []byte
+	var err error
 	if encoder, ok := data.(encoding.BinaryMarshaler); ok {
-		buf, err := encoder.MarshalBinary()
-		if err != nil {
-			panic(err)
-		}
-		return buf
+		buf, err = encoder.MarshalBinary()
+	} else {
+		buf, err = Marshal(data)
+	}
+	switch {
+	case err == nil:
+		return buf, nil
+	case errors.Is(err, ErrLongPacket):
+		return nil, ErrLongPacket
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPacket, err)
 	}
-	buf := new(bytes.Buffer)
-	binaryWrite(buf, data)
-	return buf.Bytes()
 }
 
-func (m *Message) toBytes(data interface{}) []byte {
-	dbuf := messageDataToBytes(data)
+func (m *Message) toBytes(data interface{}) ([]byte, error) {
+	dbuf, err := messageDataToBytes(data)
+	if err != nil {
+		return nil, err
+	}
 	buf := new(bytes.Buffer)
 
 	binaryWrite(buf, m.rmcpHeader)
@@ -182,7 +235,7 @@ func (m *Message) toBytes(data interface{}) []byte {
 	_, _ = buf.Write(dbuf)
 	binaryWrite(buf, m.payloadChecksum(buf.Bytes()[dlen:]))
 
-	return buf.Bytes()
+	return buf.Bytes(), nil
 }
 
 func (m *Message) headerChecksum() uint8 {
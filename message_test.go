@@ -34,6 +34,26 @@ func TestMessageFromBytes(t *testing.T) {
 	_, err = messageFromBytes(buf)
 	assert.Error(t, err)
 	assert.Equal(t, ErrInvalidPacket, err)
+
+	m := &Message{
+		rmcpHeader:  &rmcpHeader{},
+		ipmiSession: &ipmiSession{},
+		ipmiHeader:  &ipmiHeader{},
+	}
+	buf = mustBytes(m.toBytes(&DeviceIDResponse{}))
+
+	// data length beyond the packet
+	_, err = messageFromBytes(buf[:len(buf)-1])
+	assert.Equal(t, ErrShortPacket, err)
+
+	// message length shorter than the header
+	buf[rmcpHeaderSize+ipmiSessionSize] = 3
+	_, err = messageFromBytes(buf)
+	assert.Equal(t, ErrInvalidPacket, err)
+
+	m.Data = nil
+	assert.Equal(t, ErrUnspecified, m.CompletionCode())
+	assert.Equal(t, ErrUnspecified, m.Response(&DeviceIDResponse{}))
 }
 
 func TestChecksum(t *testing.T) {
@@ -79,9 +99,17 @@ func (m *testVariableSizeData) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
+// mustBytes returns the encoding of valid test messages
+func mustBytes(buf []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+
 func TestDataMarshalFixed(t *testing.T) {
 	msgIn := &testFixedSizeData{1, 2, 3}
-	buf := messageDataToBytes(msgIn)
+	buf := mustBytes(messageDataToBytes(msgIn))
 	msgOut := &testFixedSizeData{}
 	err := messageDataFromBytes(buf, msgOut)
 	assert.NoError(t, err)
@@ -91,10 +119,37 @@ func TestDataMarshalFixed(t *testing.T) {
 func TestDataMarshalVariable(t *testing.T) {
 	data := []byte{4, 5, 6}
 	msgIn := &testVariableSizeData{testFixedSizeData{1, 2, 3}, data}
-	buf := messageDataToBytes(msgIn)
+	buf := mustBytes(messageDataToBytes(msgIn))
 	assert.Equal(t, binary.Size(msgIn.testFixedSizeData)+len(data), len(buf))
 	msgOut := &testVariableSizeData{}
 	err := messageDataFromBytes(buf, msgOut)
 	assert.NoError(t, err)
 	assert.Equal(t, msgIn, msgOut)
 }
+
+func FuzzMessageFromBytes(f *testing.F) {
+	m := &Message{
+		rmcpHeader:  &rmcpHeader{Version: rmcpVersion1, Class: rmcpClassIPMI, RMCPSequenceNumber: 0xff},
+		ipmiSession: &ipmiSession{},
+		ipmiHeader:  &ipmiHeader{RsAddr: 0x20, NetFnRsLUN: uint8(NetworkFunctionApp) << 2, Command: CommandGetDeviceID},
+	}
+	f.Add(mustBytes(m.toBytes(&DeviceIDRequest{})))
+	m.AuthType = AuthTypeMD5
+	m.SessionID = 0x01020304
+	buf := mustBytes(m.toBytes(&DeviceIDResponse{}))
+	m.authenticate(buf, [16]uint8{'p'})
+	f.Add(buf)
+	f.Add(make([]byte, rmcpHeaderSize+ipmiSessionSize+ipmiHeaderSize))
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		m, err := messageFromBytes(buf)
+		if err != nil {
+			return
+		}
+		_ = m.NetFn()
+		_ = m.CompletionCode()
+		_ = m.verify(buf, [16]uint8{'p'})
+		_ = m.Response(&DeviceIDResponse{})
+		_ = m.Request(&SessionChallengeRequest{})
+	})
+}
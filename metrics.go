@@ -0,0 +1,75 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"errors"
+	"time"
+)
+
+// Metrics observes the requests sent by a Client
+type Metrics interface {
+	ObserveRequest(*RequestStats)
+}
+
+// RequestStats describes the outcome of a single Client request
+type RequestStats struct {
+	// Host is the Connection Hostname of the BMC
+	Host string
+	NetworkFunction
+	Command
+	// Latency includes the time spent re-establishing the session for retries
+	Latency time.Duration
+	// Retries is the number of times the request was sent again
+	Retries int
+	// Timeout is true if no response was received
+	Timeout bool
+	// CompletionCode of the response, ErrUnspecified if Err is not a CompletionCode
+	CompletionCode
+	// Err is the error returned to the caller
+	Err error
+}
+
+func newRequestStats(c *Connection, req *Request, res Response, start time.Time, retries int, err error) *RequestStats {
+	stats := &RequestStats{
+		Host:            c.Hostname,
+		NetworkFunction: req.NetworkFunction,
+		Command:         req.Command,
+		Latency:         time.Since(start),
+		Retries:         retries,
+		Timeout:         isTimeout(err),
+		Err:             err,
+	}
+
+	var cc CompletionCode
+	switch {
+	case err == nil:
+		stats.CompletionCode = CompletionCode(res.Code())
+	case errors.As(err, &cc):
+		stats.CompletionCode = cc
+	default:
+		stats.CompletionCode = ErrUnspecified
+	}
+
+	return stats
+}
+
+// isTimeout returns true for network, ipmitool and device timeouts
+func isTimeout(err error) bool {
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
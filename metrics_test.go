@@ -0,0 +1,122 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMetrics struct {
+	requests []*RequestStats
+}
+
+func (m *testMetrics) ObserveRequest(stats *RequestStats) {
+	m.requests = append(m.requests, stats)
+}
+
+func TestMetrics(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	metrics := &testMetrics{}
+	c := s.NewConnection()
+	c.Timeout = 100 * time.Millisecond
+	c.Metrics = metrics
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	_, err = client.DeviceID()
+	assert.NoError(t, err)
+
+	_, _, err = client.Raw(NetworkFunction(0x30), 0x01, nil)
+	assert.NoError(t, err)
+
+	// the session is re-established and the request retried
+	s.SetHandler(NetworkFunctionApp, CommandGetDeviceID, func(m *Message) Response {
+		s.SetHandler(NetworkFunctionApp, CommandGetDeviceID, s.deviceID)
+		m.SessionID++
+		return &DeviceIDResponse{}
+	})
+	_, err = client.DeviceID()
+	assert.NoError(t, err)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+
+	assert.Equal(t, 3, len(metrics.requests))
+	for _, stats := range metrics.requests {
+		assert.Equal(t, c.Hostname, stats.Host)
+		assert.True(t, stats.Latency > 0)
+		assert.False(t, stats.Timeout)
+	}
+
+	stats := metrics.requests[0]
+	assert.Equal(t, NetworkFunctionApp, stats.NetworkFunction)
+	assert.Equal(t, CommandGetDeviceID, stats.Command)
+	assert.Equal(t, CommandCompleted, stats.CompletionCode)
+	assert.Equal(t, 0, stats.Retries)
+	assert.NoError(t, stats.Err)
+
+	stats = metrics.requests[1]
+	assert.Equal(t, NetworkFunction(0x30), stats.NetworkFunction)
+	assert.Equal(t, ErrInvalidCommand, stats.CompletionCode)
+	assert.Equal(t, ErrInvalidCommand, stats.Err)
+
+	stats = metrics.requests[2]
+	assert.Equal(t, 1, stats.Retries)
+	assert.NoError(t, stats.Err)
+}
+
+type testTimeoutError struct{}
+
+func (testTimeoutError) Error() string { return "i/o timeout" }
+func (testTimeoutError) Timeout() bool { return true }
+
+func TestRequestStats(t *testing.T) {
+	req := &Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}
+
+	tests := []struct {
+		err     error
+		cc      CompletionCode
+		timeout bool
+	}{
+		{nil, CommandCompleted, false},
+		{ErrNodeBusy, ErrNodeBusy, false},
+		{&ToolError{Err: ErrInvalidCommand}, ErrInvalidCommand, false},
+		{&ToolError{Err: ErrTimeout}, ErrUnspecified, true},
+		{syscall.ETIMEDOUT, ErrUnspecified, true},
+		{fmt.Errorf("read: %w", testTimeoutError{}), ErrUnspecified, true},
+		{errors.New("connection refused"), ErrUnspecified, false},
+	}
+
+	for _, test := range tests {
+		stats := newRequestStats(&Connection{Hostname: "bmc"}, req, &DeviceIDResponse{}, time.Now(), 0, test.err)
+		assert.Equal(t, test.cc, stats.CompletionCode, "%v", test.err)
+		assert.Equal(t, test.timeout, stats.Timeout, "%v", test.err)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Default device paths of the OpenIPMI ipmi_devintf driver, as searched by ipmitool
+var openIPMIDevices = []string{"/dev/ipmi0", "/dev/ipmi/0", "/dev/ipmidev/0"}
+
+// ipmiDevice is the kernel driver interface used by the open transport.
+// Messages are addressed to the BMC over the system interface.
+type ipmiDevice interface {
+	send(msgid int64, netfn NetworkFunction, cmd Command, lun uint8, data []byte) error
+	// recv returns the response with the completion code as the first byte of data
+	recv(timeout time.Duration) (int64, []byte, error)
+	close() error
+}
+
+// openIPMI is the in-band transport via the OpenIPMI driver
+type openIPMI struct {
+	*Connection
+	dev     ipmiDevice
+	msgid   int64
+	lun     uint8
+	timeout time.Duration
+	// openDevice is replaced for testing
+	openDevice func(path string) (ipmiDevice, error)
+}
+
+func newOpenTransport(c *Connection) transport {
+	return &openIPMI{
+		Connection: c,
+		openDevice: openIPMIDevice,
+	}
+}
+
+func (o *openIPMI) open() error {
+	paths := openIPMIDevices
+	if o.Path != "" {
+		paths = []string{o.Path}
+	}
+
+	var err error
+	for _, path := range paths {
+		o.dev, err = o.openDevice(path)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	o.lun = o.LUN & 3
+	o.timeout = o.Connection.timeout()
+
+	return nil
+}
+
+func (o *openIPMI) close() error {
+	if o.dev == nil {
+		return nil
+	}
+	err := o.dev.close()
+	o.dev = nil
+	return err
+}
+
+func (o *openIPMI) send(req *Request, res Response) error {
+	if o.dev == nil {
+		return errors.New("open: device is not open")
+	}
+
+	data, err := messageDataToBytes(req.Data)
+	if err != nil {
+		return err
+	}
+
+	o.msgid++
+	msgid := o.msgid
+
+	err = o.dev.send(msgid, req.NetworkFunction, req.Command, o.lun, data)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(o.timeout)
+	for {
+		id, data, err := o.dev.recv(time.Until(deadline))
+		if err != nil {
+			return err
+		}
+		// discard late responses to requests that already timed out
+		if id != msgid {
+			continue
+		}
+		if len(data) == 0 {
+			return ErrShortPacket
+		}
+		if cc := CompletionCode(data[0]); cc != CommandCompleted {
+			errorData(data, res)
+			return cc
+		}
+		return messageDataFromBytes(data, res)
+	}
+}
+
+func (*openIPMI) Console() error {
+	fmt.Println("Console not supported. Press Enter to continue.")
+	r := make([]byte, 1)
+	_, err := os.Stdin.Read(r)
+	return err
+}
@@ -0,0 +1,190 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// per linux/ipmi.h
+const (
+	ipmiMaxMsgLength            = 272
+	ipmiSystemInterfaceAddrType = 0x0c
+	ipmiBMCChannel              = 0x0f
+	ipmiIOCMagic                = 'i'
+)
+
+type ipmiSystemInterfaceAddr struct {
+	addrType int32
+	channel  int16
+	lun      uint8
+}
+
+type ipmiMsg struct {
+	netfn   uint8
+	cmd     uint8
+	dataLen uint16
+	data    *byte
+}
+
+type ipmiReq struct {
+	addr    *byte
+	addrLen uint32
+	msgid   int
+	msg     ipmiMsg
+}
+
+type ipmiRecv struct {
+	recvType int32
+	addr     *byte
+	addrLen  uint32
+	msgid    int
+	msg      ipmiMsg
+}
+
+// ioctl request numbers depend on the platform struct sizes
+var (
+	ipmictlReceiveMsgTrunc = ioc(3, 11, unsafe.Sizeof(ipmiRecv{}))
+	ipmictlSendCommand     = ioc(2, 13, unsafe.Sizeof(ipmiReq{}))
+)
+
+// ioc encodes an ioctl request number per asm-generic/ioctl.h
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | ipmiIOCMagic<<8 | nr
+}
+
+// ipmiDevintf waits for responses with the runtime poller, so the
+// device is never accessed with f.Fd(), which makes it blocking
+type ipmiDevintf struct {
+	f  *os.File
+	rc syscall.RawConn
+}
+
+func openIPMIDevice(path string) (ipmiDevice, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &ipmiDevintf{f, rc}, nil
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+		switch errno {
+		case 0:
+			return nil
+		case syscall.EINTR:
+			continue
+		default:
+			return errno
+		}
+	}
+}
+
+func (d *ipmiDevintf) ioctl(req uintptr, arg unsafe.Pointer) error {
+	var ierr error
+	err := d.rc.Control(func(fd uintptr) {
+		ierr = ioctl(fd, req, arg)
+	})
+	if err != nil {
+		return err
+	}
+	return ierr
+}
+
+func (d *ipmiDevintf) send(msgid int64, netfn NetworkFunction, cmd Command, lun uint8, data []byte) error {
+	if len(data) > ipmiMaxMsgLength {
+		return ErrLongPacket
+	}
+
+	addr := &ipmiSystemInterfaceAddr{
+		addrType: ipmiSystemInterfaceAddrType,
+		channel:  ipmiBMCChannel,
+		lun:      lun,
+	}
+
+	buf := make([]byte, ipmiMaxMsgLength)
+	copy(buf, data)
+
+	req := &ipmiReq{
+		addr:    (*byte)(unsafe.Pointer(addr)),
+		addrLen: uint32(unsafe.Sizeof(*addr)),
+		msgid:   int(msgid),
+		msg: ipmiMsg{
+			netfn:   uint8(netfn),
+			cmd:     uint8(cmd),
+			dataLen: uint16(len(data)),
+			data:    &buf[0],
+		},
+	}
+
+	return d.ioctl(ipmictlSendCommand, unsafe.Pointer(req))
+}
+
+func (d *ipmiDevintf) recv(timeout time.Duration) (int64, []byte, error) {
+	if timeout <= 0 {
+		return 0, nil, syscall.ETIMEDOUT
+	}
+	if err := d.f.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, nil, err
+	}
+
+	addr := &ipmiSystemInterfaceAddr{}
+	buf := make([]byte, ipmiMaxMsgLength)
+
+	res := &ipmiRecv{
+		addr:    (*byte)(unsafe.Pointer(addr)),
+		addrLen: uint32(unsafe.Sizeof(*addr)),
+		msg: ipmiMsg{
+			dataLen: uint16(len(buf)),
+			data:    &buf[0],
+		},
+	}
+
+	// the driver returns EAGAIN until a response is queued,
+	// the poller then waits for the device to be readable
+	var ierr error
+	err := d.rc.Read(func(fd uintptr) bool {
+		ierr = ioctl(fd, ipmictlReceiveMsgTrunc, unsafe.Pointer(res))
+		return ierr != syscall.EAGAIN
+	})
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return 0, nil, syscall.ETIMEDOUT
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if ierr != nil {
+		return 0, nil, ierr
+	}
+
+	return int64(res.msgid), buf[:res.msg.dataLen], nil
+}
+
+func (d *ipmiDevintf) close() error {
+	return d.f.Close()
+}
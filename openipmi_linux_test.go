@@ -0,0 +1,59 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPMIDevintfRecv(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer func() { _ = w.Close() }()
+
+	// descriptors past FD_SETSIZE are supported
+	fd := 1100
+	rc, err := r.SyscallConn()
+	assert.NoError(t, err)
+	err = rc.Control(func(rfd uintptr) {
+		err = syscall.Dup3(int(rfd), fd, syscall.O_CLOEXEC)
+	})
+	_ = r.Close()
+	if err != nil {
+		t.Skip(err)
+	}
+	assert.NoError(t, syscall.SetNonblock(fd, true))
+
+	f := os.NewFile(uintptr(fd), "pipe")
+	rc, err = f.SyscallConn()
+	assert.NoError(t, err)
+	d := &ipmiDevintf{f, rc}
+
+	_, _, err = d.recv(0)
+	assert.Equal(t, syscall.ETIMEDOUT, err)
+
+	// a pipe is not an IPMI device
+	_, _, err = d.recv(time.Second)
+	assert.Equal(t, syscall.ENOTTY, err)
+
+	assert.NoError(t, d.close())
+}
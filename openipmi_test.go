@@ -0,0 +1,137 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeIPMIDevice struct {
+	responses map[Command][]byte
+	pending   []int64
+	cmds      []Command
+	lun       uint8
+	stale     bool
+	closed    bool
+}
+
+func (d *fakeIPMIDevice) send(msgid int64, netfn NetworkFunction, cmd Command, lun uint8, data []byte) error {
+	if d.stale {
+		// a late response to an earlier request is queued first
+		d.pending = append(d.pending, msgid-1)
+	}
+	d.pending = append(d.pending, msgid)
+	d.cmds = append(d.cmds, cmd)
+	d.lun = lun
+	return nil
+}
+
+func (d *fakeIPMIDevice) recv(timeout time.Duration) (int64, []byte, error) {
+	if len(d.pending) == 0 {
+		return 0, nil, syscall.ETIMEDOUT
+	}
+	msgid := d.pending[0]
+	d.pending = d.pending[1:]
+	res, ok := d.responses[d.cmds[len(d.cmds)-1]]
+	if !ok {
+		res = []byte{uint8(ErrInvalidCommand)}
+	}
+	return msgid, res, nil
+}
+
+func (d *fakeIPMIDevice) close() error {
+	d.closed = true
+	return nil
+}
+
+func TestOpenIPMI(t *testing.T) {
+	dev := &fakeIPMIDevice{
+		responses: map[Command][]byte{
+			CommandGetDeviceID: {0x00, 0x20, 0x01, 0x02, 0x03, 0x51, 0x00, 0xa2, 0x02, 0x00, 0x00},
+		},
+	}
+
+	c := &Connection{Interface: "open", LUN: 2}
+	tr, err := newTransport(c)
+	assert.NoError(t, err)
+
+	o := tr.(*openIPMI)
+	var path string
+	o.openDevice = func(p string) (ipmiDevice, error) {
+		path = p
+		return dev, nil
+	}
+
+	err = tr.open()
+	assert.NoError(t, err)
+	assert.Equal(t, openIPMIDevices[0], path)
+
+	req := &Request{
+		NetworkFunctionApp,
+		CommandGetDeviceID,
+		&DeviceIDRequest{},
+	}
+	res := &DeviceIDResponse{}
+	err = tr.send(req, res)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0x51), res.IPMIVersion)
+	assert.Equal(t, OemDell, res.ManufacturerID)
+	assert.Equal(t, uint8(2), dev.lun)
+
+	dev.stale = true
+	err = tr.send(req, res)
+	assert.NoError(t, err)
+	assert.Empty(t, dev.pending)
+	dev.stale = false
+
+	req.Command = 0xff
+	err = tr.send(req, res)
+	assert.Equal(t, ErrInvalidCommand, err)
+
+	err = tr.close()
+	assert.NoError(t, err)
+	assert.True(t, dev.closed)
+
+	err = tr.send(req, res)
+	assert.Error(t, err)
+}
+
+func TestOpenIPMIDevicePath(t *testing.T) {
+	c := &Connection{Interface: "open"}
+	o := newOpenTransport(c).(*openIPMI)
+
+	var paths []string
+	o.openDevice = func(p string) (ipmiDevice, error) {
+		paths = append(paths, p)
+		return nil, errors.New("no such device")
+	}
+
+	err := o.open()
+	assert.Error(t, err)
+	assert.Equal(t, openIPMIDevices, paths)
+
+	paths = nil
+	c.Path = "/dev/ipmi1"
+	err = o.open()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"/dev/ipmi1"}, paths)
+}
@@ -0,0 +1,286 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSessions is the number of concurrent sessions a Pool opens
+// per BMC when MaxSessions is not set. Most BMCs allow only 4 or 5.
+const DefaultMaxSessions = 4
+
+// ErrPoolClosed is returned by Pool.Get once the Pool has been closed
+var ErrPoolClosed = errors.New("pool closed")
+
+// Pool manages open Client sessions for many BMCs, keyed by the address,
+// credentials and options of a Connection. The Tracer, Logger, Metrics and
+// Recorder hooks are not part of the key. Sessions are opened lazily, reused
+// once returned with Put and closed after sitting idle for IdleTimeout.
+type Pool struct {
+	maxSessions int
+	idleTimeout time.Duration
+
+	mu   sync.Mutex
+	bmcs map[poolKey]*poolEntry
+	// inUse maps the clients handed out by Get to their entry
+	inUse  map[*Client]*poolEntry
+	done   chan struct{}
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// poolKey identifies the sessions of a Connection that can be shared
+type poolKey struct {
+	path, hostname, username, password, intf, bmcKey, passwordFile string
+	authTypes                                                      string
+	port, cipherSuite, retries                                     int
+	privilege, lun, targetAddress, targetChannel                   uint8
+	timeout, keepalive                                             time.Duration
+}
+
+func newPoolKey(c *Connection) poolKey {
+	return poolKey{
+		path:          c.Path,
+		hostname:      c.Hostname,
+		username:      c.Username,
+		password:      c.Password,
+		intf:          c.Interface,
+		bmcKey:        c.BMCKey,
+		passwordFile:  c.PasswordFile,
+		port:          c.Port,
+		cipherSuite:   c.CipherSuite,
+		retries:       c.Retries,
+		privilege:     c.Privilege,
+		lun:           c.LUN,
+		authTypes:     string(c.AuthTypes),
+		targetAddress: c.TargetAddress,
+		targetChannel: c.TargetChannel,
+		timeout:       c.Timeout,
+		keepalive:     c.Keepalive,
+	}
+}
+
+type poolEntry struct {
+	sem  chan struct{}
+	idle []*pooledClient
+	// users is the number of clients in use or waited for,
+	// the entry is removed once it has none and no idle sessions
+	users int
+}
+
+type pooledClient struct {
+	*Client
+	lastUsed time.Time
+}
+
+// NewPool creates a Pool that opens at most maxSessions sessions per BMC
+// and closes sessions idle for longer than idleTimeout.
+// A zero idleTimeout disables eviction.
+func NewPool(maxSessions int, idleTimeout time.Duration) *Pool {
+	if maxSessions <= 0 {
+		maxSessions = DefaultMaxSessions
+	}
+
+	p := &Pool{
+		maxSessions: maxSessions,
+		idleTimeout: idleTimeout,
+		bmcs:        map[poolKey]*poolEntry{},
+		inUse:       map[*Client]*poolEntry{},
+		done:        make(chan struct{}),
+	}
+
+	if idleTimeout > 0 {
+		p.wg.Add(1)
+		go p.evictor()
+	}
+
+	return p
+}
+
+func (p *Pool) entry(key poolKey) *poolEntry {
+	e, ok := p.bmcs[key]
+	if !ok {
+		e = &poolEntry{sem: make(chan struct{}, p.maxSessions)}
+		p.bmcs[key] = e
+	}
+	return e
+}
+
+// Get returns an open Client for the given Connection, reusing an idle
+// session if there is one. Get blocks while MaxSessions sessions to the
+// BMC are already in use. The Client must be returned with Put.
+func (p *Pool) Get(c *Connection) (*Client, error) {
+	conn := *c
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	e := p.entry(newPoolKey(&conn))
+	e.users++
+	p.mu.Unlock()
+
+	select {
+	case e.sem <- struct{}{}:
+	case <-p.done:
+		p.release(e)
+		return nil, ErrPoolClosed
+	}
+
+	p.mu.Lock()
+	if n := len(e.idle); n > 0 {
+		pc := e.idle[n-1]
+		e.idle = e.idle[:n-1]
+		p.inUse[pc.Client] = e
+		p.mu.Unlock()
+		return pc.Client, nil
+	}
+	p.mu.Unlock()
+
+	client, err := NewClient(&conn)
+	if err == nil {
+		err = client.Open()
+	}
+	if err != nil {
+		<-e.sem
+		p.release(e)
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.inUse[client] = e
+	p.mu.Unlock()
+
+	return client, nil
+}
+
+// release a user of the entry that did not get a client
+func (p *Pool) release(e *poolEntry) {
+	p.mu.Lock()
+	e.users--
+	p.mu.Unlock()
+}
+
+// Put returns a Client obtained from Get to the Pool. Putting a Client
+// that is not in use, because it was already returned or obtained from
+// another Pool, does nothing.
+func (p *Pool) Put(client *Client) {
+	p.mu.Lock()
+	e, ok := p.inUse[client]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.inUse, client)
+	e.users--
+	keep := !p.closed
+	if keep {
+		e.idle = append(e.idle, &pooledClient{client, time.Now()})
+	}
+	p.mu.Unlock()
+
+	// closing a session waits for the BMC, which must not hold up the Pool
+	if !keep {
+		_ = client.Close()
+	}
+	<-e.sem
+}
+
+// Do calls fn with a Client for the given Connection, returning the
+// Client to the Pool once fn returns.
+func (p *Pool) Do(c *Connection, fn func(*Client) error) error {
+	client, err := p.Get(c)
+	if err != nil {
+		return err
+	}
+	defer p.Put(client)
+	return fn(client)
+}
+
+// Close all idle sessions. Sessions still in use are closed when they
+// are returned with Put.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+
+	var idle []*pooledClient
+	for _, e := range p.bmcs {
+		idle = append(idle, e.idle...)
+		e.idle = nil
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+
+	for _, pc := range idle {
+		_ = pc.Close()
+	}
+
+	return nil
+}
+
+func (p *Pool) evictor() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			for _, pc := range p.expired(now) {
+				_ = pc.Close()
+			}
+		}
+	}
+}
+
+// expired removes and returns the idle sessions older than idleTimeout,
+// removing the entries of BMCs no longer in use
+func (p *Pool) expired(now time.Time) []*pooledClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var expired []*pooledClient
+	for key, e := range p.bmcs {
+		idle := e.idle[:0]
+		for _, pc := range e.idle {
+			if now.Sub(pc.lastUsed) >= p.idleTimeout {
+				expired = append(expired, pc)
+			} else {
+				idle = append(idle, pc)
+			}
+		}
+		e.idle = idle
+		if len(e.idle) == 0 && e.users == 0 {
+			delete(p.bmcs, key)
+		}
+	}
+
+	return expired
+}
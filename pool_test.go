@@ -0,0 +1,149 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	p := NewPool(1, 0)
+
+	client, err := p.Get(c)
+	assert.NoError(t, err)
+
+	// MaxSessions reached, Get blocks until the client is returned
+	got := make(chan *Client)
+	go func() {
+		other, err := p.Get(c)
+		assert.NoError(t, err)
+		got <- other
+	}()
+
+	select {
+	case <-got:
+		t.Fatal("Get should block while MaxSessions are in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.Put(client)
+	reused := <-got
+	assert.True(t, client == reused)
+	p.Put(reused)
+
+	// returning a client twice, or one the Pool did not hand out, does nothing
+	put := make(chan struct{})
+	go func() {
+		p.Put(reused)
+		stranger, err := NewClient(c)
+		assert.NoError(t, err)
+		p.Put(stranger)
+		close(put)
+	}()
+	select {
+	case <-put:
+	case <-time.After(time.Second):
+		t.Fatal("Put of a client not in use blocked")
+	}
+	p.mu.Lock()
+	assert.Len(t, p.bmcs[newPoolKey(c)].idle, 1)
+	p.mu.Unlock()
+
+	err = p.Do(c, func(client *Client) error {
+		_, err := client.DeviceID()
+		return err
+	})
+	assert.NoError(t, err)
+
+	err = p.Close()
+	assert.NoError(t, err)
+
+	_, err = p.Get(c)
+	assert.Equal(t, ErrPoolClosed, err)
+	s.Stop()
+}
+
+func TestPoolEviction(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	p := NewPool(0, 20*time.Millisecond)
+
+	client, err := p.Get(c)
+	assert.NoError(t, err)
+	p.Put(client)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// the entry of a BMC without sessions is removed
+	p.mu.Lock()
+	assert.Empty(t, p.bmcs)
+	p.mu.Unlock()
+
+	other, err := p.Get(c)
+	assert.NoError(t, err)
+	assert.True(t, client != other)
+	p.Put(other)
+
+	err = p.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+// traceLog is a Tracer that is not comparable
+type traceLog []*TraceEvent
+
+func (l traceLog) Trace(*TraceEvent) {}
+
+func TestPoolHooks(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	p := NewPool(1, 0)
+
+	// hooks are not part of the key, the session is shared
+	c := s.NewConnection()
+	c.Tracer = traceLog{}
+	client, err := p.Get(c)
+	assert.NoError(t, err)
+	p.Put(client)
+
+	c = s.NewConnection()
+	c.Tracer = traceLog{}
+	other, err := p.Get(c)
+	assert.NoError(t, err)
+	assert.True(t, client == other)
+
+	// sessions returned once the Pool is closed are closed by Put
+	err = p.Close()
+	assert.NoError(t, err)
+	p.Put(other)
+
+	s.Stop()
+}
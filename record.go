@@ -0,0 +1,377 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Exchange is a request sent to a BMC and its response
+type Exchange struct {
+	NetworkFunction NetworkFunction
+	Command         Command
+	// Request is the request data
+	Request        []byte
+	CompletionCode CompletionCode
+	// Response is the response data following the completion code
+	Response []byte
+	// Err is set if no response was received, such as on a timeout
+	Err string
+	// ErrKind classifies Err, such that it is replayed as an error the
+	// Client handles as it did when recorded
+	ErrKind ErrorKind
+}
+
+// ErrorKind of a recorded error
+type ErrorKind string
+
+// ErrorKind values, other errors have no kind
+const (
+	// ErrorKindTimeout is an error with a Timeout() method returning true
+	ErrorKindTimeout = ErrorKind("timeout")
+	// ErrorKindSession is ErrInvalidSession
+	ErrorKindSession = ErrorKind("session")
+)
+
+func errorKind(err error) ErrorKind {
+	switch {
+	case err == ErrInvalidSession:
+		return ErrorKindSession
+	case isTimeout(err):
+		return ErrorKindTimeout
+	}
+	return ""
+}
+
+// replayError is a recorded error of no specific kind, or a timeout
+type replayError struct {
+	err     string
+	timeout bool
+}
+
+func (e *replayError) Error() string {
+	return e.err
+}
+
+// Timeout implements net.Error
+func (e *replayError) Timeout() bool {
+	return e.timeout
+}
+
+// Temporary implements net.Error
+func (e *replayError) Temporary() bool {
+	return e.timeout
+}
+
+// error returns the recorded error as an error of the same kind
+func (e *Exchange) error() error {
+	switch e.ErrKind {
+	case ErrorKindSession:
+		return ErrInvalidSession
+	case ErrorKindTimeout:
+		return &replayError{err: e.Err, timeout: true}
+	}
+	return &replayError{err: e.Err}
+}
+
+// exchangeJSON is an Exchange as a line of a recording,
+// with data in hex such that recordings can be read and edited
+type exchangeJSON struct {
+	NetworkFunction uint8  `json:"netfn"`
+	Command         uint8  `json:"cmd"`
+	Request         string `json:"request"`
+	CompletionCode  uint8  `json:"code"`
+	Response        string `json:"response,omitempty"`
+	Err             string `json:"error,omitempty"`
+	ErrKind         string `json:"kind,omitempty"`
+}
+
+// MarshalJSON implementation to encode data in hex
+func (e *Exchange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&exchangeJSON{
+		NetworkFunction: uint8(e.NetworkFunction),
+		Command:         uint8(e.Command),
+		Request:         hex.EncodeToString(e.Request),
+		CompletionCode:  uint8(e.CompletionCode),
+		Response:        hex.EncodeToString(e.Response),
+		Err:             e.Err,
+		ErrKind:         string(e.ErrKind),
+	})
+}
+
+// UnmarshalJSON implementation to decode data in hex
+func (e *Exchange) UnmarshalJSON(buf []byte) error {
+	x := &exchangeJSON{}
+	if err := json.Unmarshal(buf, x); err != nil {
+		return err
+	}
+	req, err := hex.DecodeString(x.Request)
+	if err != nil {
+		return fmt.Errorf("request: %s", err)
+	}
+	res, err := hex.DecodeString(x.Response)
+	if err != nil {
+		return fmt.Errorf("response: %s", err)
+	}
+	*e = Exchange{
+		NetworkFunction: NetworkFunction(x.NetworkFunction),
+		Command:         Command(x.Command),
+		Request:         req,
+		CompletionCode:  CompletionCode(x.CompletionCode),
+		Response:        res,
+		Err:             x.Err,
+		ErrKind:         ErrorKind(x.ErrKind),
+	}
+	return nil
+}
+
+// String summarizes the exchange
+func (e *Exchange) String() string {
+	return fmt.Sprintf("netfn=0x%02x cmd=0x%02x data=%x", uint8(e.NetworkFunction), uint8(e.Command), e.Request)
+}
+
+// Recorder writes the Exchanges of a Client to a recording,
+// one JSON object per line
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder returns a Recorder writing to w.
+// Write errors are returned by Err.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing an Exchange
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Record writes the given Exchange
+func (r *Recorder) Record(e *Exchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(e)
+}
+
+// recording transport passes requests through to another transport,
+// writing each to a Recorder. High level operations are always sent
+// as Requests, even if the transport runs them natively.
+type recording struct {
+	transport
+	recorder *Recorder
+}
+
+func (r *recording) send(req *Request, res Response) error {
+	// requests that cannot be encoded are not sent, nor recorded
+	data, err := messageDataToBytes(req.Data)
+	if err != nil {
+		return err
+	}
+	e := &Exchange{
+		NetworkFunction: req.NetworkFunction,
+		Command:         req.Command,
+		Request:         data,
+	}
+
+	raw := &rawResponse{}
+	err = r.transport.send(req, raw)
+	switch cc, ok := err.(CompletionCode); {
+	case ok:
+		e.CompletionCode = cc
+		e.Response = raw.Data
+	case err != nil:
+		e.Err = err.Error()
+		e.ErrKind = errorKind(err)
+	default:
+		e.CompletionCode = raw.CompletionCode
+		e.Response = raw.Data
+	}
+	r.recorder.Record(e)
+
+	if cc, ok := err.(CompletionCode); ok {
+		errorData(append([]byte{uint8(cc)}, raw.Data...), res)
+	}
+	if err != nil {
+		return err
+	}
+	return messageDataFromBytes(append([]byte{uint8(raw.CompletionCode)}, raw.Data...), res)
+}
+
+// ReplayMatch selects how requests are matched to recorded Exchanges
+type ReplayMatch int
+
+// ReplayMatch modes
+const (
+	// ReplayStrict requires each request to be the next recorded request,
+	// with the same netfn, command and data
+	ReplayStrict = ReplayMatch(iota)
+	// ReplayLoose serves the first unused Exchange with the same netfn,
+	// command and data, or else with the same netfn and command, in any order.
+	// Once all such Exchanges are used, the last is served again.
+	ReplayLoose
+)
+
+// LoadRecording reads the Exchanges written by a Recorder to the given file
+func LoadRecording(path string) ([]*Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecording(f)
+}
+
+// ReadRecording reads the Exchanges written by a Recorder
+func ReadRecording(r io.Reader) ([]*Exchange, error) {
+	var exchanges []*Exchange
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := &Exchange{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("recording line %d: %s", line, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, scanner.Err()
+}
+
+// replay transport serves recorded Exchanges in place of a BMC
+type replay struct {
+	mu        sync.Mutex
+	exchanges []*Exchange
+	match     ReplayMatch
+	used      []bool
+	next      int
+	last      map[[2]uint8]*Exchange
+}
+
+// NewReplayClient returns a Client that serves the given Exchanges
+// back in response to its requests, matched as given by match.
+// A request without a match fails with an error.
+func NewReplayClient(exchanges []*Exchange, match ReplayMatch) *Client {
+	return &Client{
+		Connection: &Connection{Interface: "replay"},
+		transport: &replay{
+			exchanges: exchanges,
+			match:     match,
+			used:      make([]bool, len(exchanges)),
+			last:      map[[2]uint8]*Exchange{},
+		},
+	}
+}
+
+func (r *replay) open() error {
+	return nil
+}
+
+func (r *replay) close() error {
+	return nil
+}
+
+func (r *replay) send(req *Request, res Response) error {
+	data, err := messageDataToBytes(req.Data)
+	if err != nil {
+		return err
+	}
+	e, err := r.lookup(&Exchange{
+		NetworkFunction: req.NetworkFunction,
+		Command:         req.Command,
+		Request:         data,
+	})
+	if err != nil {
+		return err
+	}
+
+	if e.Err != "" {
+		return e.error()
+	}
+	if e.CompletionCode != CommandCompleted {
+		errorData(append([]byte{uint8(e.CompletionCode)}, e.Response...), res)
+		return e.CompletionCode
+	}
+	return messageDataFromBytes(append([]byte{uint8(e.CompletionCode)}, e.Response...), res)
+}
+
+// lookup returns the recorded Exchange matching the request in q
+func (r *replay) lookup(q *Exchange) (*Exchange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.match == ReplayStrict {
+		if r.next >= len(r.exchanges) {
+			return nil, fmt.Errorf("replay: unexpected request %s after the end of the recording", q)
+		}
+		e := r.exchanges[r.next]
+		if !sameCommand(e, q) || string(e.Request) != string(q.Request) {
+			return nil, fmt.Errorf("replay: request %d is %s, recorded %s", r.next+1, q, e)
+		}
+		r.next++
+		return e, nil
+	}
+
+	found := -1
+	for i, e := range r.exchanges {
+		if r.used[i] || !sameCommand(e, q) {
+			continue
+		}
+		if string(e.Request) == string(q.Request) {
+			found = i
+			break
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+
+	key := [2]uint8{uint8(q.NetworkFunction), uint8(q.Command)}
+	if found < 0 {
+		if e, ok := r.last[key]; ok {
+			return e, nil
+		}
+		return nil, fmt.Errorf("replay: no recorded exchange for request %s", q)
+	}
+	r.used[found] = true
+	r.last[key] = r.exchanges[found]
+	return r.exchanges[found], nil
+}
+
+func sameCommand(a, b *Exchange) bool {
+	return a.NetworkFunction == b.NetworkFunction && a.Command == b.Command
+}
+
+func (*replay) Console() error {
+	return errors.New("replay: console not supported")
+}
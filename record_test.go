@@ -0,0 +1,188 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	s.SetDeviceID(DeviceIDResponse{ManufacturerID: OemSupermicro, ProductID: 0x1234})
+	assert.NoError(t, s.AddSDR(&SDR{RecordType: SDRTypeFullSensor, SensorNumber: 0x30, EventType: EventTypeThreshold, BaseUnit: 1, M: 1, Name: "CPU Temp"}))
+	assert.NoError(t, s.SetSensorReading(0x30, 42, 0))
+	s.SetFault(NetworkFunctionChassis, CommandChassisStatus, Fault{Drop: 1})
+	s.SetHandler(NetworkFunction(0x30), 0x03, func(*Message) Response {
+		return &rawResponse{CompletionCode: CompletionCode(0x80), Data: []byte{0xde, 0xad}}
+	})
+
+	buf := &bytes.Buffer{}
+	conn := s.NewConnection()
+	conn.Timeout = 100 * time.Millisecond
+	conn.Recorder = NewRecorder(buf)
+	client, err := NewClient(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "lan", client.SelectedInterface())
+	err = client.Open()
+	assert.NoError(t, err)
+
+	id, err := client.DeviceID()
+	assert.NoError(t, err)
+	sensors, err := client.Sensors()
+	assert.NoError(t, err)
+	_, err = client.FRU(0)
+	assert.Equal(t, ErrNoObj, err)
+	cc, data, err := client.Raw(NetworkFunction(0x30), 0x03, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, CompletionCode(0x80), cc)
+	assert.Equal(t, []byte{0xde, 0xad}, data)
+	_, err = client.ChassisStatus()
+	assert.Error(t, err)
+
+	assert.NoError(t, client.Close())
+	s.Stop()
+	assert.NoError(t, conn.Recorder.Err())
+
+	exchanges, err := ReadRecording(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, NetworkFunctionApp, exchanges[0].NetworkFunction)
+	assert.Equal(t, CommandGetDeviceID, exchanges[0].Command)
+	last := exchanges[len(exchanges)-1]
+	assert.Equal(t, CommandChassisStatus, last.Command)
+	assert.NotEmpty(t, last.Err)
+	assert.Equal(t, ErrorKindTimeout, last.ErrKind)
+
+	for _, match := range []ReplayMatch{ReplayStrict, ReplayLoose} {
+		replay := NewReplayClient(exchanges, match)
+		assert.NoError(t, replay.Open())
+
+		rid, err := replay.DeviceID()
+		assert.NoError(t, err)
+		assert.Equal(t, id, rid)
+		rsensors, err := replay.Sensors()
+		assert.NoError(t, err)
+		assert.Equal(t, sensors, rsensors)
+		_, err = replay.FRU(0)
+		assert.Equal(t, ErrNoObj, err)
+		cc, data, err := replay.Raw(NetworkFunction(0x30), 0x03, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, CompletionCode(0x80), cc)
+		assert.Equal(t, []byte{0xde, 0xad}, data)
+		_, err = replay.ChassisStatus()
+		assert.Contains(t, err.Error(), "i/o timeout")
+		assert.True(t, isTimeout(err))
+
+		assert.NoError(t, replay.Close())
+	}
+}
+
+func TestReplayMatch(t *testing.T) {
+	exchanges := []*Exchange{
+		{NetworkFunction: NetworkFunctionApp, Command: CommandGetDeviceID, Response: []byte{0x20, 0x01, 0x02, 0x03, 0x51, 0x00, 0xa2, 0x02, 0x00, 0x00, 0x01}},
+		{NetworkFunction: NetworkFunctionSensorEvent, Command: CommandGetSensorReading, Request: []byte{0x30}, Response: []byte{30, 0x40, 0x00}},
+		{NetworkFunction: NetworkFunctionSensorEvent, Command: CommandGetSensorReading, Request: []byte{0x31}, Response: []byte{31, 0x40, 0x00}},
+	}
+	reading := func(c *Client, number uint8) (uint8, error) {
+		res := &SensorReadingResponse{}
+		err := c.Send(&Request{NetworkFunctionSensorEvent, CommandGetSensorReading, &SensorReadingRequest{number}}, res)
+		return res.Reading, err
+	}
+
+	// strict matching requires the recorded order and data
+	strict := NewReplayClient(exchanges, ReplayStrict)
+	_, err := reading(strict, 0x30)
+	assert.EqualError(t, err, "replay: request 1 is netfn=0x04 cmd=0x2d data=30, recorded netfn=0x06 cmd=0x01 data=")
+	_, err = strict.DeviceID()
+	assert.NoError(t, err)
+	_, err = reading(strict, 0x31)
+	assert.Error(t, err)
+	r, err := reading(strict, 0x30)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(30), r)
+	_, err = reading(strict, 0x31)
+	assert.NoError(t, err)
+	_, err = strict.DeviceID()
+	assert.EqualError(t, err, "replay: unexpected request netfn=0x06 cmd=0x01 data= after the end of the recording")
+
+	// loose matching prefers the same data, in any order, and repeats
+	loose := NewReplayClient(exchanges, ReplayLoose)
+	r, err = reading(loose, 0x31)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(31), r)
+	r, err = reading(loose, 0x32)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(30), r)
+	r, err = reading(loose, 0x30)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(30), r)
+	_, err = loose.DeviceID()
+	assert.NoError(t, err)
+	id, err := loose.DeviceID()
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0x51), id.IPMIVersion)
+	_, err = loose.ChassisStatus()
+	assert.EqualError(t, err, "replay: no recorded exchange for request netfn=0x00 cmd=0x01 data=")
+
+	assert.Error(t, loose.Console())
+}
+
+func TestRecording(t *testing.T) {
+	exchanges, err := LoadRecording("testdata/replay-synthetic-r640.jsonl")
+	assert.NoError(t, err)
+
+	// a hand written recording modelled on a Dell R640, replayed as a unit test
+	client := NewReplayClient(exchanges, ReplayStrict)
+	assert.NoError(t, client.Open())
+	id, err := client.DeviceID()
+	assert.NoError(t, err)
+	assert.Equal(t, OemDell, id.ManufacturerID)
+	sensors, err := client.Sensors()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, sensors)
+	entries, err := client.SELEntries()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, entries)
+	assert.NoError(t, client.Close())
+
+	// errors are replayed as the same kind of error
+	exchanges, err = ReadRecording(bytes.NewReader([]byte(`{"netfn":6,"cmd":1,"request":"","code":0,"error":"invalid session","kind":"session"}
+{"netfn":6,"cmd":1,"request":"","code":0,"error":"i/o timeout","kind":"timeout"}
+{"netfn":6,"cmd":1,"request":"","code":0,"error":"Unable to establish IPMI v2 / RMCP+ session"}
+`)))
+	assert.NoError(t, err)
+	for _, e := range exchanges {
+		err := e.error()
+		assert.Equal(t, e.Err, err.Error())
+		assert.Equal(t, e.ErrKind, errorKind(err))
+	}
+	assert.Equal(t, ErrInvalidSession, exchanges[0].error())
+
+	_, err = LoadRecording("testdata/missing.jsonl")
+	assert.Error(t, err)
+	_, err = ReadRecording(bytes.NewReader([]byte("{\"netfn\":6,\"cmd\":1,\"request\":\"zz\"}\n")))
+	assert.EqualError(t, err, "recording line 1: request: encoding/hex: invalid byte: U+007A 'z'")
+	_, err = ReadRecording(bytes.NewReader([]byte("\n{")))
+	assert.Error(t, err)
+}
@@ -32,3 +32,15 @@ func TestRMCPHeaderFromBytes(t *testing.T) {
 	_, err = rmcpHeaderFromBytes(buf)
 	assert.NoError(t, err)
 }
+
+func FuzzRMCPHeaderFromBytes(f *testing.F) {
+	f.Add([]byte{rmcpVersion1, 0, 0xff, rmcpClassIPMI})
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		h, err := rmcpHeaderFromBytes(buf)
+		if err != nil {
+			return
+		}
+		_ = h.unsupportedClass()
+	})
+}
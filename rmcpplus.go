@@ -0,0 +1,545 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+)
+
+// authTypeRMCPPlus is the session header auth type of IPMI v2.0 RMCP+ messages
+const authTypeRMCPPlus = 0x06
+
+// RMCP+ payload types per section 13.27.3
+const (
+	PayloadTypeIPMI                = 0x00
+	PayloadTypeSOL                 = 0x01
+	PayloadTypeOEM                 = 0x02
+	PayloadTypeOpenSessionRequest  = 0x10
+	PayloadTypeOpenSessionResponse = 0x11
+	PayloadTypeRAKP1               = 0x12
+	PayloadTypeRAKP2               = 0x13
+	PayloadTypeRAKP3               = 0x14
+	PayloadTypeRAKP4               = 0x15
+)
+
+// payload type flags of an RMCP+ session header
+const (
+	payloadEncrypted     = 0x80
+	payloadAuthenticated = 0x40
+	payloadTypeMask      = 0x3f
+)
+
+// rmcpPlusNextHeader is the Next Header field of the integrity trailer
+const rmcpPlusNextHeader = 0x07
+
+// RMCP+ authentication, integrity and confidentiality algorithms per section 13.28,
+// the integrity HMACs are HMAC-SHA1-96 and HMAC-SHA256-128
+const (
+	authRAKPNone       = 0x00
+	authRAKPHMACSHA1   = 0x01
+	authRAKPHMACSHA256 = 0x03
+
+	integrityNone       = 0x00
+	integrityHMACSHA1   = 0x01
+	integrityHMACSHA256 = 0x04
+
+	confidentialityNone      = 0x00
+	confidentialityAESCBC128 = 0x01
+)
+
+// RMCP+ and RAKP message status codes per section 13.24
+const (
+	rakpStatusOK                    = 0x00
+	rakpStatusInsufficientResources = 0x01
+	rakpStatusInvalidSessionID      = 0x02
+	rakpStatusInvalidRole           = 0x09
+	rakpStatusUnauthorizedRole      = 0x0a
+	rakpStatusInvalidNameLength     = 0x0c
+	rakpStatusUnauthorizedName      = 0x0d
+	rakpStatusInvalidIntegrity      = 0x0f
+	rakpStatusNoCipherSuiteMatch    = 0x11
+)
+
+// rakpNameOnlyLookup is the Role bit selecting username only user lookup
+const rakpNameOnlyLookup = 0x10
+
+// rakpKeySize is the size of the user password and BMC keys, Kuid and Kg
+const rakpKeySize = 20
+
+// rakpConstSize is the size of Const1 and Const2, from which K1 and K2 are
+// derived. It is 20 for HMAC-SHA256 as well, as ipmitool and BMCs implement.
+const rakpConstSize = 20
+
+// cipherSuite is a combination of RMCP+ algorithms per section 22.15.2
+type cipherSuite struct {
+	id              uint8
+	auth            uint8
+	integrity       uint8
+	confidentiality uint8
+}
+
+// cipherSuites are the cipher suites of the algorithms implemented here
+var cipherSuites = []cipherSuite{
+	{0, authRAKPNone, integrityNone, confidentialityNone},
+	{1, authRAKPHMACSHA1, integrityNone, confidentialityNone},
+	{2, authRAKPHMACSHA1, integrityHMACSHA1, confidentialityNone},
+	{3, authRAKPHMACSHA1, integrityHMACSHA1, confidentialityAESCBC128},
+	{15, authRAKPHMACSHA256, integrityNone, confidentialityNone},
+	{16, authRAKPHMACSHA256, integrityHMACSHA256, confidentialityNone},
+	{17, authRAKPHMACSHA256, integrityHMACSHA256, confidentialityAESCBC128},
+}
+
+func findCipherSuite(auth, integrity, confidentiality uint8) (cipherSuite, bool) {
+	for _, suite := range cipherSuites {
+		if suite.auth == auth && suite.integrity == integrity && suite.confidentiality == confidentiality {
+			return suite, true
+		}
+	}
+	return cipherSuite{}, false
+}
+
+// AlgorithmPayload proposes or selects an algorithm of an RMCP+ session
+type AlgorithmPayload struct {
+	// Type is 0 for authentication, 1 integrity and 2 confidentiality
+	Type      uint8
+	_         uint16
+	Length    uint8
+	Algorithm uint8
+	_         [3]uint8
+}
+
+// OpenSessionRequest per section 13.17
+type OpenSessionRequest struct {
+	MessageTag uint8
+	// MaxPriv is the requested maximum privilege level, 0 for the highest
+	MaxPriv          uint8
+	_                uint16
+	ConsoleSessionID uint32
+	Auth             AlgorithmPayload
+	Integrity        AlgorithmPayload
+	Confidentiality  AlgorithmPayload
+}
+
+// OpenSessionResponse per section 13.18, which ends after
+// ConsoleSessionID if the Status is not zero
+type OpenSessionResponse struct {
+	MessageTag       uint8
+	Status           uint8
+	MaxPriv          uint8
+	_                uint8
+	ConsoleSessionID uint32
+	BMCSessionID     uint32           `ipmi:"optional"`
+	Auth             AlgorithmPayload `ipmi:"optional"`
+	Integrity        AlgorithmPayload `ipmi:"optional"`
+	Confidentiality  AlgorithmPayload `ipmi:"optional"`
+}
+
+// RAKPMessage1 per section 13.20
+type RAKPMessage1 struct {
+	MessageTag    uint8
+	_             [3]uint8
+	BMCSessionID  uint32
+	ConsoleRandom [16]uint8
+	// Role is the requested maximum privilege level and lookup bit
+	Role           uint8
+	_              uint16
+	UsernameLength uint8
+	Username       string
+}
+
+// RAKPMessage2 per section 13.21, which ends after
+// ConsoleSessionID if the Status is not zero
+type RAKPMessage2 struct {
+	MessageTag       uint8
+	Status           uint8
+	_                uint16
+	ConsoleSessionID uint32
+	BMCRandom        [16]uint8 `ipmi:"optional"`
+	BMCGUID          [16]uint8 `ipmi:"optional"`
+	AuthCode         []uint8   `ipmi:"optional"`
+}
+
+// RAKPMessage3 per section 13.22
+type RAKPMessage3 struct {
+	MessageTag   uint8
+	Status       uint8
+	_            uint16
+	BMCSessionID uint32
+	AuthCode     []uint8
+}
+
+// RAKPMessage4 per section 13.23
+type RAKPMessage4 struct {
+	MessageTag       uint8
+	Status           uint8
+	_                uint16
+	ConsoleSessionID uint32
+	IntegrityCheck   []uint8
+}
+
+// rakp holds the values exchanged to authenticate an RMCP+ session,
+// from which both sides compute the auth codes and session keys per section 13.31
+type rakp struct {
+	suite         cipherSuite
+	consoleID     uint32
+	bmcID         uint32
+	consoleRandom [16]uint8
+	bmcRandom     [16]uint8
+	bmcGUID       [16]uint8
+	role          uint8
+	username      string
+	// kuid is the user password and kg the BMC key, or kuid if not set
+	kuid []byte
+	kg   []byte
+}
+
+// rakpKey returns key NUL padded to rakpKeySize
+func rakpKey(key string) []byte {
+	k := make([]byte, rakpKeySize)
+	copy(k, key)
+	return k
+}
+
+func (r *rakp) hash() func() hash.Hash {
+	switch r.suite.auth {
+	case authRAKPHMACSHA1:
+		return sha1.New
+	case authRAKPHMACSHA256:
+		return sha256.New
+	}
+	return nil
+}
+
+// hmac returns the HMAC of data, nil for RAKP-none
+func (r *rakp) hmac(key []byte, data ...[]byte) []byte {
+	h := r.hash()
+	if h == nil {
+		return nil
+	}
+	mac := hmac.New(h, key)
+	for _, d := range data {
+		_, _ = mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func (r *rakp) user() []byte {
+	return append([]byte{r.role, uint8(len(r.username))}, r.username...)
+}
+
+func uint32Bytes(n uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, n)
+}
+
+// bmcAuthCode is the Key Exchange Authentication Code of RAKP Message 2
+func (r *rakp) bmcAuthCode() []byte {
+	return r.hmac(r.kuid, uint32Bytes(r.consoleID), uint32Bytes(r.bmcID),
+		r.consoleRandom[:], r.bmcRandom[:], r.bmcGUID[:], r.user())
+}
+
+// consoleAuthCode is the Key Exchange Authentication Code of RAKP Message 3
+func (r *rakp) consoleAuthCode() []byte {
+	return r.hmac(r.kuid, r.bmcRandom[:], uint32Bytes(r.consoleID), r.user())
+}
+
+// sik is the Session Integrity Key
+func (r *rakp) sik() []byte {
+	return r.hmac(r.kg, r.consoleRandom[:], r.bmcRandom[:], r.user())
+}
+
+// integrityCheck is the Integrity Check Value of RAKP Message 4,
+// truncated to 96 bits for SHA1 and 128 bits for SHA256
+func (r *rakp) integrityCheck() []byte {
+	icv := r.hmac(r.sik(), r.consoleRandom[:], uint32Bytes(r.bmcID), r.bmcGUID[:])
+	switch r.suite.auth {
+	case authRAKPHMACSHA1:
+		return icv[:12]
+	case authRAKPHMACSHA256:
+		return icv[:16]
+	}
+	return nil
+}
+
+// keys derives the session keys K1 and K2 from the SIK per section 13.32
+func (r *rakp) keys() *rmcpPlusKeys {
+	k := &rmcpPlusKeys{suite: r.suite}
+	if sik := r.sik(); sik != nil {
+		k.k1 = r.hmac(sik, bytes.Repeat([]byte{0x01}, rakpConstSize))
+		k.k2 = r.hmac(sik, bytes.Repeat([]byte{0x02}, rakpConstSize))
+	}
+	return k
+}
+
+// rmcpPlusKeys are the algorithms and keys of an active RMCP+ session
+type rmcpPlusKeys struct {
+	suite cipherSuite
+	k1    []byte
+	k2    []byte
+}
+
+func (k *rmcpPlusKeys) authenticated() bool {
+	return k != nil && k.suite.integrity != integrityNone
+}
+
+func (k *rmcpPlusKeys) encrypted() bool {
+	return k != nil && k.suite.confidentiality != confidentialityNone
+}
+
+// authCode returns the integrity AuthCode of the signed part of a message
+func (k *rmcpPlusKeys) authCode(signed []byte) []byte {
+	switch k.suite.integrity {
+	case integrityHMACSHA1:
+		mac := hmac.New(sha1.New, k.k1)
+		_, _ = mac.Write(signed)
+		return mac.Sum(nil)[:12]
+	case integrityHMACSHA256:
+		mac := hmac.New(sha256.New, k.k1)
+		_, _ = mac.Write(signed)
+		return mac.Sum(nil)[:16]
+	}
+	return nil
+}
+
+// encrypt returns the AES-CBC-128 encrypted payload, prefixed by its IV
+// and padded to a whole number of blocks per section 13.29
+func (k *rmcpPlusKeys) encrypt(payload []byte) []byte {
+	block, err := aes.NewCipher(k.k2[:aes.BlockSize])
+	if err != nil {
+		panic(err)
+	}
+
+	pad := (aes.BlockSize - (len(payload)+1)%aes.BlockSize) % aes.BlockSize
+	plain := append([]byte(nil), payload...)
+	for i := 1; i <= pad; i++ {
+		plain = append(plain, uint8(i))
+	}
+	plain = append(plain, uint8(pad))
+
+	buf := make([]byte, aes.BlockSize+len(plain))
+	if _, err := rand.Read(buf[:aes.BlockSize]); err != nil {
+		panic(err)
+	}
+	cipher.NewCBCEncrypter(block, buf[:aes.BlockSize]).CryptBlocks(buf[aes.BlockSize:], plain)
+
+	return buf
+}
+
+// decrypt reverses encrypt
+func (k *rmcpPlusKeys) decrypt(buf []byte) ([]byte, error) {
+	if len(buf) < 2*aes.BlockSize || len(buf)%aes.BlockSize != 0 {
+		return nil, ErrInvalidPacket
+	}
+	block, err := aes.NewCipher(k.k2[:aes.BlockSize])
+	if err != nil {
+		panic(err)
+	}
+
+	plain := make([]byte, len(buf)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, buf[:aes.BlockSize]).CryptBlocks(plain, buf[aes.BlockSize:])
+
+	pad := int(plain[len(plain)-1])
+	if pad >= aes.BlockSize {
+		return nil, ErrInvalidPacket
+	}
+	end := len(plain) - 1 - pad
+	for i := 0; i < pad; i++ {
+		if plain[end+i] != uint8(i+1) {
+			return nil, ErrInvalidPacket
+		}
+	}
+	return plain[:end], nil
+}
+
+// rmcpPlusMessage is an IPMI v2.0 RMCP+ message per section 13.6
+type rmcpPlusMessage struct {
+	// PayloadType includes the encrypted and authenticated flags
+	PayloadType uint8
+	SessionID   uint32
+	Sequence    uint32
+	// Payload is encrypted until the message is opened
+	Payload []byte
+	// signed is the part of a received message covered by authCode
+	signed   []byte
+	authCode []byte
+}
+
+// rmcpPlusSessionSize is the size of the session header without OEM fields
+const rmcpPlusSessionSize = 12
+
+func rmcpPlusFromBytes(buf []byte) (*rmcpPlusMessage, error) {
+	if len(buf) < rmcpHeaderSize+rmcpPlusSessionSize {
+		return nil, ErrShortPacket
+	}
+	if buf[rmcpHeaderSize] != authTypeRMCPPlus {
+		return nil, ErrInvalidPacket
+	}
+
+	m := &rmcpPlusMessage{PayloadType: buf[rmcpHeaderSize+1]}
+	off := rmcpHeaderSize + 2
+	if m.PayloadType&payloadTypeMask == PayloadTypeOEM {
+		off += 6 // OEM IANA and payload ID
+	}
+	if len(buf) < off+10 {
+		return nil, ErrShortPacket
+	}
+	m.SessionID = binary.LittleEndian.Uint32(buf[off:])
+	m.Sequence = binary.LittleEndian.Uint32(buf[off+4:])
+	length := int(binary.LittleEndian.Uint16(buf[off+8:]))
+	off += 10
+	if len(buf) < off+length {
+		return nil, ErrShortPacket
+	}
+	m.Payload = buf[off : off+length]
+	off += length
+
+	if m.PayloadType&payloadAuthenticated != 0 {
+		// integrity pad, pad length and next header
+		pad := integrityPad(off - rmcpHeaderSize)
+		end := off + pad + 2
+		if len(buf) < end {
+			return nil, ErrShortPacket
+		}
+		if int(buf[end-2]) != pad || buf[end-1] != rmcpPlusNextHeader {
+			return nil, ErrInvalidPacket
+		}
+		m.signed = buf[rmcpHeaderSize:end]
+		m.authCode = buf[end:]
+	}
+
+	return m, nil
+}
+
+// integrityPad returns the number of pad bytes such that the signed part
+// of a message, through the pad length and next header, is a multiple of 4
+func integrityPad(n int) int {
+	return (4 - (n+2)%4) % 4
+}
+
+// toBytes encodes the message, encrypting and authenticating it with k
+// if the session algorithms require. k is nil outside of a session.
+func (m *rmcpPlusMessage) toBytes(k *rmcpPlusKeys) []byte {
+	payload := m.Payload
+	payloadType := m.PayloadType & payloadTypeMask
+	if k.encrypted() {
+		payload = k.encrypt(payload)
+		payloadType |= payloadEncrypted
+	}
+	if k.authenticated() {
+		payloadType |= payloadAuthenticated
+	}
+
+	buf := new(bytes.Buffer)
+	binaryWrite(buf, &rmcpHeader{Version: rmcpVersion1, RMCPSequenceNumber: 0xff, Class: rmcpClassIPMI})
+	binaryWrite(buf, struct {
+		AuthType    uint8
+		PayloadType uint8
+		SessionID   uint32
+		Sequence    uint32
+		Length      uint16
+	}{authTypeRMCPPlus, payloadType, m.SessionID, m.Sequence, uint16(len(payload))})
+	_, _ = buf.Write(payload)
+
+	if k.authenticated() {
+		pad := integrityPad(buf.Len() - rmcpHeaderSize)
+		_, _ = buf.Write(bytes.Repeat([]byte{0xff}, pad))
+		_, _ = buf.Write([]byte{uint8(pad), rmcpPlusNextHeader})
+		_, _ = buf.Write(k.authCode(buf.Bytes()[rmcpHeaderSize:]))
+	}
+
+	return buf.Bytes()
+}
+
+// open verifies the integrity of a received message and decrypts its
+// payload. The payload must be authenticated and encrypted exactly as
+// the session algorithms require.
+func (m *rmcpPlusMessage) open(k *rmcpPlusKeys) error {
+	if k.authenticated() != (m.PayloadType&payloadAuthenticated != 0) ||
+		k.encrypted() != (m.PayloadType&payloadEncrypted != 0) {
+		return ErrAuthCode
+	}
+
+	if k.authenticated() && !hmac.Equal(k.authCode(m.signed), m.authCode) {
+		return ErrAuthCode
+	}
+
+	if k.encrypted() {
+		payload, err := k.decrypt(m.Payload)
+		if err != nil {
+			return err
+		}
+		m.Payload = payload
+	}
+
+	return nil
+}
+
+// rmcpPlusIPMIFromBytes decodes the IPMI message of an RMCP+ payload,
+// which has no session header fields and no message length
+func rmcpPlusIPMIFromBytes(p *rmcpPlusMessage) (*Message, error) {
+	buf := p.Payload
+	if len(buf) < ipmiHeaderSize {
+		return nil, ErrShortPacket
+	}
+
+	m := &Message{
+		rmcpHeader: &rmcpHeader{Version: rmcpVersion1, RMCPSequenceNumber: 0xff, Class: rmcpClassIPMI},
+		ipmiSession: &ipmiSession{
+			AuthType:  authTypeRMCPPlus,
+			Sequence:  p.Sequence,
+			SessionID: p.SessionID,
+		},
+		ipmiHeader: &ipmiHeader{
+			RsAddr:     buf[0],
+			NetFnRsLUN: buf[1],
+			Checksum:   buf[2],
+			RqAddr:     buf[3],
+			RqSeq:      buf[4],
+			Command:    Command(buf[5]),
+		},
+	}
+	if m.headerChecksum() != m.Checksum {
+		return nil, ErrInvalidPacket
+	}
+
+	m.Data = buf[6 : len(buf)-1]
+	if m.payloadChecksum(m.Data) != buf[len(buf)-1] {
+		return nil, ErrInvalidPacket
+	}
+
+	return m, nil
+}
+
+// payloadBytes encodes the IPMI message as an RMCP+ payload
+func (m *Message) payloadBytes(data interface{}) ([]byte, error) {
+	dbuf, err := messageDataToBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	m.Checksum = m.headerChecksum()
+
+	buf := []byte{m.RsAddr, m.NetFnRsLUN, m.Checksum, m.RqAddr, m.RqSeq, uint8(m.Command)}
+	buf = append(buf, dbuf...)
+	return append(buf, m.payloadChecksum(dbuf)), nil
+}
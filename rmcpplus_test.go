@@ -0,0 +1,255 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRAKP(suite cipherSuite) *rakp {
+	return &rakp{
+		suite:         suite,
+		consoleID:     0xa0a2a3a4,
+		bmcID:         0x02000300,
+		consoleRandom: [16]uint8{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		bmcRandom:     [16]uint8{16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1},
+		role:          PrivLevelAdmin | rakpNameOnlyLookup,
+		username:      "admin",
+		kuid:          rakpKey("secret"),
+		kg:            rakpKey("secret"),
+	}
+}
+
+func TestRAKP(t *testing.T) {
+	tests := []struct {
+		suite    uint8
+		authCode int
+		icv      int
+		key      int
+	}{
+		{0, 0, 0, 0},
+		{3, 20, 12, 20},
+		{17, 32, 16, 32},
+	}
+
+	for _, test := range tests {
+		suite := cipherSuites[0]
+		for _, s := range cipherSuites {
+			if s.id == test.suite {
+				suite = s
+			}
+		}
+		r := testRAKP(suite)
+
+		assert.Equal(t, test.authCode, len(r.bmcAuthCode()))
+		assert.Equal(t, test.authCode, len(r.consoleAuthCode()))
+		if test.authCode > 0 {
+			assert.NotEqual(t, r.bmcAuthCode(), r.consoleAuthCode())
+		}
+		assert.Equal(t, test.icv, len(r.integrityCheck()))
+
+		k := r.keys()
+		assert.Equal(t, test.key, len(k.k1))
+		assert.Equal(t, test.key, len(k.k2))
+
+		// every value exchanged is authenticated
+		other := testRAKP(suite)
+		other.role = PrivLevelUser
+		if test.authCode > 0 {
+			assert.NotEqual(t, r.bmcAuthCode(), other.bmcAuthCode())
+			assert.NotEqual(t, r.integrityCheck(), other.integrityCheck())
+		}
+
+		// the BMC key replaces the password in the session keys only
+		other = testRAKP(suite)
+		other.kg = rakpKey("kg")
+		assert.Equal(t, r.bmcAuthCode(), other.bmcAuthCode())
+		if test.key > 0 {
+			assert.NotEqual(t, r.keys().k1, other.keys().k1)
+		}
+	}
+
+	_, ok := findCipherSuite(authRAKPHMACSHA1, integrityHMACSHA256, confidentialityNone)
+	assert.False(t, ok)
+}
+
+// TestRAKPKnownAnswers checks the values of testRAKP against vectors computed
+// independently with Python's hmac module, per sections 13.31 and 13.32 as
+// implemented by ipmitool's lanplus_crypt.c
+func TestRAKPKnownAnswers(t *testing.T) {
+	tests := []struct {
+		suite                  uint8
+		rakp2, rakp3, sik, icv string
+		k1, k2                 string
+	}{
+		{
+			3,
+			"c69454381b4d1f0cda099a90e1ecf6f327d33860",
+			"dd8b2787404e89d103cb6855a68f66bbf70497c8",
+			"af9822dbf10ae0b46964dddbcd61dee328350de0",
+			"0e5411cef67f34b7caacd6c8",
+			"4f09bd762db24cc543900c8de448cdeb20396cac",
+			"32603c3e080d9a5018ed83fdbbefe7901e999d88",
+		},
+		{
+			17,
+			"a2060b728cf2f7403dc159ab37889b894f2757858415de1265abcf512b60a244",
+			"83a7c6caad4f3779bc1bb75a937aaf9a30fe4aacb54308bb1138a36c290a0a19",
+			"9a966adba4114a70287416ac64b3c3fdcad987b00ed07f31bba0c7a7013ff47e",
+			"b5e12cff370d5755125358a82eab1868",
+			"492f021f9ae08dd0d5087fe3e32463b8e7bb582630d0682f578f2fe013671251",
+			"7d07219cfde43634da23be8036eaf2f1c7a0ad585ca29ba24e583f08bbcc251d",
+		},
+	}
+
+	for _, test := range tests {
+		var r *rakp
+		for _, s := range cipherSuites {
+			if s.id == test.suite {
+				r = testRAKP(s)
+			}
+		}
+		k := r.keys()
+		assert.Equal(t, test.rakp2, hex.EncodeToString(r.bmcAuthCode()), "suite %d", test.suite)
+		assert.Equal(t, test.rakp3, hex.EncodeToString(r.consoleAuthCode()), "suite %d", test.suite)
+		assert.Equal(t, test.sik, hex.EncodeToString(r.sik()), "suite %d", test.suite)
+		assert.Equal(t, test.icv, hex.EncodeToString(r.integrityCheck()), "suite %d", test.suite)
+		assert.Equal(t, test.k1, hex.EncodeToString(k.k1), "suite %d", test.suite)
+		assert.Equal(t, test.k2, hex.EncodeToString(k.k2), "suite %d", test.suite)
+	}
+}
+
+func TestRMCPPlusMessage(t *testing.T) {
+	for _, suite := range cipherSuites {
+		k := testRAKP(suite).keys()
+
+		for n := 0; n < 40; n++ {
+			payload := make([]byte, n)
+			for i := range payload {
+				payload[i] = uint8(i)
+			}
+			m := &rmcpPlusMessage{
+				PayloadType: PayloadTypeIPMI,
+				SessionID:   0x11223344,
+				Sequence:    uint32(n + 1),
+				Payload:     payload,
+			}
+			buf := m.toBytes(k)
+			if k.authenticated() {
+				assert.Equal(t, 0, (len(buf)-rmcpHeaderSize-len(k.authCode(nil)))%4)
+			}
+
+			out, err := rmcpPlusFromBytes(buf)
+			assert.NoError(t, err)
+			assert.NoError(t, out.open(k))
+			assert.Equal(t, m.SessionID, out.SessionID)
+			assert.Equal(t, m.Sequence, out.Sequence)
+			assert.Equal(t, payload, out.Payload)
+		}
+
+		if !k.authenticated() {
+			continue
+		}
+
+		buf := (&rmcpPlusMessage{Payload: []byte{1, 2, 3}}).toBytes(k)
+		buf[len(buf)-1] ^= 0x01
+		m, err := rmcpPlusFromBytes(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, ErrAuthCode, m.open(k))
+
+		// the session algorithms are required
+		buf = (&rmcpPlusMessage{Payload: []byte{1, 2, 3}}).toBytes(nil)
+		m, err = rmcpPlusFromBytes(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, ErrAuthCode, m.open(k))
+	}
+
+	_, err := rmcpPlusFromBytes([]byte{0x06, 0x00, 0xff, 0x07, 0x06})
+	assert.Equal(t, ErrShortPacket, err)
+	_, err = rmcpPlusFromBytes([]byte{0x06, 0x00, 0xff, 0x07, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	assert.Equal(t, ErrInvalidPacket, err)
+	_, err = rmcpPlusFromBytes([]byte{0x06, 0x00, 0xff, 0x07, 0x06, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0x10, 0})
+	assert.Equal(t, ErrShortPacket, err)
+}
+
+func TestRMCPPlusDecrypt(t *testing.T) {
+	k := testRAKP(cipherSuites[3]).keys()
+	buf := k.encrypt([]byte("console"))
+	assert.Equal(t, 32, len(buf))
+
+	plain, err := k.decrypt(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("console"), plain)
+
+	_, err = k.decrypt(buf[:16])
+	assert.Equal(t, ErrInvalidPacket, err)
+	_, err = k.decrypt(buf[:31])
+	assert.Equal(t, ErrInvalidPacket, err)
+	// the IV is XORed into the single block, corrupting its pad length
+	buf[15] ^= 0xff
+	_, err = k.decrypt(buf)
+	assert.Equal(t, ErrInvalidPacket, err)
+	buf[15] ^= 0xff
+	buf[14] ^= 0x01
+	_, err = k.decrypt(buf)
+	assert.Equal(t, ErrInvalidPacket, err)
+}
+
+func TestRMCPPlusIPMI(t *testing.T) {
+	m := &Message{
+		ipmiSession: &ipmiSession{},
+		ipmiHeader:  &ipmiHeader{RsAddr: 0x20, NetFnRsLUN: uint8(NetworkFunctionApp) << 2, RqAddr: 0x81, RqSeq: 0x04, Command: CommandGetDeviceID},
+	}
+	buf := mustBytes(m.payloadBytes(&DeviceIDRequest{}))
+	assert.Equal(t, []byte{0x20, 0x18, 0xc8, 0x81, 0x04, 0x01, 0x7a}, buf)
+
+	out, err := rmcpPlusIPMIFromBytes(&rmcpPlusMessage{SessionID: 1, Sequence: 2, Payload: buf})
+	assert.NoError(t, err)
+	assert.Equal(t, NetworkFunctionApp, out.NetFn())
+	assert.Equal(t, CommandGetDeviceID, out.Command)
+	assert.Equal(t, uint32(1), out.SessionID)
+	assert.Empty(t, out.Data)
+
+	buf[6]++
+	_, err = rmcpPlusIPMIFromBytes(&rmcpPlusMessage{Payload: buf})
+	assert.Equal(t, ErrInvalidPacket, err)
+	_, err = rmcpPlusIPMIFromBytes(&rmcpPlusMessage{Payload: buf[:3]})
+	assert.Equal(t, ErrShortPacket, err)
+}
+
+func TestRAKPMessages(t *testing.T) {
+	// error responses end after the console session ID
+	buf, err := Marshal(&OpenSessionResponse{MessageTag: 1, Status: rakpStatusNoCipherSuiteMatch, ConsoleSessionID: 0x04030201})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, rakpStatusNoCipherSuiteMatch, 0, 0, 1, 2, 3, 4}, buf)
+	buf, err = Marshal(&RAKPMessage2{Status: rakpStatusUnauthorizedName})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, len(buf))
+
+	res := &OpenSessionResponse{}
+	assert.NoError(t, Unmarshal(buf, res))
+
+	buf, err = Marshal(&RAKPMessage1{BMCSessionID: 2, Role: PrivLevelAdmin, UsernameLength: 5, Username: "admin"})
+	assert.NoError(t, err)
+	assert.Equal(t, 28+5, len(buf))
+	req := &RAKPMessage1{}
+	assert.NoError(t, Unmarshal(buf, req))
+	assert.Equal(t, "admin", req.Username)
+}
@@ -0,0 +1,381 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SDR record types per section 43
+const (
+	SDRTypeFullSensor    = 0x01
+	SDRTypeCompactSensor = 0x02
+)
+
+// sdrHeaderSize is the size of the header common to all SDRs per section 43
+const sdrHeaderSize = 5
+
+// SDRRepositoryInfoRequest per section 33.9
+type SDRRepositoryInfoRequest struct{}
+
+// SDRRepositoryInfoResponse per section 33.9
+type SDRRepositoryInfoResponse struct {
+	CompletionCode
+	Version            uint8
+	Records            uint16
+	FreeSpace          uint16
+	LastAddTimestamp   uint32
+	LastEraseTimestamp uint32
+	OperationSupport   uint8
+}
+
+// ReserveSDRRepositoryRequest per section 33.11
+type ReserveSDRRepositoryRequest struct{}
+
+// ReserveSDRRepositoryResponse per section 33.11
+type ReserveSDRRepositoryResponse struct {
+	CompletionCode
+	ReservationID uint16
+}
+
+// GetSDRRequest per section 33.12
+type GetSDRRequest struct {
+	ReservationID uint16
+	RecordID      uint16
+	Offset        uint8
+	Length        uint8
+}
+
+// GetSDRResponse per section 33.12
+type GetSDRResponse struct {
+	CompletionCode
+	NextRecordID uint16
+	Data         []uint8
+}
+
+// SensorReadingRequest per section 35.14
+type SensorReadingRequest struct {
+	SensorNumber uint8
+}
+
+// SensorReadingResponse per section 35.14
+type SensorReadingResponse struct {
+	CompletionCode
+	Reading uint8
+	Flags   uint8
+	// State is the threshold comparison status or the discrete state bits
+	State [2]uint8
+}
+
+// UnmarshalBinary implementation to handle the optional State bytes
+func (r *SensorReadingResponse) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 3 {
+		return ErrShortPacket
+	}
+	r.CompletionCode = CompletionCode(buf[0])
+	r.Reading = buf[1]
+	r.Flags = buf[2]
+	r.State = [2]uint8{}
+	copy(r.State[:], buf[3:])
+	return nil
+}
+
+// Unavailable returns true if the sensor has no valid reading
+func (r *SensorReadingResponse) Unavailable() bool {
+	return r.Flags&0x20 != 0 || r.Flags&0x40 == 0
+}
+
+// Threshold comparison status bits per section 35.14
+const (
+	ThresholdLowerNonCritical    = 0x01
+	ThresholdLowerCritical       = 0x02
+	ThresholdLowerNonRecoverable = 0x04
+	ThresholdUpperNonCritical    = 0x08
+	ThresholdUpperCritical       = 0x10
+	ThresholdUpperNonRecoverable = 0x20
+)
+
+// SDR is a Full or Compact Sensor Record per sections 43.1 and 43.2
+type SDR struct {
+	RecordID     uint16
+	RecordType   uint8
+	OwnerID      uint8
+	OwnerLUN     uint8
+	SensorNumber uint8
+	EntityID     uint8
+	Instance     uint8
+	SensorType   SensorType
+	// EventType is the Event/Reading Type code
+	EventType uint8
+	Units1    uint8
+	BaseUnit  uint8
+	// Reading conversion factors, Full Sensor Records only
+	M    int16
+	B    int16
+	BExp int8
+	RExp int8
+	Name string
+}
+
+// UnmarshalBinary implementation to parse Full and Compact Sensor Records
+func (r *SDR) UnmarshalBinary(buf []byte) error {
+	if len(buf) < sdrHeaderSize {
+		return ErrShortPacket
+	}
+	r.RecordID = binary.LittleEndian.Uint16(buf[0:])
+	r.RecordType = buf[3]
+
+	var idOffset int
+	switch r.RecordType {
+	case SDRTypeFullSensor:
+		idOffset = 47
+	case SDRTypeCompactSensor:
+		idOffset = 31
+	default:
+		return nil
+	}
+	if len(buf) < idOffset+1 {
+		return ErrShortPacket
+	}
+
+	r.OwnerID = buf[5]
+	r.OwnerLUN = buf[6] & 3
+	r.SensorNumber = buf[7]
+	r.EntityID = buf[8]
+	r.Instance = buf[9]
+	r.SensorType = SensorType(buf[12])
+	r.EventType = buf[13]
+	r.Units1 = buf[20]
+	r.BaseUnit = buf[21]
+
+	if r.RecordType == SDRTypeFullSensor {
+		r.M = signExtend(uint16(buf[24])|uint16(buf[25]&0xc0)<<2, 10)
+		r.B = signExtend(uint16(buf[26])|uint16(buf[27]&0xc0)<<2, 10)
+		r.RExp = int8(signExtend(uint16(buf[29]>>4), 4))
+		r.BExp = int8(signExtend(uint16(buf[29]&0x0f), 4))
+	}
+
+	n := int(buf[idOffset] & 0x1f)
+	id := buf[idOffset+1:]
+	if n < len(id) {
+		id = id[:n]
+	}
+	r.Name = strings.TrimRight(string(id), "\000 ")
+
+	return nil
+}
+
+// sdrNameSize is the maximum length of the ID string of a sensor record
+const sdrNameSize = 16
+
+// MarshalBinary implementation to encode Full and Compact Sensor Records
+func (r *SDR) MarshalBinary() ([]byte, error) {
+	var idOffset int
+	switch r.RecordType {
+	case SDRTypeFullSensor:
+		idOffset = 47
+	case SDRTypeCompactSensor:
+		idOffset = 31
+	default:
+		return nil, fmt.Errorf("unsupported SDR type 0x%02x", r.RecordType)
+	}
+
+	name := r.Name
+	if len(name) > sdrNameSize {
+		name = name[:sdrNameSize]
+	}
+
+	buf := make([]byte, idOffset+1, idOffset+1+len(name))
+	binary.LittleEndian.PutUint16(buf[0:], r.RecordID)
+	buf[2] = 0x51 // SDR version
+	buf[3] = r.RecordType
+	buf[5] = r.OwnerID
+	buf[6] = r.OwnerLUN & 3
+	buf[7] = r.SensorNumber
+	buf[8] = r.EntityID
+	buf[9] = r.Instance
+	buf[12] = uint8(r.SensorType)
+	buf[13] = r.EventType
+	buf[20] = r.Units1
+	buf[21] = r.BaseUnit
+
+	if r.RecordType == SDRTypeFullSensor {
+		buf[24] = uint8(r.M)
+		buf[25] = uint8(uint16(r.M)>>8) << 6
+		buf[26] = uint8(r.B)
+		buf[27] = uint8(uint16(r.B)>>8) << 6
+		buf[29] = uint8(r.RExp)<<4 | uint8(r.BExp)&0x0f
+	}
+
+	buf[idOffset] = 0xc0 | uint8(len(name)) // 8-bit ASCII
+	buf = append(buf, name...)
+	buf[4] = uint8(len(buf) - sdrHeaderSize)
+
+	return buf, nil
+}
+
+func signExtend(v uint16, bits uint) int16 {
+	shift := 16 - bits
+	return int16(v<<shift) >> shift
+}
+
+// IsSensor returns true for Full and Compact Sensor Records
+func (r *SDR) IsSensor() bool {
+	return r.RecordType == SDRTypeFullSensor || r.RecordType == SDRTypeCompactSensor
+}
+
+// IsThreshold returns true if the sensor has a threshold based reading
+func (r *SDR) IsThreshold() bool {
+	return r.EventType == EventTypeThreshold
+}
+
+// Convert a raw reading to a value in Units per section 36.3.
+// Only linear Full Sensor Records are converted, others return the raw value.
+func (r *SDR) Convert(raw uint8) float64 {
+	if r.RecordType != SDRTypeFullSensor {
+		return float64(raw)
+	}
+
+	var x float64
+	switch r.Units1 >> 6 {
+	case 1: // 1's complement
+		v := int8(raw)
+		if v < 0 {
+			v++
+		}
+		x = float64(v)
+	case 2: // 2's complement
+		x = float64(int8(raw))
+	default:
+		x = float64(raw)
+	}
+
+	return (float64(r.M)*x + float64(r.B)*math.Pow10(int(r.BExp))) * math.Pow10(int(r.RExp))
+}
+
+// raw converts a value in Units to a raw reading, the inverse of Convert.
+// Values out of the range of the reading format are clamped.
+func (r *SDR) raw(value float64) uint8 {
+	x := value
+	if r.RecordType == SDRTypeFullSensor {
+		x = value/math.Pow10(int(r.RExp)) - float64(r.B)*math.Pow10(int(r.BExp))
+		if r.M != 0 {
+			x /= float64(r.M)
+		}
+	}
+	x = math.Round(x)
+
+	switch r.Units1 >> 6 {
+	case 1: // 1's complement
+		v := int8(math.Max(-127, math.Min(127, x)))
+		if v < 0 {
+			v--
+		}
+		return uint8(v)
+	case 2: // 2's complement
+		return uint8(int8(math.Max(-128, math.Min(127, x))))
+	default:
+		return uint8(math.Max(0, math.Min(255, x)))
+	}
+}
+
+// Units returns the name of the base unit, as printed by ipmitool
+func (r *SDR) Units() string {
+	if !r.IsThreshold() {
+		return "discrete"
+	}
+	if r.Units1&0x01 != 0 {
+		return "percent"
+	}
+	if int(r.BaseUnit) < len(sensorUnits) {
+		return sensorUnits[r.BaseUnit]
+	}
+	return "unspecified"
+}
+
+// Sensor unit type codes per section 43.17
+var sensorUnits = []string{
+	"unspecified", "degrees C", "degrees F", "degrees K", "Volts", "Amps",
+	"Watts", "Joules", "Coulombs", "VA", "Nits", "lumen", "lux", "Candela",
+	"kPa", "PSI", "Newton", "CFM", "RPM", "Hz", "microsecond", "millisecond",
+	"second", "minute", "hour", "day", "week", "mil", "inches", "feet",
+	"cu in", "cu feet", "mm", "cm", "m", "cu cm", "cu m", "liters",
+	"fluid ounce", "radians", "steradians", "revolutions", "cycles",
+	"gravities", "ounce", "pound", "ft-lb", "oz-in", "gauss", "gilberts",
+	"henry", "millihenry", "farad", "microfarad", "ohms", "siemens", "mole",
+	"becquerel", "PPM", "reserved", "Decibels", "DbA", "DbC", "gray",
+	"sievert", "color temp deg K", "bit", "kilobit", "megabit", "gigabit",
+	"byte", "kilobyte", "megabyte", "gigabyte", "word", "dword", "qword",
+	"line", "hit", "miss", "retry", "reset", "overflow", "underrun",
+	"collision", "packets", "messages", "characters", "error",
+	"correctable error", "uncorrectable error", "fatal error", "grams",
+}
+
+// SensorReading is the current reading of a sensor, as listed by
+// ipmitool sensor list
+type SensorReading struct {
+	Name  string
+	Value float64
+	Units string
+	// Status of a threshold sensor is one of "ok", "nc", "cr" or "nr",
+	// "na" if there is no reading. The Status of a discrete sensor is
+	// its state bits in hex.
+	Status string
+	// State of a discrete sensor, bit n is set if state n is asserted
+	State uint16
+}
+
+// Available returns true if the sensor has a reading
+func (s *SensorReading) Available() bool {
+	return s.Status != "na"
+}
+
+func newSensorReading(sdr *SDR, res *SensorReadingResponse) *SensorReading {
+	s := &SensorReading{
+		Name:  sdr.Name,
+		Units: sdr.Units(),
+	}
+
+	switch {
+	case res.Unavailable():
+		s.Status = "na"
+	case !sdr.IsThreshold():
+		s.Value = float64(res.Reading)
+		s.State = uint16(res.State[1])<<8 | uint16(res.State[0])
+		s.Status = fmt.Sprintf("0x%02x%02x", res.State[0], res.State[1])
+	default:
+		s.Value = sdr.Convert(res.Reading)
+		s.Status = thresholdStatus(res.State[0])
+	}
+
+	return s
+}
+
+func thresholdStatus(state uint8) string {
+	switch {
+	case state&(ThresholdLowerNonRecoverable|ThresholdUpperNonRecoverable) != 0:
+		return "nr"
+	case state&(ThresholdLowerCritical|ThresholdUpperCritical) != 0:
+		return "cr"
+	case state&(ThresholdLowerNonCritical|ThresholdUpperNonCritical) != 0:
+		return "nc"
+	}
+	return "ok"
+}
@@ -0,0 +1,172 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testFullSensorRecord returns a Full Sensor Record, with a linear
+// conversion of y = (2x + 10) * 10^-1
+func testFullSensorRecord(number uint8, name string) []byte {
+	buf := make([]byte, 48, 48+len(name))
+	buf[0] = number // record ID
+	buf[2] = 0x51
+	buf[3] = SDRTypeFullSensor
+	buf[5] = 0x20
+	buf[7] = number
+	buf[12] = 0x01 // temperature
+	buf[13] = EventTypeThreshold
+	buf[21] = 1 // degrees C
+	buf[24] = 2
+	buf[26] = 10
+	buf[29] = 0xf0 // R exp -1
+	buf[47] = 0xc0 | uint8(len(name))
+	buf = append(buf, name...)
+	buf[4] = uint8(len(buf) - sdrHeaderSize)
+	return buf
+}
+
+func TestSDR(t *testing.T) {
+	sdr := &SDR{}
+	err := sdr.UnmarshalBinary(testFullSensorRecord(0x30, "CPU Temp"))
+	assert.NoError(t, err)
+	assert.True(t, sdr.IsSensor())
+	assert.True(t, sdr.IsThreshold())
+	assert.Equal(t, uint8(0x30), sdr.SensorNumber)
+	assert.Equal(t, "CPU Temp", sdr.Name)
+	assert.Equal(t, "Temperature", sdr.SensorType.String())
+	assert.Equal(t, "degrees C", sdr.Units())
+	assert.Equal(t, int16(2), sdr.M)
+	assert.Equal(t, int8(-1), sdr.RExp)
+	assert.InDelta(t, 9.0, sdr.Convert(40), 0.001)
+
+	// negative M and signed readings
+	buf := testFullSensorRecord(0x31, "Delta")
+	buf[20] = 0x80 // 2's complement
+	buf[25] = 0xc0
+	buf[24] = 0xff // M = -1
+	buf[26] = 0
+	buf[29] = 0
+	err = sdr.UnmarshalBinary(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int16(-1), sdr.M)
+	assert.InDelta(t, 5.0, sdr.Convert(0xfb), 0.001)
+
+	err = sdr.UnmarshalBinary(buf[:20])
+	assert.Equal(t, ErrShortPacket, err)
+}
+
+func TestSDRMarshal(t *testing.T) {
+	buf := testFullSensorRecord(0x30, "CPU Temp")
+	sdr := &SDR{}
+	assert.NoError(t, sdr.UnmarshalBinary(buf))
+	out, err := sdr.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, buf, out)
+
+	tests := []*SDR{
+		{RecordID: 2, RecordType: SDRTypeFullSensor, SensorNumber: 1, M: -300, B: 511, BExp: -2, RExp: 3, Name: "Negative"},
+		{RecordID: 3, RecordType: SDRTypeCompactSensor, OwnerID: 0x20, SensorNumber: 2, SensorType: 0x04, EventType: EventTypeSensorSpecific, Name: "Fan Redundancy"},
+	}
+	for _, test := range tests {
+		buf, err := test.MarshalBinary()
+		assert.NoError(t, err)
+		sdr := &SDR{}
+		assert.NoError(t, sdr.UnmarshalBinary(buf))
+		assert.Equal(t, test, sdr)
+	}
+
+	sdr = &SDR{RecordType: SDRTypeFullSensor, Name: "A very long sensor name"}
+	buf, err = sdr.MarshalBinary()
+	assert.NoError(t, err)
+	assert.NoError(t, sdr.UnmarshalBinary(buf))
+	assert.Equal(t, "A very long sens", sdr.Name)
+
+	_, err = (&SDR{RecordType: 0x12}).MarshalBinary()
+	assert.Error(t, err)
+}
+
+func TestSDRRaw(t *testing.T) {
+	sdr := &SDR{}
+	_ = sdr.UnmarshalBinary(testFullSensorRecord(0x30, "CPU Temp"))
+
+	for _, raw := range []uint8{0, 40, 255} {
+		assert.Equal(t, raw, sdr.raw(sdr.Convert(raw)))
+	}
+	assert.Equal(t, uint8(255), sdr.raw(1000))
+	assert.Equal(t, uint8(0), sdr.raw(-1000))
+
+	for _, units := range []uint8{0x40, 0x80} {
+		sdr.Units1 = units
+		for _, raw := range []uint8{0, 0x10, 0xf0} {
+			assert.Equal(t, raw, sdr.raw(sdr.Convert(raw)), "units 0x%02x raw 0x%02x", units, raw)
+		}
+	}
+}
+
+func TestSensorReading(t *testing.T) {
+	sdr := &SDR{}
+	_ = sdr.UnmarshalBinary(testFullSensorRecord(0x30, "CPU Temp"))
+
+	tests := []struct {
+		res    *SensorReadingResponse
+		value  float64
+		status string
+	}{
+		{&SensorReadingResponse{Reading: 40, Flags: 0xc0}, 9.0, "ok"},
+		{&SensorReadingResponse{Reading: 40, Flags: 0xc0, State: [2]uint8{ThresholdUpperNonCritical}}, 9.0, "nc"},
+		{&SensorReadingResponse{Reading: 40, Flags: 0xc0, State: [2]uint8{0x18}}, 9.0, "cr"},
+		{&SensorReadingResponse{Reading: 40, Flags: 0xc0, State: [2]uint8{ThresholdLowerNonRecoverable}}, 9.0, "nr"},
+		{&SensorReadingResponse{Reading: 40, Flags: 0xe0}, 0, "na"},
+		{&SensorReadingResponse{Reading: 40, Flags: 0x80}, 0, "na"},
+	}
+
+	for _, test := range tests {
+		s := newSensorReading(sdr, test.res)
+		assert.Equal(t, "CPU Temp", s.Name)
+		assert.InDelta(t, test.value, s.Value, 0.001)
+		assert.Equal(t, test.status, s.Status)
+		assert.Equal(t, test.status != "na", s.Available())
+	}
+
+	sdr.EventType = EventTypeSensorSpecific
+	s := newSensorReading(sdr, &SensorReadingResponse{Flags: 0xc0, State: [2]uint8{0x80, 0x01}})
+	assert.Equal(t, "discrete", s.Units)
+	assert.Equal(t, "0x8001", s.Status)
+	assert.Equal(t, uint16(0x0180), s.State)
+}
+
+func FuzzSDR(f *testing.F) {
+	f.Add(testFullSensorRecord(0x30, "CPU Temp"))
+	compact := testFullSensorRecord(0x31, "Fan")[:32]
+	compact[3] = SDRTypeCompactSensor
+	f.Add(compact)
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		sdr := &SDR{}
+		if sdr.UnmarshalBinary(buf) != nil {
+			return
+		}
+		_ = sdr.Convert(0x80)
+		_ = sdr.Units()
+		_ = sdr.SensorType.String()
+		_ = newSensorReading(sdr, &SensorReadingResponse{Flags: 0xc0, State: [2]uint8{0xff, 0xff}})
+	})
+}
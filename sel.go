@@ -0,0 +1,223 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// SensorType per section 42.2, table 42-3
+type SensorType uint8
+
+var sensorTypeStrings = map[SensorType]string{
+	0x01: "Temperature",
+	0x02: "Voltage",
+	0x03: "Current",
+	0x04: "Fan",
+	0x05: "Physical Security",
+	0x06: "Platform Security",
+	0x07: "Processor",
+	0x08: "Power Supply",
+	0x09: "Power Unit",
+	0x0a: "Cooling Device",
+	0x0b: "Other",
+	0x0c: "Memory",
+	0x0d: "Drive Slot / Bay",
+	0x0e: "POST Memory Resize",
+	0x0f: "System Firmware Progress",
+	0x10: "Event Logging Disabled",
+	0x11: "Watchdog1",
+	0x12: "System Event",
+	0x13: "Critical Interrupt",
+	0x14: "Button",
+	0x15: "Module / Board",
+	0x16: "Microcontroller",
+	0x17: "Add-in Card",
+	0x18: "Chassis",
+	0x19: "Chip Set",
+	0x1a: "Other FRU",
+	0x1b: "Cable / Interconnect",
+	0x1c: "Terminator",
+	0x1d: "System Boot Initiated",
+	0x1e: "Boot Error",
+	0x1f: "OS Boot",
+	0x20: "OS Critical Stop",
+	0x21: "Slot / Connector",
+	0x22: "System ACPI Power State",
+	0x23: "Watchdog2",
+	0x24: "Platform Alert",
+	0x25: "Entity Presence",
+	0x26: "Monitor ASIC",
+	0x27: "LAN",
+	0x28: "Management Subsys Health",
+	0x29: "Battery",
+	0x2a: "Session Audit",
+	0x2b: "Version Change",
+	0x2c: "FRU State",
+}
+
+func (t SensorType) String() string {
+	if s, ok := sensorTypeStrings[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown (0x%02x)", uint8(t))
+}
+
+// Event/Reading Type codes per section 42.1
+const (
+	EventTypeThreshold      = 0x01
+	EventTypeSensorSpecific = 0x6f
+)
+
+// selRecordSize is the size of every SEL record per section 32
+const selRecordSize = 16
+
+// SELEntry is a System Event Log record per section 32.1
+type SELEntry struct {
+	RecordID     uint16
+	RecordType   uint8
+	Timestamp    time.Time
+	GeneratorID  uint16
+	EvMRev       uint8
+	SensorType   SensorType
+	SensorNumber uint8
+	// EventType is the Event/Reading Type code
+	EventType uint8
+	// Deassertion is true for deassertion events
+	Deassertion bool
+	EventData   [3]uint8
+}
+
+// UnmarshalBinary implementation to parse a standard or OEM SEL record
+func (e *SELEntry) UnmarshalBinary(buf []byte) error {
+	if len(buf) < selRecordSize {
+		return ErrShortPacket
+	}
+	e.RecordID = binary.LittleEndian.Uint16(buf[0:])
+	e.RecordType = buf[2]
+	e.Timestamp = time.Unix(int64(binary.LittleEndian.Uint32(buf[3:])), 0).UTC()
+	if e.RecordType >= 0xe0 {
+		// OEM non-timestamped records have no standard fields
+		e.Timestamp = time.Time{}
+		return nil
+	}
+	e.GeneratorID = binary.LittleEndian.Uint16(buf[7:])
+	e.EvMRev = buf[9]
+	e.SensorType = SensorType(buf[10])
+	e.SensorNumber = buf[11]
+	e.EventType = buf[12] & 0x7f
+	e.Deassertion = buf[12]&0x80 != 0
+	copy(e.EventData[:], buf[13:16])
+	return nil
+}
+
+// MarshalBinary implementation to encode a standard SEL record
+func (e *SELEntry) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, selRecordSize)
+	binary.LittleEndian.PutUint16(buf[0:], e.RecordID)
+	buf[2] = e.RecordType
+	if !e.Timestamp.IsZero() {
+		binary.LittleEndian.PutUint32(buf[3:], uint32(e.Timestamp.Unix()))
+	}
+	binary.LittleEndian.PutUint16(buf[7:], e.GeneratorID)
+	buf[9] = e.EvMRev
+	buf[10] = uint8(e.SensorType)
+	buf[11] = e.SensorNumber
+	buf[12] = e.EventType & 0x7f
+	if e.Deassertion {
+		buf[12] |= 0x80
+	}
+	copy(buf[13:], e.EventData[:])
+	return buf, nil
+}
+
+// SELInfoRequest per section 31.2
+type SELInfoRequest struct{}
+
+// SELInfoResponse per section 31.2
+type SELInfoResponse struct {
+	CompletionCode
+	Version            uint8
+	Entries            uint16
+	FreeSpace          uint16
+	LastAddTimestamp   uint32
+	LastEraseTimestamp uint32
+	OperationSupport   uint8
+}
+
+// ReserveSELRequest per section 31.4
+type ReserveSELRequest struct{}
+
+// ReserveSELResponse per section 31.4
+type ReserveSELResponse struct {
+	CompletionCode
+	ReservationID uint16
+}
+
+// GetSELEntryRequest per section 31.5
+type GetSELEntryRequest struct {
+	ReservationID uint16
+	RecordID      uint16
+	Offset        uint8
+	Length        uint8
+}
+
+// GetSELEntryResponse per section 31.5
+type GetSELEntryResponse struct {
+	CompletionCode
+	NextRecordID uint16
+	Data         []uint8
+}
+
+// AddSELEntryRequest per section 31.6
+type AddSELEntryRequest struct {
+	Record [selRecordSize]uint8
+}
+
+// AddSELEntryResponse per section 31.6
+type AddSELEntryResponse struct {
+	CompletionCode
+	RecordID uint16
+}
+
+// Clear SEL actions and erasure progress per section 31.9
+const (
+	ClearSELGetStatus = 0x00
+	ClearSELInitiate  = 0xaa
+
+	ClearSELInProgress = 0x00
+	ClearSELCompleted  = 0x01
+)
+
+// clearSELSignature is the 'CLR' confirmation of a Clear SEL request
+var clearSELSignature = [3]uint8{'C', 'L', 'R'}
+
+// ClearSELRequest per section 31.9
+type ClearSELRequest struct {
+	ReservationID uint16
+	Signature     [3]uint8
+	Action        uint8
+}
+
+// ClearSELResponse per section 31.9
+type ClearSELResponse struct {
+	CompletionCode
+	Progress uint8 `ipmi:"bits=4"`
+	_        uint8 `ipmi:"bits=4"`
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSELEntry(t *testing.T) {
+	entry := &SELEntry{
+		RecordID:     0x0102,
+		RecordType:   0x02,
+		Timestamp:    time.Date(2020, time.May, 14, 8, 0, 0, 0, time.UTC),
+		GeneratorID:  0x0020,
+		EvMRev:       0x04,
+		SensorType:   0x01,
+		SensorNumber: 0x30,
+		EventType:    EventTypeThreshold,
+		Deassertion:  true,
+		EventData:    [3]uint8{0x57, 0x00, 0x00},
+	}
+
+	buf, err := entry.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, selRecordSize, len(buf))
+	assert.Equal(t, uint8(0x81), buf[12])
+
+	out := &SELEntry{}
+	err = out.UnmarshalBinary(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, entry, out)
+	assert.Equal(t, "Temperature", out.SensorType.String())
+
+	err = out.UnmarshalBinary(buf[:10])
+	assert.Equal(t, ErrShortPacket, err)
+}
+
+func TestClearSELRequest(t *testing.T) {
+	buf, err := Marshal(&ClearSELRequest{ReservationID: 0x0102, Signature: clearSELSignature, Action: ClearSELInitiate})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x02, 0x01, 'C', 'L', 'R', 0xaa}, buf)
+
+	res := &ClearSELResponse{}
+	err = Unmarshal([]byte{0x00, 0x01}, res)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(ClearSELCompleted), res.Progress)
+}
+
+func FuzzSELEntry(f *testing.F) {
+	buf, _ := (&SELEntry{RecordID: 1, RecordType: 0x02}).MarshalBinary()
+	f.Add(buf)
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		entry := &SELEntry{}
+		if entry.UnmarshalBinary(buf) != nil {
+			return
+		}
+		_ = entry.SensorType.String()
+		_, _ = entry.MarshalBinary()
+	})
+}
@@ -0,0 +1,165 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// Session sequence number acceptance window sizes per section 6.12.13
+const (
+	seqWindowV15 = 8
+	seqWindowV20 = 32
+)
+
+// ErrAuthCode is returned when the auth code of a session message is not valid
+var ErrAuthCode = errors.New("invalid auth code")
+
+// SequenceError is returned when a session message is outside of the
+// sequence number acceptance window or has already been received
+type SequenceError struct {
+	Sequence uint32
+	Replay   bool
+}
+
+func (e *SequenceError) Error() string {
+	if e.Replay {
+		return fmt.Sprintf("replayed session sequence number: %d", e.Sequence)
+	}
+	return fmt.Sprintf("session sequence number out of window: %d", e.Sequence)
+}
+
+// sequenceWindow is the sliding window of acceptable inbound session
+// sequence numbers. Numbers up to size ahead of the highest received so
+// far move the window, numbers up to size behind it are accepted once.
+type sequenceWindow struct {
+	size uint32
+	last uint32
+	// bit n is set if last-n has been received
+	seen uint32
+}
+
+// newSequenceWindow accepts sequence numbers following last
+func newSequenceWindow(size, last uint32) *sequenceWindow {
+	return &sequenceWindow{
+		size: size,
+		last: last,
+		seen: ^uint32(0),
+	}
+}
+
+func (w *sequenceWindow) accept(seq uint32) error {
+	if seq == 0 {
+		// reserved for messages outside of a session
+		return &SequenceError{Sequence: seq}
+	}
+
+	if ahead := seq - w.last; ahead != 0 && ahead <= w.size {
+		w.seen = w.seen<<ahead | 1
+		w.last = seq
+		return nil
+	}
+
+	if behind := w.last - seq; behind < w.size {
+		bit := uint32(1) << behind
+		if w.seen&bit != 0 {
+			return &SequenceError{Sequence: seq, Replay: true}
+		}
+		w.seen |= bit
+		return nil
+	}
+
+	return &SequenceError{Sequence: seq}
+}
+
+// nextSequence increments a session sequence number, skipping 0 on wrap
+func nextSequence(seq uint32) uint32 {
+	seq++
+	if seq == 0 {
+		seq++
+	}
+	return seq
+}
+
+// authDigest per section 22.17.1
+func authDigest(authType uint8, password [16]uint8, sessionID uint32, data []uint8, seq uint32) []uint8 {
+	var h hash.Hash
+	if authType == AuthTypeMD2 {
+		h = newMD2()
+	} else {
+		h = md5.New()
+	}
+
+	binaryWrite(h, password)
+	binaryWrite(h, sessionID)
+	binaryWrite(h, data)
+	binaryWrite(h, seq)
+	binaryWrite(h, password)
+
+	return h.Sum(nil)
+}
+
+// authOffset is the location of the IPMI message (ipmiHeader.RsAddr)
+// within an authenticated session packet
+var authOffset = rmcpHeaderSize + ipmiSessionSize + len(Message{}.AuthCode) + 1
+
+// authData returns the IPMI message portion of the given packet, which
+// is the data covered by the MD2 and MD5 auth codes
+func (m *Message) authData(buf []byte) []byte {
+	if authOffset > len(buf) {
+		return nil
+	}
+	end := authOffset + int(m.MsgLen)
+	if end > len(buf) {
+		end = len(buf)
+	}
+	return buf[authOffset:end]
+}
+
+// authenticate rewrites the AuthCode field of the given packet
+// marshaled from this Message with the code for the message AuthType
+func (m *Message) authenticate(buf []byte, password [16]uint8) {
+	if m.AuthType == AuthTypeMD2 || m.AuthType == AuthTypeMD5 {
+		digest := authDigest(m.AuthType, password, m.SessionID, m.authData(buf), m.Sequence)
+		copy(buf[rmcpHeaderSize+ipmiSessionSize:], digest)
+	}
+}
+
+// verify the AuthCode of the given packet the Message was parsed from
+func (m *Message) verify(buf []byte, password [16]uint8) error {
+	var expect []uint8
+
+	switch m.AuthType {
+	case AuthTypeNone:
+		return nil
+	case AuthTypeMD2, AuthTypeMD5:
+		expect = authDigest(m.AuthType, password, m.SessionID, m.authData(buf), m.Sequence)
+	case AuthTypePassword:
+		expect = password[:]
+	default:
+		return ErrAuthCode
+	}
+
+	if subtle.ConstantTimeCompare(expect, m.AuthCode[:]) != 1 {
+		return ErrAuthCode
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequenceWindow(t *testing.T) {
+	w := newSequenceWindow(seqWindowV15, 100)
+
+	tests := []struct {
+		should string
+		seq    uint32
+		replay bool
+		err    bool
+	}{
+		{"should reject the last sequence number", 100, true, true},
+		{"should reject numbers before the window", 90, false, true},
+		{"should accept the next number", 101, false, false},
+		{"should accept numbers ahead within the window", 105, false, false},
+		{"should accept skipped numbers behind", 103, false, false},
+		{"should reject replays", 103, true, true},
+		{"should reject replays of the last number", 105, true, true},
+		{"should reject numbers too far ahead", 114, false, true},
+		{"should reject numbers too far behind", 97, false, true},
+		{"should reject 0", 0, false, true},
+	}
+
+	for _, test := range tests {
+		err := w.accept(test.seq)
+		if !test.err {
+			assert.NoError(t, err, test.should)
+			continue
+		}
+		if assert.IsType(t, &SequenceError{}, err, test.should) {
+			assert.Equal(t, test.replay, err.(*SequenceError).Replay, test.should)
+			assert.Equal(t, test.seq, err.(*SequenceError).Sequence, test.should)
+		}
+	}
+
+	w = newSequenceWindow(seqWindowV15, 0xfffffffe)
+	assert.NoError(t, w.accept(nextSequence(0xfffffffe)))
+	assert.NoError(t, w.accept(nextSequence(0xffffffff)))
+	assert.Equal(t, uint32(1), w.last)
+}
+
+func TestMessageVerify(t *testing.T) {
+	password := [16]uint8{'c', 'o', 'w'}
+
+	for _, authType := range []uint8{AuthTypeMD2, AuthTypeMD5, AuthTypePassword} {
+		m := &Message{
+			rmcpHeader:  &rmcpHeader{Version: rmcpVersion1, Class: rmcpClassIPMI},
+			ipmiSession: &ipmiSession{AuthType: authType, Sequence: 7, SessionID: 42},
+			AuthCode:    password,
+			ipmiHeader:  &ipmiHeader{RsAddr: 0x81, Command: CommandGetDeviceID},
+		}
+		buf := mustBytes(m.toBytes(&DeviceIDResponse{IPMIVersion: 0x51}))
+		m.authenticate(buf, password)
+
+		res, err := messageFromBytes(buf)
+		assert.NoError(t, err)
+		assert.NoError(t, res.verify(buf, password))
+		assert.Equal(t, ErrAuthCode, res.verify(buf, [16]uint8{}))
+
+		// payload tampering is detected by the digests
+		if authType != AuthTypePassword {
+			buf[len(buf)-2]++
+			assert.Equal(t, ErrAuthCode, res.verify(buf, password))
+		}
+	}
+}
@@ -17,35 +17,78 @@ limitations under the License.
 package ipmi
 
 import (
-	"bytes"
-
-	"hash/adler32"
-	"log"
+	"crypto/rand"
+	"log/slog"
 	"net"
 	"sync"
+	"time"
 )
 
-const authTypeSupport = (1 << AuthTypeNone) | (1 << AuthTypeMD5) | (1 << AuthTypePassword)
+const authTypeSupport = (1 << AuthTypeNone) | (1 << AuthTypeMD2) | (1 << AuthTypeMD5) | (1 << AuthTypePassword)
 
 // Handler function
 type Handler func(*Message) Response
 
 // Simulator for IPMI
 type Simulator struct {
-	wg       sync.WaitGroup
-	addr     net.UDPAddr
-	conn     *net.UDPConn
-	handlers map[NetworkFunction]map[Command]Handler
-	ids      map[uint32]string
-	bopts    [BootParamInitMbox + 1][]uint8
+	// mu guards the handlers, privileges, users, BMC key, session limits
+	// and storage set while the Simulator is running
+	mu             sync.Mutex
+	wg             sync.WaitGroup
+	addr           net.UDPAddr
+	conn           *net.UDPConn
+	handlers       map[NetworkFunction]map[Command]Handler
+	privileges     map[NetworkFunction]map[Command]uint8
+	sessions       map[uint32]*simSession
+	sessionTimeout time.Duration
+	maxSessions    int
+	users          [simMaxUsers]SimulatorUser
+	faults         map[NetworkFunction]map[Command]*Fault
+	// held responses of the Reorder fault
+	held []heldResponse
+	// authStatus reported by Get Channel Authentication Capabilities
+	authStatus uint8
+	// guid of the BMC in RAKP Message 2 and bmcKey, Kg of RMCP+ sessions
+	guid         [16]uint8
+	bmcKey       string
+	sol          *simSOL
+	bopts        [BootParamInitMbox + 1][]uint8
+	device       DeviceIDResponse
+	sdrs         []*SDR
+	sdrResv      simReservation
+	sensors      map[uint8]*simSensor
+	sel          []*SELEntry
+	selNextID    uint16
+	selResv      simReservation
+	selAddTime   time.Time
+	selEraseTime time.Time
+	frus         map[uint8][]byte
+	lanConfig    map[uint8][]byte
+	logger       Logger
+	power        simPower
 }
 
 // NewSimulator constructs a Simulator with the given addr
 func NewSimulator(addr net.UDPAddr) *Simulator {
 	s := &Simulator{
-		addr:     addr,
-		ids:      map[uint32]string{},
-		handlers: map[NetworkFunction]map[Command]Handler{},
+		addr:           addr,
+		sessions:       map[uint32]*simSession{},
+		sessionTimeout: defaultSessionTimeout,
+		maxSessions:    defaultMaxSessions,
+		users:          defaultSimUsers(),
+		handlers:       map[NetworkFunction]map[Command]Handler{},
+		privileges:     map[NetworkFunction]map[Command]uint8{},
+		faults:         map[NetworkFunction]map[Command]*Fault{},
+		device:         DeviceIDResponse{IPMIVersion: 0x51}, // 1.5
+		sensors:        map[uint8]*simSensor{},
+		frus:           map[uint8][]byte{},
+		lanConfig:      map[uint8][]byte{},
+		logger:         slog.Default(),
+		power:          simPower{on: true},
+		sol:            newSimSOL(),
+	}
+	if _, err := rand.Read(s.guid[:]); err != nil {
+		panic(err)
 	}
 
 	// Built-in handlers for session management
@@ -58,23 +101,59 @@ func NewSimulator(addr net.UDPAddr) *Simulator {
 		CommandCloseSession:             s.sessionClose,
 		CommandGetUserName:              s.getUserName,
 		CommandSetUserName:              s.setUserName,
+		CommandGetChannelCipherSuites:   s.channelCipherSuites,
+		CommandActivatePayload:          s.activatePayload,
+		CommandDeactivatePayload:        s.deactivatePayload,
 	}
 
 	// Built-in handlers for chassis commands
 	s.handlers[NetworkFunctionChassis] = map[Command]Handler{
 		CommandChassisStatus:        s.chassisStatus,
+		CommandChassisControl:       s.chassisControl,
 		CommandGetSystemBootOptions: s.getSystemBootOptions,
 		CommandSetSystemBootOptions: s.setSystemBootOptions,
 	}
 
+	// Built-in handlers for the SDR repository, sensors, SEL and FRU devices
+	s.handlers[NetworkFunctionStorage] = map[Command]Handler{
+		CommandGetSDRRepositoryInfo:    s.sdrRepositoryInfo,
+		CommandReserveSDRRepository:    s.reserveSDRRepository,
+		CommandGetSDR:                  s.getSDR,
+		CommandGetSELInfo:              s.selInfo,
+		CommandReserveSEL:              s.reserveSEL,
+		CommandGetSELEntry:             s.getSELEntry,
+		CommandAddSELEntry:             s.addSELEntry,
+		CommandClearSEL:                s.clearSEL,
+		CommandGetFRUInventoryAreaInfo: s.fruInventoryAreaInfo,
+		CommandReadFRUData:             s.readFRUData,
+		CommandWriteFRUData:            s.writeFRUData,
+	}
+	s.handlers[NetworkFunctionSensorEvent] = map[Command]Handler{
+		CommandGetSensorReading: s.sensorReading,
+	}
+	s.handlers[NetworkFunctionTransport] = map[Command]Handler{
+		CommandGetLANConfig: s.lanConfigParam,
+	}
+
 	return s
 }
 
 // SetHandler sets the command handler for the given netfn and command
 func (s *Simulator) SetHandler(netfn NetworkFunction, command Command, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.handlers[netfn]; !ok {
+		s.handlers[netfn] = map[Command]Handler{}
+	}
 	s.handlers[netfn][command] = handler
 }
 
+// SetLogger sets the Logger for invalid and dropped requests,
+// the default is slog.Default()
+func (s *Simulator) SetLogger(logger Logger) {
+	s.logger = logger
+}
+
 // NewConnection to this Simulator instance
 func (s *Simulator) NewConnection() *Connection {
 	addr := s.LocalAddr()
@@ -94,9 +173,20 @@ func (s *Simulator) LocalAddr() *net.UDPAddr {
 }
 
 // Run the Simulator.
+// The Simulator listens on both IPv4 and IPv6 if addr has no IP, where
+// the host supports it, otherwise on the family of the addr IP.
 func (s *Simulator) Run() error {
+	network := "udp"
+	switch {
+	case s.addr.IP == nil:
+	case s.addr.IP.To4() != nil:
+		network = "udp4"
+	default:
+		network = "udp6"
+	}
+
 	var err error
-	s.conn, err = net.ListenUDP("udp4", &s.addr)
+	s.conn, err = net.ListenUDP(network, &s.addr)
 	if err != nil {
 		return err
 	}
@@ -108,6 +198,8 @@ func (s *Simulator) Run() error {
 		s.wg.Done()
 	}()
 
+	s.sol.start(s.conn, s.logger)
+
 	return nil
 }
 
@@ -115,13 +207,11 @@ func (s *Simulator) Run() error {
 func (s *Simulator) Stop() {
 	_ = s.conn.Close()
 	s.wg.Wait()
-}
+	s.sol.stop()
 
-func (s *Simulator) chassisStatus(*Message) Response {
-	return &ChassisStatusResponse{
-		CompletionCode: CommandCompleted,
-		PowerState:     SystemPower,
-	}
+	s.power.mu.Lock()
+	s.power.cancel()
+	s.power.mu.Unlock()
 }
 
 func (s *Simulator) getSystemBootOptions(m *Message) Response {
@@ -129,7 +219,12 @@ func (s *Simulator) getSystemBootOptions(m *Message) Response {
 	if err := m.Request(r); err != nil {
 		return err
 	}
+	if int(r.Param) >= len(s.bopts) {
+		return ErrParamRange
+	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return &SystemBootOptionsResponse{
 		CompletionCode: CommandCompleted,
 		Version:        0x01,
@@ -143,109 +238,133 @@ func (s *Simulator) setSystemBootOptions(m *Message) Response {
 	if err := m.Request(r); err != nil {
 		return err
 	}
+	if int(r.Param) >= len(s.bopts) {
+		return ErrParamRange
+	}
 
+	s.mu.Lock()
 	s.bopts[r.Param] = r.Data
+	s.mu.Unlock()
 
 	return &SetSystemBootOptionsResponse{}
 }
 
-func (s *Simulator) deviceID(*Message) Response {
-	return &DeviceIDResponse{
-		CompletionCode: CommandCompleted,
-		IPMIVersion:    0x51, // 1.5
-	}
-}
-
-var users = []string{"admin", "", "", "", ""}
-
-func (s *Simulator) getUserName(m *Message) Response {
-	req := &GetUserNameRequest{}
-	if err := m.Request(req); err != nil {
-		return err
-	}
-	return &GetUserNameResponse{
-		CompletionCode: CommandCompleted,
-		Username:       users[req.UserID],
-	}
-}
-
-func (s *Simulator) setUserName(m *Message) Response {
-	req := &SetUserNameRequest{}
+func (s *Simulator) authCapabilities(m *Message) Response {
+	req := &AuthCapabilitiesRequest{}
 	if err := m.Request(req); err != nil {
 		return err
 	}
-	users[req.UserID] = req.Username
-	return &SetUserNameResponse{
-		CompletionCode: CommandCompleted,
-	}
-}
 
-func (s *Simulator) authCapabilities(*Message) Response {
-	return &AuthCapabilitiesResponse{
+	res := &AuthCapabilitiesResponse{
 		CompletionCode:  CommandCompleted,
 		ChannelNumber:   0x01,
 		AuthTypeSupport: authTypeSupport,
+		Status:          s.authStatus,
 	}
-}
 
-func (s *Simulator) sessionChallenge(m *Message) Response {
-	// Convert username to a uint32 and use as the SessionID.
-	// The SessionID will be propagated such that all requests
-	// for this session include the ID, which can be used to
-	// dispatch requests.
-	username := bytes.TrimRight(m.Data[1:], "\000")
-	hash := adler32.New()
-	_, err := hash.Write(username)
-	if err != nil {
-		panic(err)
+	if req.ChannelNumber&channelExtended != 0 {
+		// IPMI v1.5 and v2.0 sessions
+		res.AuthTypeSupport |= 0x80
+		res.Reserved = 0x03
 	}
-	id := hash.Sum32()
 
-	s.ids[id] = string(username)
+	return res
+}
+
+func (s *Simulator) ipmiCommand(m *Message, buf []byte) []byte {
+	priv := uint8(PrivLevelNone)
 
-	return &SessionChallengeResponse{
-		CompletionCode:     CommandCompleted,
-		TemporarySessionID: id,
+	s.mu.Lock()
+	required := s.commandPrivilege(m.NetFn(), m.Command)
+	timeout := s.sessionTimeout
+	s.mu.Unlock()
+
+	now := time.Now()
+	s.expireSessions(now, timeout)
+
+	// BMCs silently discard messages of unknown sessions, that fail
+	// authentication or are outside of the sequence number window
+	session := s.sessions[m.SessionID]
+	if session == nil && m.SessionID != 0 && required != PrivLevelNone {
+		s.logger.Debug("dropped message with invalid session ID", "id", m.SessionID)
+		return nil
+	}
+	unauthenticated := session != nil && session.inbound != nil && !session.authRequired && m.AuthType == AuthTypeNone
+	if session != nil && !unauthenticated {
+		if m.AuthType != session.authType || m.verify(buf, session.password) != nil {
+			s.logger.Debug("dropped message with invalid auth code", "user", session.username)
+			return nil
+		}
+	}
+	active := session != nil && session.inbound != nil
+	if active {
+		if err := session.inbound.accept(m.Sequence); err != nil {
+			s.logger.Debug("dropped message outside of the sequence window", "err", err)
+			return nil
+		}
+		session.lastActive = now
+		priv = session.priv
 	}
-}
 
-func (s *Simulator) sessionActivate(m *Message) Response {
-	return &ActivateSessionResponse{
-		CompletionCode: CommandCompleted,
-		AuthType:       m.AuthType,
-		SessionID:      m.SessionID,
-		InboundSeq:     m.Sequence,
-		MaxPriv:        PrivLevelAdmin,
+	response := s.execute(m, session, priv)
+
+	if session == nil {
+		return s.responseBytes(m, response)
 	}
-}
 
-func (s *Simulator) sessionPrivilege(m *Message) Response {
-	return &SessionPrivilegeLevelResponse{
-		CompletionCode:    CommandCompleted,
-		NewPrivilegeLevel: m.Data[0],
+	// the Activate Session response of a pending session is
+	// authenticated too, outside of the sequence numbers
+	m.Sequence = 0
+	if active {
+		m.Sequence = session.outSeq
+		session.outSeq = nextSequence(session.outSeq)
 	}
-}
+	m.AuthCode = session.password
+	buf = s.responseBytes(m, response)
+	m.authenticate(buf, session.password)
 
-func (s *Simulator) sessionClose(*Message) Response {
-	return CommandCompleted
+	return buf
 }
 
-func (s *Simulator) ipmiCommand(m *Message) []byte {
-	response := Response(ErrInvalidCommand)
+// responseBytes encodes the response to m, a response that cannot be
+// encoded is replaced with ErrUnspecified
+func (s *Simulator) responseBytes(m *Message, response Response) []byte {
+	buf, err := m.toBytes(response)
+	if err != nil {
+		s.logger.Warn("invalid response", "netfn", m.NetFn(), "cmd", m.Command, "err", err)
+		buf, _ = m.toBytes(ErrUnspecified)
+	}
+	s.corruptChecksum(m, buf)
+	return buf
+}
 
-	if commands, ok := s.handlers[m.NetFn()]; ok {
-		if handler, ok := commands[m.Command]; ok {
-			m.RequestID = s.ids[m.SessionID]
-			response = handler(m)
-		}
+// execute runs the handler of the command in m if the session privilege
+// level allows, unless an Error fault is injected
+func (s *Simulator) execute(m *Message, session *simSession, priv uint8) Response {
+	s.mu.Lock()
+	handler, ok := s.handlers[m.NetFn()][m.Command]
+	required := s.commandPrivilege(m.NetFn(), m.Command)
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		return ErrInvalidCommand
+	case required > priv:
+		return ErrPrivLevel
 	}
 
-	return m.toBytes(response)
+	if session != nil {
+		m.RequestID = session.username
+	}
+	if fault := s.fault(m.NetFn(), m.Command); fault != nil && chance(fault.Error) {
+		return fault.CompletionCode
+	}
+	return handler(m)
 }
 
 func (s *Simulator) asfCommand(m *asfMessage) []byte {
 	if m.MessageType != asfMessageTypePing {
-		log.Print(m.unsupportedMessageType())
+		s.logger.Warn("invalid ASF request", "err", m.unsupportedMessageType())
 		return []byte{} // TODO: general ASF error code?
 	}
 
@@ -263,6 +382,7 @@ func (s *Simulator) serve() error {
 
 	for {
 		var response []byte
+		var fault *Fault
 		var err error
 
 		n, addr, err := s.conn.ReadFrom(buf)
@@ -270,35 +390,45 @@ func (s *Simulator) serve() error {
 			return err // conn closed
 		}
 
-		header, err := rmcpHeaderFromBytes(buf)
+		header, err := rmcpHeaderFromBytes(buf[:n])
 		if err != nil {
-			log.Print(err)
+			s.logger.Warn("invalid RMCP request", "addr", addr, "err", err)
 			continue
 		}
 
 		switch header.Class {
 		case rmcpClassASF:
-			m, err := asfMessageFromBytes(buf)
+			m, err := asfMessageFromBytes(buf[:n])
 			if err != nil {
-				log.Print(err)
+				s.logger.Warn("invalid ASF request", "addr", addr, "err", err)
 				continue
 			}
 
 			response = s.asfCommand(m)
 		case rmcpClassIPMI:
+			if n > rmcpHeaderSize && buf[rmcpHeaderSize] == authTypeRMCPPlus {
+				response, fault = s.plusCommand(buf[:n], addr)
+				break
+			}
+
 			m, err := messageFromBytes(buf[:n])
 			if err != nil {
-				log.Print(err)
+				s.logger.Warn("invalid IPMI request", "addr", addr, "err", err)
 				continue
 			}
 
-			response = s.ipmiCommand(m)
+			fault = s.fault(m.NetFn(), m.Command)
+			response = s.ipmiCommand(m, buf[:n])
 		default:
-			log.Print(header.unsupportedClass())
+			s.logger.Warn("invalid RMCP request", "addr", addr, "err", header.unsupportedClass())
+			continue
+		}
+
+		if len(response) == 0 {
 			continue
 		}
 
-		_, err = s.conn.WriteTo(response, addr)
+		err = s.deliver(response, addr, fault)
 		if err != nil {
 			return err // conn closed
 		}
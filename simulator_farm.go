@@ -0,0 +1,132 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"fmt"
+	"net"
+)
+
+// FarmAddressing selects how the Simulators of a SimulatorFarm are addressed
+type FarmAddressing int
+
+// FarmAddressing modes
+const (
+	// FarmPorts listens on consecutive ports from the farm's Port,
+	// or on ephemeral ports if it is 0, all on the farm's IP address
+	FarmPorts = FarmAddressing(iota)
+	// FarmAliases listens on consecutive IP addresses from the farm's IP,
+	// such as 127.0.0.x loopback aliases, all on the farm's Port
+	FarmAliases
+)
+
+// SimulatorFarm runs a number of Simulators in one process,
+// each with its own address, identity and state
+type SimulatorFarm struct {
+	simulators []*Simulator
+}
+
+// NewSimulatorFarm constructs n Simulators addressed from addr by mode.
+// Each has a distinct Device ID response, FRU 0 product serial number
+// and LAN MAC address, which may be changed before Run.
+func NewSimulatorFarm(n int, addr net.UDPAddr, mode FarmAddressing) *SimulatorFarm {
+	f := &SimulatorFarm{}
+
+	for i := 0; i < n; i++ {
+		a := addr
+		switch mode {
+		case FarmPorts:
+			if a.Port != 0 {
+				a.Port += i
+			}
+		case FarmAliases:
+			a.IP = addIP(addr.IP, i)
+		}
+
+		s := NewSimulator(a)
+		s.SetDeviceID(DeviceIDResponse{
+			DeviceID:          0x20,
+			FirmwareRevision1: 0x01,
+			IPMIVersion:       0x51, // 1.5
+			ProductID:         uint16(i),
+		})
+		_ = s.SetFRU(0, &FRUInfo{
+			ProductName:   "goipmi simulator",
+			ProductSerial: fmt.Sprintf("SIM%06d", i),
+		})
+		// locally administered unicast address
+		s.SetLANConfig(LANParamMACAddress, []byte{0x02, 0x00, 0x00, byte(i >> 16), byte(i >> 8), byte(i)})
+
+		f.simulators = append(f.simulators, s)
+	}
+
+	return f
+}
+
+// addIP returns ip plus n, carrying across bytes
+func addIP(ip net.IP, n int) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0 && n > 0; i-- {
+		sum := int(next[i]) + n
+		next[i] = byte(sum)
+		n = sum >> 8
+	}
+	return next
+}
+
+// Simulators returns the Simulators of the farm, in address order
+func (f *SimulatorFarm) Simulators() []*Simulator {
+	return f.simulators
+}
+
+// Run all the Simulators, stopping any already running if one fails
+func (f *SimulatorFarm) Run() error {
+	for i, s := range f.simulators {
+		if err := s.Run(); err != nil {
+			for _, running := range f.simulators[:i] {
+				running.Stop()
+			}
+			return err
+		}
+
+		addr := s.LocalAddr()
+		if ip := addr.IP.To4(); ip != nil && !ip.IsUnspecified() {
+			s.SetLANConfig(LANParamIPAddress, ip)
+		}
+	}
+	return nil
+}
+
+// Stop all the Simulators
+func (f *SimulatorFarm) Stop() {
+	for _, s := range f.simulators {
+		s.Stop()
+	}
+}
+
+// Connections returns a Connection to each of the running Simulators
+func (f *SimulatorFarm) Connections() []*Connection {
+	conns := make([]*Connection, len(f.simulators))
+	for i, s := range f.simulators {
+		conns[i] = s.NewConnection()
+	}
+	return conns
+}
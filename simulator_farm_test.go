@@ -0,0 +1,120 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorFarm(t *testing.T) {
+	n := 64
+	if testing.Short() {
+		n = 16
+	}
+
+	farm := NewSimulatorFarm(n, net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, FarmPorts)
+	err := farm.Run()
+	assert.NoError(t, err)
+	defer farm.Stop()
+
+	conns := farm.Connections()
+	assert.Equal(t, n, len(conns))
+
+	// state is not shared between simulators
+	farm.Simulators()[0].SetPassword("fleet", "secret")
+	user, _ := farm.Simulators()[0].User(3)
+	assert.Equal(t, "fleet", user.Name)
+	user, _ = farm.Simulators()[1].User(3)
+	assert.Empty(t, user.Name)
+
+	var wg sync.WaitGroup
+	ports := make([]int, n)
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *Connection) {
+			defer wg.Done()
+			ports[i] = conn.Port
+
+			client, err := NewClient(conn)
+			if !assert.NoError(t, err) || !assert.NoError(t, client.Open()) {
+				return
+			}
+			defer client.Close()
+
+			id, err := client.DeviceID()
+			assert.NoError(t, err)
+			assert.Equal(t, uint16(i), id.ProductID)
+
+			fru, err := client.FRU(0)
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("SIM%06d", i), fru.ProductSerial)
+
+			mac := &LANConfigResponse{}
+			err = client.Send(&Request{NetworkFunctionTransport, CommandGetLANConfig, &LANConfigRequest{ChannelNumber: lanChannelE, Param: LANParamMACAddress}}, mac)
+			assert.NoError(t, err)
+			assert.Equal(t, byte(i), mac.Data[5])
+
+			ip := &LANConfigResponse{}
+			err = client.Send(&Request{NetworkFunctionTransport, CommandGetLANConfig, &LANConfigRequest{ChannelNumber: lanChannelE, Param: LANParamIPAddress}}, ip)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{127, 0, 0, 1}, ip.Data)
+		}(i, conn)
+	}
+	wg.Wait()
+
+	seen := map[int]bool{}
+	for _, port := range ports {
+		assert.False(t, seen[port])
+		seen[port] = true
+	}
+}
+
+func TestSimulatorFarmAliases(t *testing.T) {
+	farm := NewSimulatorFarm(3, net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, FarmAliases)
+	err := farm.Run()
+	assert.NoError(t, err)
+
+	for i, conn := range farm.Connections() {
+		assert.Equal(t, fmt.Sprintf("127.0.0.%d", i+1), conn.Hostname)
+
+		client, err := NewClient(conn)
+		assert.NoError(t, err)
+		assert.NoError(t, client.Open())
+		id, err := client.DeviceID()
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(i), id.ProductID)
+		assert.NoError(t, client.Close())
+	}
+
+	// a farm that cannot bind every port is not left running
+	port := farm.Simulators()[0].LocalAddr().Port
+	clash := NewSimulatorFarm(2, net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port - 1}, FarmPorts)
+	assert.Error(t, clash.Run())
+
+	farm.Stop()
+}
+
+func TestAddIP(t *testing.T) {
+	assert.Equal(t, net.IPv4(127, 0, 0, 2).To4(), addIP(net.IPv4(127, 0, 0, 1), 1))
+	assert.Equal(t, net.IPv4(10, 0, 1, 4).To4(), addIP(net.IPv4(10, 0, 0, 255), 5))
+	assert.Equal(t, net.ParseIP("fd00::1:0"), addIP(net.ParseIP("fd00::ffff"), 1))
+}
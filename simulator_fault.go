@@ -0,0 +1,140 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// Fault configures how the Simulator misbehaves in response to a command.
+// Probabilities are in the range [0, 1] and are applied independently,
+// such that a response can be both corrupted and duplicated for example.
+type Fault struct {
+	// Drop is the probability of discarding the response
+	Drop float64
+	// Delay is the probability of sending the response after DelayTime
+	Delay     float64
+	DelayTime time.Duration
+	// Duplicate is the probability of sending the response twice
+	Duplicate float64
+	// Reorder is the probability of holding the response back until
+	// the response to the next request has been sent
+	Reorder float64
+	// CorruptChecksum is the probability of an invalid IPMI message
+	// checksum, of a response that is otherwise authenticated
+	CorruptChecksum float64
+	// CorruptLength is the probability of a response shorter than its
+	// message length field
+	CorruptLength float64
+	// Error is the probability of responding with CompletionCode
+	// instead of running the command handler
+	Error          float64
+	CompletionCode CompletionCode
+}
+
+func chance(p float64) bool {
+	return p > 0 && rand.Float64() < p
+}
+
+// SetFault sets the Fault injected into responses to the given command
+func (s *Simulator) SetFault(netfn NetworkFunction, command Command, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.faults[netfn]; !ok {
+		s.faults[netfn] = map[Command]*Fault{}
+	}
+	s.faults[netfn][command] = &fault
+}
+
+// ClearFaults removes all faults set with SetFault
+func (s *Simulator) ClearFaults() {
+	s.mu.Lock()
+	s.faults = map[NetworkFunction]map[Command]*Fault{}
+	s.mu.Unlock()
+}
+
+func (s *Simulator) fault(netfn NetworkFunction, command Command) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.faults[netfn][command]
+}
+
+type heldResponse struct {
+	buf  []byte
+	addr net.Addr
+}
+
+// corruptChecksum applies the CorruptChecksum fault to buf, which ends
+// with the IPMI message checksum, before the message is authenticated
+func (s *Simulator) corruptChecksum(m *Message, buf []byte) {
+	if fault := s.fault(m.NetFn(), m.Command); fault != nil && chance(fault.CorruptChecksum) && len(buf) > 0 {
+		buf[len(buf)-1] ^= 0xff
+	}
+}
+
+// deliver the response to addr, applying the given fault if any.
+// Responses held back are sent after the next response.
+func (s *Simulator) deliver(response []byte, addr net.Addr, fault *Fault) error {
+	count := 1
+
+	if fault != nil {
+		if chance(fault.Drop) {
+			s.logger.Debug("fault injection dropped response", "addr", addr)
+			return nil
+		}
+		if chance(fault.CorruptLength) {
+			response = response[:len(response)-1]
+		}
+		if chance(fault.Reorder) {
+			s.held = append(s.held, heldResponse{response, addr})
+			return nil
+		}
+		if chance(fault.Duplicate) {
+			count = 2
+		}
+		if chance(fault.Delay) {
+			time.AfterFunc(fault.DelayTime, func() {
+				for i := 0; i < count; i++ {
+					_, _ = s.conn.WriteTo(response, addr) // conn may be closed by now
+				}
+			})
+			return s.flush()
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		if _, err := s.conn.WriteTo(response, addr); err != nil {
+			return err
+		}
+	}
+
+	return s.flush()
+}
+
+// flush sends the responses held back by the Reorder fault
+func (s *Simulator) flush() error {
+	held := s.held
+	s.held = nil
+	for _, h := range held {
+		if _, err := s.conn.WriteTo(h.buf, h.addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorFaults(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	c.Timeout = 100 * time.Millisecond
+	l := newLanTransport(c).(*lan)
+	err = l.open()
+	assert.NoError(t, err)
+
+	deviceID := func() error {
+		return l.send(&Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}, &DeviceIDResponse{})
+	}
+
+	tests := []struct {
+		should string
+		fault  Fault
+		check  func(error) bool
+	}{
+		{"should drop", Fault{Drop: 1}, isTimeout},
+		{"should delay", Fault{Delay: 1, DelayTime: 10 * time.Millisecond}, func(err error) bool { return err == nil }},
+		{"should delay past the timeout", Fault{Delay: 1, DelayTime: 200 * time.Millisecond}, isTimeout},
+		{"should corrupt the checksum", Fault{CorruptChecksum: 1}, func(err error) bool { return err == ErrInvalidPacket }},
+		{"should corrupt the length", Fault{CorruptLength: 1}, func(err error) bool { return err == ErrShortPacket }},
+		{"should respond node busy", Fault{Error: 1, CompletionCode: ErrNodeBusy}, func(err error) bool { return err == ErrNodeBusy }},
+		{"should respond timeout", Fault{Error: 1, CompletionCode: ErrCommandTimeout}, func(err error) bool { return err == ErrCommandTimeout }},
+		{"should not inject a fault", Fault{}, func(err error) bool { return err == nil }},
+	}
+
+	for _, test := range tests {
+		s.SetFault(NetworkFunctionApp, CommandGetDeviceID, test.fault)
+		err = deviceID()
+		assert.True(t, test.check(err), "%s: %v", test.should, err)
+
+		// late responses are not part of the next test
+		time.Sleep(test.fault.DelayTime)
+		s.ClearFaults()
+		_ = l.close()
+		err = l.open()
+		assert.NoError(t, err, test.should)
+	}
+
+	err = l.close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestSimulatorFaultOrder(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	l := newLanTransport(s.NewConnection()).(*lan)
+	err = l.connect()
+	assert.NoError(t, err)
+
+	capabilities := &Request{NetworkFunctionApp, CommandGetAuthCapabilities, &AuthCapabilitiesRequest{ChannelNumber: lanChannelE}}
+	challenge := &Request{NetworkFunctionApp, CommandGetSessionChallenge, &SessionChallengeRequest{AuthType: AuthTypeMD5}}
+	recv := func() Command {
+		m, err := l.recvMessage()
+		assert.NoError(t, err)
+		if err != nil {
+			return 0
+		}
+		return m.Command
+	}
+
+	s.SetFault(NetworkFunctionApp, CommandGetAuthCapabilities, Fault{Duplicate: 1})
+	assert.NoError(t, l.sendPacket(mustBytes(l.message(capabilities))))
+	assert.Equal(t, CommandGetAuthCapabilities, recv())
+	assert.Equal(t, CommandGetAuthCapabilities, recv())
+
+	s.SetFault(NetworkFunctionApp, CommandGetAuthCapabilities, Fault{Reorder: 1})
+	assert.NoError(t, l.sendPacket(mustBytes(l.message(capabilities))))
+	assert.NoError(t, l.sendPacket(mustBytes(l.message(challenge))))
+	assert.Equal(t, CommandGetSessionChallenge, recv())
+	assert.Equal(t, CommandGetAuthCapabilities, recv())
+
+	_ = l.close()
+	s.Stop()
+}
@@ -0,0 +1,215 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"sync"
+	"time"
+)
+
+// PowerDelays are the times the simulated host takes to change its power
+// state. With zero delays, the state changes before the Chassis Control
+// command response is sent.
+type PowerDelays struct {
+	// On is the time from power up to the system being powered on
+	On time.Duration
+	// Off is the time from power down to the system being powered off
+	Off time.Duration
+	// SoftOff is the time the OS takes to shut down on an ACPI soft-off request
+	SoftOff time.Duration
+	// Cycle is the interval the system stays powered off during a power cycle
+	Cycle time.Duration
+}
+
+// simPower is the power state machine of the simulated host
+type simPower struct {
+	mu        sync.Mutex
+	on        bool
+	lastEvent uint8
+	policy    uint8
+	delays    PowerDelays
+	timer     *time.Timer
+	// gen invalidates a pending transition once another one starts
+	gen int
+}
+
+// schedule fn to run after the given delay, replacing any pending transition.
+// Must be called with the mutex held, fn is run with the mutex held.
+func (p *simPower) schedule(delay time.Duration, fn func()) {
+	p.cancel()
+	if delay <= 0 {
+		fn()
+		return
+	}
+
+	gen := p.gen
+	p.timer = time.AfterFunc(delay, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.gen == gen {
+			p.timer = nil
+			fn()
+		}
+	})
+}
+
+func (p *simPower) cancel() {
+	p.gen++
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
+
+func (p *simPower) set(on bool) func() {
+	return func() {
+		p.on = on
+	}
+}
+
+// powerOn by command, which is then the last power event per section 28.2
+func (p *simPower) powerOn() {
+	if !p.on {
+		p.lastEvent = PowerEventCommand
+	}
+	p.on = true
+}
+
+// control applies a Chassis Control command per section 28.3
+func (p *simPower) control(ctl ChassisControl) CompletionCode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch ctl {
+	case ControlPowerDown:
+		p.schedule(p.delays.Off, p.set(false))
+	case ControlPowerUp:
+		p.schedule(p.delays.On, p.powerOn)
+	case ControlPowerCycle:
+		if !p.on {
+			return ErrInvalidState
+		}
+		p.schedule(p.delays.Off, func() {
+			p.on = false
+			p.schedule(p.delays.Cycle+p.delays.On, p.powerOn)
+		})
+	case ControlPowerHardReset:
+		if !p.on {
+			return ErrInvalidState
+		}
+		// the system is reset without a change of power state
+	case ControlPowerPulseDiag:
+	case ControlPowerAcpiSoft:
+		if p.on {
+			p.schedule(p.delays.SoftOff, p.set(false))
+		}
+	default:
+		return ErrParamRange
+	}
+
+	return CommandCompleted
+}
+
+// status per section 28.2
+func (p *simPower) status() *ChassisStatusResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.policy << 5
+	if p.on {
+		state |= SystemPower
+	}
+
+	return &ChassisStatusResponse{
+		CompletionCode: CommandCompleted,
+		PowerState:     state,
+		LastPowerEvent: p.lastEvent,
+	}
+}
+
+// acFailure loses and restores AC power, applying the restore policy
+func (p *simPower) acFailure() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cancel()
+	previous := p.on
+	p.lastEvent = PowerEventAcFailed
+
+	switch p.policy {
+	case PowerRestorePolicyAlwaysOn:
+		p.on = true
+	case PowerRestorePolicyPrevious:
+		p.on = previous
+	default:
+		p.on = false
+	}
+}
+
+// SetPowerDelays sets the times the simulated host takes to change power state
+func (s *Simulator) SetPowerDelays(delays PowerDelays) {
+	s.power.mu.Lock()
+	s.power.delays = delays
+	s.power.mu.Unlock()
+}
+
+// SetPower sets the power state of the simulated host, cancelling any
+// pending transition. The host is powered on by default.
+func (s *Simulator) SetPower(on bool) {
+	s.power.mu.Lock()
+	s.power.cancel()
+	s.power.on = on
+	s.power.mu.Unlock()
+}
+
+// Power returns true if the simulated host is powered on
+func (s *Simulator) Power() bool {
+	s.power.mu.Lock()
+	defer s.power.mu.Unlock()
+	return s.power.on
+}
+
+// SetPowerRestorePolicy sets the policy applied by PowerFailure,
+// one of the PowerRestorePolicy constants
+func (s *Simulator) SetPowerRestorePolicy(policy uint8) {
+	s.power.mu.Lock()
+	s.power.policy = policy & 0x03
+	s.power.mu.Unlock()
+}
+
+// PowerFailure simulates the loss and return of AC power, after which
+// the host is powered on or off according to the power restore policy
+func (s *Simulator) PowerFailure() {
+	s.power.acFailure()
+}
+
+func (s *Simulator) chassisStatus(*Message) Response {
+	return s.power.status()
+}
+
+func (s *Simulator) chassisControl(m *Message) Response {
+	req := &ChassisControlRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	if cc := s.power.control(req.ChassisControl); cc != CommandCompleted {
+		return cc
+	}
+
+	return &ChassisControlResponse{CompletionCode: CommandCompleted}
+}
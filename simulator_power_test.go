@@ -0,0 +1,145 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorPower(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+	defer s.Stop()
+
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	status := func() *ChassisStatusResponse {
+		res, err := client.ChassisStatus()
+		assert.NoError(t, err)
+		return res
+	}
+
+	res := status()
+	assert.True(t, res.IsSystemPowerOn())
+	assert.Equal(t, uint8(PowerEventUnknown), res.LastPowerEvent)
+
+	err = client.Control(ControlPowerDown)
+	assert.NoError(t, err)
+	res = status()
+	assert.Equal(t, "off", res.String())
+	assert.Equal(t, uint8(PowerEventUnknown), res.LastPowerEvent)
+
+	// cycle and reset need the system powered on
+	assert.Equal(t, ErrInvalidState, client.Control(ControlPowerCycle))
+	assert.Equal(t, ErrInvalidState, client.Control(ControlPowerHardReset))
+
+	err = client.Control(ControlPowerUp)
+	assert.NoError(t, err)
+	assert.True(t, s.Power())
+	assert.Equal(t, uint8(PowerEventCommand), status().LastPowerEvent)
+
+	err = client.Control(ControlPowerCycle)
+	assert.NoError(t, err)
+	assert.True(t, s.Power())
+
+	err = client.Control(ControlPowerHardReset)
+	assert.NoError(t, err)
+	assert.True(t, s.Power())
+
+	err = client.Control(ControlPowerAcpiSoft)
+	assert.NoError(t, err)
+	assert.False(t, s.Power())
+
+	assert.Equal(t, ErrParamRange, client.Control(ChassisControl(0x0f)))
+}
+
+// eventually polls cond until it returns true, or a second has passed
+func eventually(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return cond()
+}
+
+func TestSimulatorPowerDelays(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	s.SetPowerDelays(PowerDelays{
+		On:      20 * time.Millisecond,
+		Off:     20 * time.Millisecond,
+		SoftOff: 50 * time.Millisecond,
+		Cycle:   20 * time.Millisecond,
+	})
+
+	off := s.power.control(ControlPowerDown)
+	assert.Equal(t, CommandCompleted, off)
+	assert.True(t, s.Power())
+	assert.True(t, eventually(func() bool { return !s.Power() }))
+
+	// a new command replaces the pending transition
+	s.power.control(ControlPowerUp)
+	s.power.control(ControlPowerDown)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, s.Power())
+
+	s.SetPower(true)
+	s.power.control(ControlPowerCycle)
+	assert.True(t, eventually(func() bool { return !s.Power() }))
+	assert.True(t, eventually(s.Power))
+
+	s.power.control(ControlPowerAcpiSoft)
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, s.Power())
+	assert.True(t, eventually(func() bool { return !s.Power() }))
+}
+
+func TestSimulatorPowerRestorePolicy(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+
+	tests := []struct {
+		policy uint8
+		before bool
+		after  bool
+	}{
+		{PowerRestorePolicyAlwaysOff, true, false},
+		{PowerRestorePolicyAlwaysOn, false, true},
+		{PowerRestorePolicyPrevious, true, true},
+		{PowerRestorePolicyPrevious, false, false},
+	}
+
+	for _, test := range tests {
+		s.SetPowerRestorePolicy(test.policy)
+		s.SetPower(test.before)
+		s.PowerFailure()
+		assert.Equal(t, test.after, s.Power())
+
+		res := s.power.status()
+		assert.Equal(t, test.policy, res.PowerRestorePolicy())
+		assert.Equal(t, uint8(PowerEventAcFailed), res.LastPowerEvent)
+	}
+}
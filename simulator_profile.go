@@ -0,0 +1,457 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile describes the identity and state of a simulated BMC, such that
+// the personality of a particular server model can be kept in a JSON or
+// YAML file next to the tests using it. Names are used where ipmitool
+// prints one, "Temperature" or "degrees C" for example.
+type Profile struct {
+	DeviceID ProfileDeviceID   `json:"device_id" yaml:"device_id"`
+	Sensors  []ProfileSensor   `json:"sensors" yaml:"sensors"`
+	SEL      []ProfileSELEntry `json:"sel" yaml:"sel"`
+	FRU      []ProfileFRU      `json:"fru" yaml:"fru"`
+	Users    []ProfileUser     `json:"users" yaml:"users"`
+	LAN      *ProfileLAN       `json:"lan" yaml:"lan"`
+	// BootDevice is the boot device selector, "pxe" or "disk" for example
+	BootDevice string `json:"boot_device" yaml:"boot_device"`
+}
+
+// ProfileDeviceID is the identity reported by Get Device ID
+type ProfileDeviceID struct {
+	// Manufacturer is the IANA Enterprise Number, 674 for Dell for example
+	Manufacturer   OemID  `json:"manufacturer" yaml:"manufacturer"`
+	Product        uint16 `json:"product" yaml:"product"`
+	DeviceID       uint8  `json:"device_id" yaml:"device_id"`
+	DeviceRevision uint8  `json:"device_revision" yaml:"device_revision"`
+	// Firmware is the major.minor firmware revision, "2.75" for example
+	Firmware string `json:"firmware" yaml:"firmware"`
+}
+
+// ProfileSensor is a threshold based sensor with a Full Sensor Record
+type ProfileSensor struct {
+	Number uint8  `json:"number" yaml:"number"`
+	Name   string `json:"name" yaml:"name"`
+	// Type is the sensor type name
+	Type string `json:"type" yaml:"type"`
+	// Units is the base unit name
+	Units string `json:"units" yaml:"units"`
+	// Reading conversion factors per section 36.3, M defaults to 1
+	M    int16 `json:"m" yaml:"m"`
+	B    int16 `json:"b" yaml:"b"`
+	BExp int8  `json:"b_exp" yaml:"b_exp"`
+	RExp int8  `json:"r_exp" yaml:"r_exp"`
+	// Value of the reading in Units, the sensor has no reading if nil
+	Value *float64 `json:"value" yaml:"value"`
+	// Status is the threshold status "ok", "nc", "cr" or "nr"
+	Status string `json:"status" yaml:"status"`
+}
+
+// ProfileSELEntry is a system event record
+type ProfileSELEntry struct {
+	Timestamp    time.Time `json:"timestamp" yaml:"timestamp"`
+	SensorType   string    `json:"sensor_type" yaml:"sensor_type"`
+	SensorNumber uint8     `json:"sensor_number" yaml:"sensor_number"`
+	// EventType is the Event/Reading Type code
+	EventType   uint8    `json:"event_type" yaml:"event_type"`
+	Deassertion bool     `json:"deassertion" yaml:"deassertion"`
+	EventData   [3]uint8 `json:"event_data" yaml:"event_data"`
+}
+
+// ProfileFRU is the inventory data of a FRU device
+type ProfileFRU struct {
+	ID uint8 `json:"id" yaml:"id"`
+	// ChassisType is the SMBIOS chassis type name
+	ChassisType         string    `json:"chassis_type" yaml:"chassis_type"`
+	ChassisPartNumber   string    `json:"chassis_part_number" yaml:"chassis_part_number"`
+	ChassisSerial       string    `json:"chassis_serial" yaml:"chassis_serial"`
+	BoardMfgDate        time.Time `json:"board_mfg_date" yaml:"board_mfg_date"`
+	BoardManufacturer   string    `json:"board_manufacturer" yaml:"board_manufacturer"`
+	BoardProduct        string    `json:"board_product" yaml:"board_product"`
+	BoardSerial         string    `json:"board_serial" yaml:"board_serial"`
+	BoardPartNumber     string    `json:"board_part_number" yaml:"board_part_number"`
+	ProductManufacturer string    `json:"product_manufacturer" yaml:"product_manufacturer"`
+	ProductName         string    `json:"product_name" yaml:"product_name"`
+	ProductPartNumber   string    `json:"product_part_number" yaml:"product_part_number"`
+	ProductVersion      string    `json:"product_version" yaml:"product_version"`
+	ProductSerial       string    `json:"product_serial" yaml:"product_serial"`
+	ProductAssetTag     string    `json:"product_asset_tag" yaml:"product_asset_tag"`
+}
+
+// ProfileUser is an entry of the user table
+type ProfileUser struct {
+	ID       uint8  `json:"id" yaml:"id"`
+	Name     string `json:"name" yaml:"name"`
+	Password string `json:"password" yaml:"password"`
+	// Privilege is the privilege limit "callback", "user", "operator"
+	// or "administrator", which is the default
+	Privilege string `json:"privilege" yaml:"privilege"`
+	Disabled  bool   `json:"disabled" yaml:"disabled"`
+}
+
+// ProfileLAN are the LAN Configuration Parameters of the LAN channel
+type ProfileLAN struct {
+	// IPSource is "static" or "dhcp"
+	IPSource       string `json:"ip_source" yaml:"ip_source"`
+	IPAddress      string `json:"ip_address" yaml:"ip_address"`
+	SubnetMask     string `json:"subnet_mask" yaml:"subnet_mask"`
+	DefaultGateway string `json:"default_gateway" yaml:"default_gateway"`
+	MACAddress     string `json:"mac_address" yaml:"mac_address"`
+	// VLANID enables 802.1q VLAN tagging if not 0
+	VLANID uint16 `json:"vlan_id" yaml:"vlan_id"`
+}
+
+// LoadProfile reads a Profile from the given file, which is decoded as JSON
+// or YAML depending on its extension. Unknown fields are an error.
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Profile{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(p)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(p)
+	default:
+		return nil, fmt.Errorf("%s: unknown profile format", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return p, nil
+}
+
+// NewSimulatorProfile constructs a Simulator with the given addr and the
+// Profile loaded from the given file
+func NewSimulatorProfile(addr net.UDPAddr, path string) (*Simulator, error) {
+	p, err := LoadProfile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewSimulator(addr)
+	if err := s.SetProfile(p); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return s, nil
+}
+
+// SetProfile applies the given Profile, adding to the SDR repository, SEL
+// and user table entries the Simulator already has.
+func (s *Simulator) SetProfile(p *Profile) error {
+	id, err := p.DeviceID.response()
+	if err != nil {
+		return err
+	}
+	s.SetDeviceID(id)
+
+	for i := range p.Sensors {
+		if err := s.addProfileSensor(&p.Sensors[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range p.SEL {
+		sensorType, err := parseSensorType(e.SensorType)
+		if err != nil {
+			return err
+		}
+		err = s.AddSELEntry(&SELEntry{
+			Timestamp:    e.Timestamp.UTC(),
+			GeneratorID:  0x20, // BMC
+			EvMRev:       0x04, // IPMI 1.5
+			SensorType:   sensorType,
+			SensorNumber: e.SensorNumber,
+			EventType:    e.EventType,
+			Deassertion:  e.Deassertion,
+			EventData:    e.EventData,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range p.FRU {
+		info, err := f.info()
+		if err != nil {
+			return err
+		}
+		if err := s.SetFRU(f.ID, info); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range p.Users {
+		privilege, err := parsePrivilege(u.Privilege)
+		if err != nil {
+			return err
+		}
+		user := SimulatorUser{Name: u.Name, Password: u.Password, Privilege: privilege, Enabled: !u.Disabled}
+		if err := s.SetUser(u.ID, user); err != nil {
+			return fmt.Errorf("user ID %d: %s", u.ID, err)
+		}
+	}
+
+	if p.LAN != nil {
+		if err := s.setProfileLAN(p.LAN); err != nil {
+			return err
+		}
+	}
+
+	if p.BootDevice != "" {
+		dev, err := parseBootDevice(p.BootDevice)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.bopts[BootParamBootFlags] = []uint8{0x80, uint8(dev), 0x00, 0x00, 0x00}
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (d *ProfileDeviceID) response() (DeviceIDResponse, error) {
+	id := DeviceIDResponse{
+		DeviceID:       d.DeviceID,
+		DeviceRevision: d.DeviceRevision,
+		IPMIVersion:    0x51, // 1.5
+		ManufacturerID: d.Manufacturer,
+		ProductID:      d.Product,
+	}
+
+	if d.Firmware != "" {
+		// the minor revision is BCD encoded, as printed by ipmitool
+		major, minor, _ := strings.Cut(d.Firmware, ".")
+		if minor == "" {
+			minor = "0"
+		}
+		v1, err1 := strconv.ParseUint(major, 10, 7)
+		v2, err2 := strconv.ParseUint(minor, 16, 8)
+		if err1 != nil || err2 != nil || len(minor) > 2 || strings.ContainsAny(minor, "abcdefABCDEF") {
+			return id, fmt.Errorf("invalid firmware revision %q", d.Firmware)
+		}
+		id.FirmwareRevision1 = uint8(v1)
+		id.FirmwareRevision2 = uint8(v2)
+	}
+
+	return id, nil
+}
+
+func (s *Simulator) addProfileSensor(p *ProfileSensor) error {
+	sensorType, err := parseSensorType(p.Type)
+	if err != nil {
+		return err
+	}
+	units, err := parseUnits(p.Units)
+	if err != nil {
+		return err
+	}
+	state, err := parseThresholdStatus(p.Status)
+	if err != nil {
+		return err
+	}
+
+	sdr := &SDR{
+		RecordType:   SDRTypeFullSensor,
+		OwnerID:      0x20, // BMC
+		SensorNumber: p.Number,
+		SensorType:   sensorType,
+		EventType:    EventTypeThreshold,
+		BaseUnit:     units,
+		M:            p.M,
+		B:            p.B,
+		BExp:         p.BExp,
+		RExp:         p.RExp,
+		Name:         p.Name,
+	}
+	if sdr.M == 0 {
+		sdr.M = 1
+	}
+
+	if err := s.AddSDR(sdr); err != nil {
+		return err
+	}
+	if p.Value != nil {
+		return s.SetSensorReading(p.Number, *p.Value, state)
+	}
+	return nil
+}
+
+func (f *ProfileFRU) info() (*FRUInfo, error) {
+	chassisType, err := parseChassisType(f.ChassisType)
+	if err != nil {
+		return nil, err
+	}
+	return &FRUInfo{
+		ChassisType:         chassisType,
+		ChassisPartNumber:   f.ChassisPartNumber,
+		ChassisSerial:       f.ChassisSerial,
+		BoardMfgDate:        f.BoardMfgDate,
+		BoardManufacturer:   f.BoardManufacturer,
+		BoardProduct:        f.BoardProduct,
+		BoardSerial:         f.BoardSerial,
+		BoardPartNumber:     f.BoardPartNumber,
+		ProductManufacturer: f.ProductManufacturer,
+		ProductName:         f.ProductName,
+		ProductPartNumber:   f.ProductPartNumber,
+		ProductVersion:      f.ProductVersion,
+		ProductSerial:       f.ProductSerial,
+		ProductAssetTag:     f.ProductAssetTag,
+	}, nil
+}
+
+func (s *Simulator) setProfileLAN(p *ProfileLAN) error {
+	switch strings.ToLower(p.IPSource) {
+	case "":
+	case "static":
+		s.SetLANConfig(LANParamIPSource, []byte{LANIPSourceStatic})
+	case "dhcp":
+		s.SetLANConfig(LANParamIPSource, []byte{LANIPSourceDHCP})
+	default:
+		return fmt.Errorf("unknown IP address source %q", p.IPSource)
+	}
+
+	for param, addr := range map[uint8]string{
+		LANParamIPAddress:      p.IPAddress,
+		LANParamSubnetMask:     p.SubnetMask,
+		LANParamDefaultGateway: p.DefaultGateway,
+	} {
+		if addr == "" {
+			continue
+		}
+		ip := net.ParseIP(addr).To4()
+		if ip == nil {
+			return fmt.Errorf("invalid IPv4 address %q", addr)
+		}
+		s.SetLANConfig(param, ip)
+	}
+
+	if p.MACAddress != "" {
+		mac, err := net.ParseMAC(p.MACAddress)
+		if err != nil || len(mac) != 6 {
+			return fmt.Errorf("invalid MAC address %q", p.MACAddress)
+		}
+		s.SetLANConfig(LANParamMACAddress, mac)
+	}
+
+	if p.VLANID != 0 {
+		if p.VLANID > 0x0fff {
+			return fmt.Errorf("invalid VLAN ID %d", p.VLANID)
+		}
+		vlan := make([]byte, 2)
+		binary.LittleEndian.PutUint16(vlan, 0x8000|p.VLANID) // enabled
+		s.SetLANConfig(LANParamVLANID, vlan)
+	}
+
+	return nil
+}
+
+func parseSensorType(name string) (SensorType, error) {
+	for t, s := range sensorTypeStrings {
+		if strings.EqualFold(s, name) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sensor type %q", name)
+}
+
+func parseUnits(name string) (uint8, error) {
+	for i, s := range sensorUnits {
+		if strings.EqualFold(s, name) {
+			return uint8(i), nil
+		}
+	}
+	if name == "" {
+		return 0, nil // unspecified
+	}
+	return 0, fmt.Errorf("unknown sensor units %q", name)
+}
+
+func parseThresholdStatus(status string) (uint8, error) {
+	switch strings.ToLower(status) {
+	case "", "ok":
+		return 0, nil
+	case "nc":
+		return ThresholdUpperNonCritical, nil
+	case "cr":
+		return ThresholdUpperNonCritical | ThresholdUpperCritical, nil
+	case "nr":
+		return ThresholdUpperNonCritical | ThresholdUpperCritical | ThresholdUpperNonRecoverable, nil
+	}
+	return 0, fmt.Errorf("unknown threshold status %q", status)
+}
+
+func parseChassisType(name string) (ChassisType, error) {
+	if name == "" {
+		return 0, nil
+	}
+	for i, s := range chassisTypeStrings {
+		if strings.EqualFold(s, name) {
+			return ChassisType(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown chassis type %q", name)
+}
+
+func parsePrivilege(name string) (uint8, error) {
+	switch strings.ToLower(name) {
+	case "", "administrator", "admin":
+		return PrivLevelAdmin, nil
+	case "operator":
+		return PrivLevelOperator, nil
+	case "user":
+		return PrivLevelUser, nil
+	case "callback":
+		return PrivLevelCallback, nil
+	}
+	return 0, fmt.Errorf("unknown privilege level %q", name)
+}
+
+func parseBootDevice(name string) (BootDevice, error) {
+	for dev, s := range bootDeviceStrings {
+		if strings.EqualFold(s, name) {
+			return dev, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown boot device %q", name)
+}
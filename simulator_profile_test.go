@@ -0,0 +1,161 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorProfile(t *testing.T) {
+	tests := []struct {
+		path     string
+		oem      OemID
+		firmware [2]uint8
+		sensors  map[string]float64
+		sel      int
+		product  string
+		username string
+		password string
+		boot     BootDevice
+		ip       []byte
+	}{
+		{
+			"testdata/dell-r640.yaml", OemDell, [2]uint8{4, 0x40},
+			map[string]float64{"Inlet Temp": 23, "Exhaust Temp": 38, "Fan1": 5640, "Pwr Consumption": 238},
+			2, "PowerEdge R640", "root", "calvin", BootDeviceDisk, []byte{10, 0, 0, 120},
+		},
+		{
+			"testdata/supermicro-x11.json", OemSupermicro, [2]uint8{1, 0x73},
+			map[string]float64{"CPU Temp": 41, "System Temp": 29, "FAN1": 3300},
+			0, "SYS-6029P-TR", "ADMIN", "ADMIN", BootDevicePxe, []byte{192, 168, 1, 50},
+		},
+	}
+
+	for _, test := range tests {
+		s, err := NewSimulatorProfile(net.UDPAddr{}, test.path)
+		assert.NoError(t, err, test.path)
+		err = s.Run()
+		assert.NoError(t, err)
+
+		c := s.NewConnection()
+		c.Username = test.username
+		c.Password = test.password
+		client, err := NewClient(c)
+		assert.NoError(t, err)
+		err = client.Open()
+		assert.NoError(t, err, test.path)
+
+		id, err := client.DeviceID()
+		assert.NoError(t, err)
+		assert.Equal(t, test.oem, id.ManufacturerID, test.path)
+		assert.Equal(t, test.firmware, [2]uint8{id.FirmwareRevision1, id.FirmwareRevision2}, test.path)
+
+		sensors, err := client.Sensors()
+		assert.NoError(t, err)
+		for _, sensor := range sensors {
+			value, ok := test.sensors[sensor.Name]
+			assert.Equal(t, ok, sensor.Available(), "%s: %s", test.path, sensor.Name)
+			assert.InDelta(t, value, sensor.Value, 0.001, "%s: %s", test.path, sensor.Name)
+		}
+
+		entries, err := client.SELEntries()
+		assert.NoError(t, err)
+		assert.Equal(t, test.sel, len(entries), test.path)
+
+		info, err := client.FRU(0)
+		assert.NoError(t, err)
+		assert.Equal(t, test.product, info.ProductName, test.path)
+
+		bor := &SystemBootOptionsResponse{}
+		err = client.Send(&Request{NetworkFunctionChassis, CommandGetSystemBootOptions, &SystemBootOptionsRequest{Param: BootParamBootFlags}}, bor)
+		assert.NoError(t, err)
+		assert.Equal(t, test.boot, bor.BootDeviceSelector(), test.path)
+
+		res := &LANConfigResponse{}
+		err = client.Send(&Request{NetworkFunctionTransport, CommandGetLANConfig, &LANConfigRequest{ChannelNumber: lanChannelE, Param: LANParamIPAddress}}, res)
+		assert.NoError(t, err)
+		assert.Equal(t, test.ip, res.Data, test.path)
+
+		err = client.Close()
+		assert.NoError(t, err)
+		s.Stop()
+	}
+}
+
+func TestSimulatorProfileDetails(t *testing.T) {
+	p, err := LoadProfile("testdata/dell-r640.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.March, 1, 8, 15, 0, 0, time.UTC), p.SEL[0].Timestamp)
+	assert.Equal(t, [3]uint8{0x03, 0xff, 0xff}, p.SEL[0].EventData)
+
+	s := NewSimulator(net.UDPAddr{})
+	assert.NoError(t, s.SetProfile(p))
+
+	user, _ := s.User(3)
+	assert.Equal(t, SimulatorUser{Name: "monitor", Password: "readonly", Privilege: PrivLevelUser, Enabled: true}, user)
+	assert.Equal(t, []byte{0xd0, 0x94, 0x66, 0x2a, 0x11, 0xee}, s.lanConfig[LANParamMACAddress])
+	assert.Equal(t, []byte{LANIPSourceStatic}, s.lanConfig[LANParamIPSource])
+	assert.Equal(t, []byte{100, 0x80}, s.lanConfig[LANParamVLANID])
+
+	s, err = NewSimulatorProfile(net.UDPAddr{}, "testdata/supermicro-x11.json")
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(ThresholdUpperNonCritical), s.sensors[65].state)
+	assert.False(t, s.sensors[48].valid)
+	assert.Equal(t, int8(-3), s.sensors[48].sdr.RExp)
+}
+
+func TestSimulatorProfileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		profile string
+	}{
+		{"unknown.toml", ``},
+		{"unknown.json", `{"sensor": []}`},
+		{"unknown.yaml", "sensor: []\n"},
+		{"type.yaml", "sensors:\n  - {number: 1, type: Warp Core}\n"},
+		{"units.yaml", "sensors:\n  - {number: 1, type: Fan, units: furlongs}\n"},
+		{"status.yaml", "sensors:\n  - {number: 1, type: Fan, status: meh}\n"},
+		{"firmware.yaml", "device_id: {firmware: 1.x}\n"},
+		{"chassis.yaml", "fru:\n  - {chassis_type: Teapot}\n"},
+		{"privilege.yaml", "users:\n  - {id: 2, privilege: root}\n"},
+		{"user.yaml", "users:\n  - {id: 0}\n"},
+		{"ip.yaml", "lan: {ip_address: 300.1.1.1}\n"},
+		{"mac.yaml", "lan: {mac_address: 11:22}\n"},
+		{"source.yaml", "lan: {ip_source: bootp}\n"},
+		{"vlan.yaml", "lan: {vlan_id: 5000}\n"},
+		{"boot.yaml", "boot_device: tape\n"},
+		{"sel.yaml", "sel:\n  - {sensor_type: Nope}\n"},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		assert.NoError(t, os.WriteFile(path, []byte(test.profile), 0600))
+		_, err := NewSimulatorProfile(net.UDPAddr{}, path)
+		assert.Error(t, err, test.name)
+	}
+
+	_, err := LoadProfile(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
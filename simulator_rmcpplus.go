@@ -0,0 +1,359 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// simPlusSession is the RMCP+ state of a simulated session
+type simPlusSession struct {
+	rakp
+	// keys are set once RAKP Message 3 is verified, then left unchanged
+	keys *rmcpPlusKeys
+	// addr of the remote console's last authenticated message
+	addr   net.Addr
+	outSeq atomic.Uint32
+}
+
+// message encodes a payload sent to the remote console
+func (p *simPlusSession) message(payloadType uint8, payload []byte) []byte {
+	m := &rmcpPlusMessage{
+		PayloadType: payloadType,
+		SessionID:   p.consoleID,
+		Sequence:    p.outSeq.Add(1),
+		Payload:     payload,
+	}
+	return m.toBytes(p.keys)
+}
+
+// SetBMCKey sets the BMC key, Kg, of RMCP+ sessions.
+// By default the key is not set and the user password is used instead.
+func (s *Simulator) SetBMCKey(key string) {
+	s.mu.Lock()
+	s.bmcKey = key
+	s.mu.Unlock()
+}
+
+// plusCommand handles an RMCP+ message, returning the response to send
+// and the fault of the command, if any
+func (s *Simulator) plusCommand(buf []byte, addr net.Addr) ([]byte, *Fault) {
+	m, err := rmcpPlusFromBytes(buf)
+	if err != nil {
+		s.logger.Warn("invalid RMCP+ request", "addr", addr, "err", err)
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	timeout := s.sessionTimeout
+	s.mu.Unlock()
+
+	now := time.Now()
+	s.expireSessions(now, timeout)
+
+	// session setup messages are sent outside of a session
+	switch m.PayloadType & payloadTypeMask {
+	case PayloadTypeOpenSessionRequest:
+		return s.openSession(m, now), nil
+	case PayloadTypeRAKP1:
+		return s.rakp1(m, now), nil
+	case PayloadTypeRAKP3:
+		return s.rakp3(m, now), nil
+	}
+
+	// sessionless IPMI payloads are limited to commands that need no privilege
+	if m.SessionID == 0 && m.PayloadType == PayloadTypeIPMI {
+		req, err := rmcpPlusIPMIFromBytes(m)
+		if err != nil {
+			s.logger.Warn("invalid IPMI payload", "addr", addr, "err", err)
+			return nil, nil
+		}
+		m.Payload = s.payloadBytes(req, s.execute(req, nil, PrivLevelNone))
+		return m.toBytes(nil), s.fault(req.NetFn(), req.Command)
+	}
+
+	// as with IPMI v1.5, messages that fail to authenticate are discarded
+	session := s.sessions[m.SessionID]
+	if session == nil || session.plus == nil || session.inbound == nil {
+		s.logger.Debug("dropped message with invalid session ID", "id", m.SessionID)
+		return nil, nil
+	}
+	if err := m.open(session.plus.keys); err != nil {
+		s.logger.Debug("dropped message with invalid auth code", "user", session.username, "err", err)
+		return nil, nil
+	}
+	if err := session.inbound.accept(m.Sequence); err != nil {
+		s.logger.Debug("dropped message outside of the sequence window", "err", err)
+		return nil, nil
+	}
+	session.lastActive = now
+	session.plus.addr = addr
+
+	switch m.PayloadType & payloadTypeMask {
+	case PayloadTypeIPMI:
+		req, err := rmcpPlusIPMIFromBytes(m)
+		if err != nil {
+			s.logger.Warn("invalid IPMI payload", "addr", addr, "err", err)
+			return nil, nil
+		}
+		fault := s.fault(req.NetFn(), req.Command)
+		response := s.execute(req, session, session.priv)
+		return session.plus.message(PayloadTypeIPMI, s.payloadBytes(req, response)), fault
+	case PayloadTypeSOL:
+		if ack := s.sol.receive(m.SessionID, m.Payload); ack != nil {
+			return session.plus.message(PayloadTypeSOL, ack), nil
+		}
+	default:
+		s.logger.Debug("dropped unsupported payload", "type", m.PayloadType&payloadTypeMask)
+	}
+
+	return nil, nil
+}
+
+// payloadBytes encodes the response to req as an RMCP+ payload, a response
+// that cannot be encoded is replaced with ErrUnspecified
+func (s *Simulator) payloadBytes(req *Message, response Response) []byte {
+	buf, err := req.payloadBytes(response)
+	if err != nil {
+		s.logger.Warn("invalid response", "netfn", req.NetFn(), "cmd", req.Command, "err", err)
+		buf, _ = req.payloadBytes(ErrUnspecified)
+	}
+	s.corruptChecksum(req, buf)
+	return buf
+}
+
+// rakpResponse encodes a session setup message
+func (s *Simulator) rakpResponse(payloadType uint8, res interface{}) []byte {
+	buf, err := messageDataToBytes(res)
+	if err != nil {
+		s.logger.Warn("invalid session setup response", "type", payloadType, "err", err)
+		return nil
+	}
+	m := &rmcpPlusMessage{
+		PayloadType: payloadType,
+		Payload:     buf,
+	}
+	return m.toBytes(nil)
+}
+
+func (s *Simulator) openSession(m *rmcpPlusMessage, now time.Time) []byte {
+	req := &OpenSessionRequest{}
+	if err := Unmarshal(m.Payload, req); err != nil {
+		s.logger.Debug("dropped invalid Open Session request", "err", err)
+		return nil
+	}
+
+	res := &OpenSessionResponse{
+		MessageTag:       req.MessageTag,
+		ConsoleSessionID: req.ConsoleSessionID,
+	}
+
+	s.mu.Lock()
+	maxSessions := s.maxSessions
+	s.mu.Unlock()
+
+	// level 0 requests the highest level the algorithms allow
+	priv := req.MaxPriv
+	if priv == PrivLevelNone {
+		priv = PrivLevelAdmin
+	}
+
+	suite, ok := findCipherSuite(req.Auth.Algorithm, req.Integrity.Algorithm, req.Confidentiality.Algorithm)
+	switch {
+	case !ok:
+		res.Status = rakpStatusNoCipherSuiteMatch
+	case priv > PrivLevelOEM:
+		res.Status = rakpStatusInvalidRole
+	case s.activeSessions() >= maxSessions:
+		res.Status = rakpStatusInsufficientResources
+	default:
+		session := &simSession{
+			authType:   authTypeRMCPPlus,
+			maxPriv:    priv,
+			lastActive: now,
+			plus: &simPlusSession{
+				rakp: rakp{
+					suite:     suite,
+					consoleID: req.ConsoleSessionID,
+					bmcGUID:   s.guid,
+				},
+			},
+		}
+		id := s.addSession(session)
+		session.plus.bmcID = id
+
+		res.MaxPriv = priv
+		res.BMCSessionID = id
+		res.Auth = req.Auth
+		res.Integrity = req.Integrity
+		res.Confidentiality = req.Confidentiality
+	}
+
+	return s.rakpResponse(PayloadTypeOpenSessionResponse, res)
+}
+
+// pendingSession returns the session opened with the given ID that is
+// not yet active, or nil
+func (s *Simulator) pendingSession(id uint32) *simSession {
+	session := s.sessions[id]
+	if session == nil || session.plus == nil || session.inbound != nil {
+		return nil
+	}
+	return session
+}
+
+func (s *Simulator) rakp1(m *rmcpPlusMessage, now time.Time) []byte {
+	req := &RAKPMessage1{}
+	if err := Unmarshal(m.Payload, req); err != nil {
+		s.logger.Debug("dropped invalid RAKP Message 1", "err", err)
+		return nil
+	}
+
+	res := &RAKPMessage2{MessageTag: req.MessageTag}
+	session := s.pendingSession(req.BMCSessionID)
+	if session == nil {
+		res.Status = rakpStatusInvalidSessionID
+		return s.rakpResponse(PayloadTypeRAKP2, res)
+	}
+	plus := session.plus
+	res.ConsoleSessionID = plus.consoleID
+
+	s.mu.Lock()
+	var password string
+	limit := uint8(PrivLevelNone)
+	if user := s.lookupUser(req.Username); user != nil && user.Enabled {
+		password = user.Password
+		limit = user.privilege()
+	}
+	bmcKey := s.bmcKey
+	s.mu.Unlock()
+
+	priv := req.Role & 0x0f
+	switch {
+	case int(req.UsernameLength) != len(req.Username) || len(req.Username) > 16:
+		res.Status = rakpStatusInvalidNameLength
+	case limit == PrivLevelNone:
+		res.Status = rakpStatusUnauthorizedName
+	case req.Role&rakpNameOnlyLookup == 0 && priv != limit:
+		// name and privilege lookup, there is no user with this limit
+		res.Status = rakpStatusUnauthorizedName
+	case priv == PrivLevelNone || priv > PrivLevelOEM:
+		res.Status = rakpStatusInvalidRole
+	case priv > limit || priv > session.maxPriv:
+		res.Status = rakpStatusUnauthorizedRole
+	}
+	if res.Status != rakpStatusOK {
+		s.removeSession(req.BMCSessionID)
+		return s.rakpResponse(PayloadTypeRAKP2, res)
+	}
+
+	session.username = req.Username
+	session.limit = limit
+	session.maxPriv = priv
+	session.lastActive = now
+
+	plus.username = req.Username
+	plus.role = req.Role
+	plus.consoleRandom = req.ConsoleRandom
+	if _, err := rand.Read(plus.bmcRandom[:]); err != nil {
+		panic(err)
+	}
+	plus.kuid = rakpKey(password)
+	plus.kg = plus.kuid
+	if bmcKey != "" {
+		plus.kg = rakpKey(bmcKey)
+	}
+
+	res.BMCRandom = plus.bmcRandom
+	res.BMCGUID = plus.bmcGUID
+	res.AuthCode = plus.bmcAuthCode()
+
+	return s.rakpResponse(PayloadTypeRAKP2, res)
+}
+
+func (s *Simulator) rakp3(m *rmcpPlusMessage, now time.Time) []byte {
+	req := &RAKPMessage3{}
+	if err := Unmarshal(m.Payload, req); err != nil {
+		s.logger.Debug("dropped invalid RAKP Message 3", "err", err)
+		return nil
+	}
+
+	res := &RAKPMessage4{MessageTag: req.MessageTag}
+	session := s.pendingSession(req.BMCSessionID)
+	if session == nil || session.plus.kuid == nil {
+		res.Status = rakpStatusInvalidSessionID
+		return s.rakpResponse(PayloadTypeRAKP4, res)
+	}
+	plus := session.plus
+	res.ConsoleSessionID = plus.consoleID
+
+	// the remote console reports a failure to authenticate us
+	if req.Status != rakpStatusOK {
+		s.removeSession(req.BMCSessionID)
+		return nil
+	}
+
+	s.mu.Lock()
+	maxSessions := s.maxSessions
+	s.mu.Unlock()
+
+	switch {
+	case !hmac.Equal(req.AuthCode, plus.consoleAuthCode()):
+		res.Status = rakpStatusInvalidIntegrity
+	case s.activeSessions() >= maxSessions:
+		res.Status = rakpStatusInsufficientResources
+	}
+	if res.Status != rakpStatusOK {
+		s.removeSession(req.BMCSessionID)
+		return s.rakpResponse(PayloadTypeRAKP4, res)
+	}
+
+	// sessions start at User level, or below if that is the session limit
+	session.priv = min(session.maxPriv, PrivLevelUser)
+	session.authRequired = true
+	session.inbound = newSequenceWindow(seqWindowV20, 0)
+	session.lastActive = now
+	plus.keys = plus.rakp.keys()
+
+	res.IntegrityCheck = plus.integrityCheck()
+
+	return s.rakpResponse(PayloadTypeRAKP4, res)
+}
+
+func (s *Simulator) channelCipherSuites(m *Message) Response {
+	req := &ChannelCipherSuitesRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+	if req.PayloadType != PayloadTypeIPMI {
+		return ErrInvalidPacket
+	}
+
+	records := cipherSuiteRecords(cipherSuites)
+	start := min(int(req.ListIndex&0x3f)*16, len(records))
+	end := min(start+16, len(records))
+
+	return &ChannelCipherSuitesResponse{
+		CompletionCode: CommandCompleted,
+		ChannelNumber:  0x01,
+		Records:        records[start:end],
+	}
+}
@@ -0,0 +1,390 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// plusConsole is a minimal RMCP+ remote console to test the Simulator
+type plusConsole struct {
+	conn   *net.UDPConn
+	bmcKey string
+	// privLookup selects name and privilege user lookup
+	privLookup bool
+	rakp       rakp
+	keys       *rmcpPlusKeys
+	seq        uint32
+	rqSeq      uint8
+}
+
+func newPlusConsole(t *testing.T, s *Simulator) *plusConsole {
+	conn, err := net.DialUDP("udp4", nil, s.LocalAddr())
+	assert.NoError(t, err)
+	return &plusConsole{conn: conn}
+}
+
+func (c *plusConsole) close() {
+	_ = c.conn.Close()
+}
+
+func (c *plusConsole) write(m *rmcpPlusMessage) error {
+	_, err := c.conn.Write(m.toBytes(c.keys))
+	return err
+}
+
+func (c *plusConsole) read() (*rmcpPlusMessage, error) {
+	buf := make([]byte, ipmiBufSize)
+	if err := c.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+		return nil, err
+	}
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	m, err := rmcpPlusFromBytes(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+	return m, m.open(c.keys)
+}
+
+// setup exchanges a session setup message
+func (c *plusConsole) setup(payloadType uint8, req, res interface{}) error {
+	err := c.write(&rmcpPlusMessage{PayloadType: payloadType, Payload: mustBytes(messageDataToBytes(req))})
+	if err != nil {
+		return err
+	}
+	m, err := c.read()
+	if err != nil {
+		return err
+	}
+	if m.PayloadType != payloadType+1 {
+		return ErrInvalidPacket
+	}
+	return Unmarshal(m.Payload, res)
+}
+
+// open a session, returning the status of the setup message that failed
+func (c *plusConsole) open(suite cipherSuite, username, password string, role uint8) (uint8, error) {
+	c.keys = nil
+	c.seq = 0
+	c.rakp = rakp{
+		suite:     suite,
+		consoleID: 0x5a5a0001,
+		role:      role | rakpNameOnlyLookup,
+		username:  username,
+		kuid:      rakpKey(password),
+	}
+	if c.privLookup {
+		c.rakp.role = role
+	}
+	c.rakp.kg = c.rakp.kuid
+	if c.bmcKey != "" {
+		c.rakp.kg = rakpKey(c.bmcKey)
+	}
+
+	open := &OpenSessionResponse{}
+	err := c.setup(PayloadTypeOpenSessionRequest, &OpenSessionRequest{
+		MessageTag:       1,
+		MaxPriv:          role,
+		ConsoleSessionID: c.rakp.consoleID,
+		Auth:             AlgorithmPayload{Type: 0, Length: 8, Algorithm: suite.auth},
+		Integrity:        AlgorithmPayload{Type: 1, Length: 8, Algorithm: suite.integrity},
+		Confidentiality:  AlgorithmPayload{Type: 2, Length: 8, Algorithm: suite.confidentiality},
+	}, open)
+	if err != nil || open.Status != rakpStatusOK {
+		return open.Status, err
+	}
+	c.rakp.bmcID = open.BMCSessionID
+
+	if _, err := rand.Read(c.rakp.consoleRandom[:]); err != nil {
+		return 0, err
+	}
+	rakp2 := &RAKPMessage2{}
+	err = c.setup(PayloadTypeRAKP1, &RAKPMessage1{
+		MessageTag:     2,
+		BMCSessionID:   c.rakp.bmcID,
+		ConsoleRandom:  c.rakp.consoleRandom,
+		Role:           c.rakp.role,
+		UsernameLength: uint8(len(username)),
+		Username:       username,
+	}, rakp2)
+	if err != nil || rakp2.Status != rakpStatusOK {
+		return rakp2.Status, err
+	}
+	c.rakp.bmcRandom = rakp2.BMCRandom
+	c.rakp.bmcGUID = rakp2.BMCGUID
+
+	rakp3 := &RAKPMessage3{
+		MessageTag:   3,
+		BMCSessionID: c.rakp.bmcID,
+		AuthCode:     c.rakp.consoleAuthCode(),
+	}
+	if !hmac.Equal(rakp2.AuthCode, c.rakp.bmcAuthCode()) {
+		// a wrong password is detected by the console
+		rakp3.Status = rakpStatusInvalidIntegrity
+		_ = c.write(&rmcpPlusMessage{PayloadType: PayloadTypeRAKP3, Payload: mustBytes(messageDataToBytes(rakp3))})
+		return 0, ErrAuthCode
+	}
+
+	rakp4 := &RAKPMessage4{}
+	err = c.setup(PayloadTypeRAKP3, rakp3, rakp4)
+	if err != nil || rakp4.Status != rakpStatusOK {
+		return rakp4.Status, err
+	}
+	if !hmac.Equal(rakp4.IntegrityCheck, c.rakp.integrityCheck()) {
+		return 0, ErrAuthCode
+	}
+
+	c.keys = c.rakp.keys()
+	return rakpStatusOK, nil
+}
+
+// message encodes a payload of the open session
+func (c *plusConsole) message(payloadType uint8, payload []byte) *rmcpPlusMessage {
+	c.seq++
+	return &rmcpPlusMessage{
+		PayloadType: payloadType,
+		SessionID:   c.rakp.bmcID,
+		Sequence:    c.seq,
+		Payload:     payload,
+	}
+}
+
+func (c *plusConsole) send(netfn NetworkFunction, cmd Command, req interface{}, res Response) error {
+	c.rqSeq++
+	m := &Message{
+		ipmiSession: &ipmiSession{},
+		ipmiHeader: &ipmiHeader{
+			RsAddr:     0x20,
+			NetFnRsLUN: uint8(netfn) << 2,
+			RqAddr:     0x81,
+			RqSeq:      c.rqSeq << 2,
+			Command:    cmd,
+		},
+	}
+	if err := c.write(c.message(PayloadTypeIPMI, mustBytes(m.payloadBytes(req)))); err != nil {
+		return err
+	}
+
+	p, err := c.read()
+	if err != nil {
+		return err
+	}
+	if p.PayloadType&payloadTypeMask != PayloadTypeIPMI || p.SessionID != c.rakp.consoleID {
+		return ErrInvalidPacket
+	}
+	rm, err := rmcpPlusIPMIFromBytes(p)
+	if err != nil {
+		return err
+	}
+	return rm.Response(res)
+}
+
+func isTimeoutError(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func TestSimulatorRMCPPlus(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	err := s.Run()
+	assert.NoError(t, err)
+	s.SetPassword("admin", "secret")
+	s.SetDeviceID(DeviceIDResponse{ManufacturerID: OemDell, IPMIVersion: 0x51})
+
+	// v2.0 sessions are reported as well as v1.5
+	l := newLanTransport(s.NewConnection()).(*lan)
+	assert.NoError(t, l.connect())
+	caps, err := l.capabilities()
+	assert.NoError(t, err)
+	assert.True(t, caps.SupportsIPMIv15())
+	assert.True(t, caps.SupportsIPMIv20())
+	assert.NoError(t, l.close())
+
+	for _, suite := range cipherSuites {
+		c := newPlusConsole(t, s)
+
+		res := &ChannelCipherSuitesResponse{}
+		err := c.send(NetworkFunctionApp, CommandGetChannelCipherSuites, &ChannelCipherSuitesRequest{ChannelNumber: 0x0e}, res)
+		assert.NoError(t, err)
+		assert.Equal(t, cipherSuiteRecords(cipherSuites)[:16], res.Records)
+
+		status, err := c.open(suite, "admin", "secret", PrivLevelAdmin)
+		assert.NoError(t, err, "suite %d", suite.id)
+		assert.Equal(t, uint8(rakpStatusOK), status)
+
+		id := &DeviceIDResponse{}
+		err = c.send(NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}, id)
+		assert.NoError(t, err)
+		assert.Equal(t, OemDell, id.ManufacturerID)
+
+		// the checksum is corrupted inside the authenticated payload
+		s.SetFault(NetworkFunctionApp, CommandGetDeviceID, Fault{CorruptChecksum: 1})
+		err = c.send(NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}, id)
+		assert.Equal(t, ErrInvalidPacket, err, "suite %d", suite.id)
+		s.ClearFaults()
+
+		// sessions start at User level
+		err = c.send(NetworkFunctionChassis, CommandChassisControl, &ChassisControlRequest{ChassisControl: ControlPowerCycle}, &ChassisControlResponse{})
+		assert.Equal(t, ErrPrivLevel, err)
+		priv := &SessionPrivilegeLevelResponse{}
+		err = c.send(NetworkFunctionApp, CommandSetSessionPrivilegeLevel, &SessionPrivilegeLevelRequest{PrivLevel: PrivLevelAdmin}, priv)
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(PrivLevelAdmin), priv.NewPrivilegeLevel)
+		err = c.send(NetworkFunctionChassis, CommandChassisControl, &ChassisControlRequest{ChassisControl: ControlPowerCycle}, &ChassisControlResponse{})
+		assert.NoError(t, err)
+
+		// replayed messages are discarded
+		replay := c.message(PayloadTypeIPMI, nil)
+		c.seq--
+		err = c.send(NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}, id)
+		assert.NoError(t, err)
+		replay.Payload = mustBytes((&Message{ipmiSession: &ipmiSession{}, ipmiHeader: &ipmiHeader{RsAddr: 0x20, NetFnRsLUN: uint8(NetworkFunctionApp) << 2, Command: CommandGetDeviceID}}).payloadBytes(&DeviceIDRequest{}))
+		assert.NoError(t, c.write(replay))
+		_, err = c.read()
+		assert.True(t, isTimeoutError(err))
+
+		err = c.send(NetworkFunctionApp, CommandCloseSession, &CloseSessionRequest{SessionID: c.rakp.bmcID}, &CloseSessionResponse{})
+		assert.NoError(t, err)
+		err = c.send(NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}, id)
+		assert.True(t, isTimeoutError(err))
+
+		c.close()
+	}
+
+	// the BMC key replaces the password in the session keys
+	s.SetBMCKey("kg")
+	c := newPlusConsole(t, s)
+	c.bmcKey = "kg"
+	_, err = c.open(cipherSuites[3], "admin", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+	assert.NoError(t, c.send(NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}, &DeviceIDResponse{}))
+	c.close()
+
+	c = newPlusConsole(t, s)
+	_, err = c.open(cipherSuites[3], "admin", "secret", PrivLevelAdmin)
+	assert.Equal(t, ErrAuthCode, err)
+	c.close()
+
+	s.Stop()
+}
+
+func TestSimulatorRMCPPlusErrors(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	err := s.Run()
+	assert.NoError(t, err)
+	s.SetPassword("admin", "secret")
+	assert.NoError(t, s.SetUser(3, SimulatorUser{Name: "monitor", Password: "view", Privilege: PrivLevelUser, Enabled: true}))
+	suite := cipherSuites[3]
+
+	c := newPlusConsole(t, s)
+	defer c.close()
+
+	// sessions count towards the limit once active
+	s.SetMaxSessions(1)
+	status, err := c.open(suite, "admin", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusOK), status)
+	other := newPlusConsole(t, s)
+	status, err = other.open(suite, "admin", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusInsufficientResources), status)
+	other.close()
+
+	// messages that fail to authenticate are discarded
+	buf := c.message(PayloadTypeIPMI, []byte{0x20, 0x18, 0xc8, 0x81, 0x04, 0x01, 0x7a}).toBytes(c.keys)
+	buf[len(buf)-1] ^= 0x01
+	_, err = c.conn.Write(buf)
+	assert.NoError(t, err)
+	_, err = c.read()
+	assert.True(t, isTimeoutError(err))
+	assert.NoError(t, c.send(NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}, &DeviceIDResponse{}))
+	err = c.send(NetworkFunctionApp, CommandCloseSession, &CloseSessionRequest{SessionID: c.rakp.bmcID}, &CloseSessionResponse{})
+	assert.NoError(t, err)
+	s.SetMaxSessions(defaultMaxSessions)
+
+	status, err = c.open(cipherSuite{auth: authRAKPHMACSHA1, integrity: integrityHMACSHA256}, "admin", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusNoCipherSuiteMatch), status)
+
+	status, err = c.open(suite, "nobody", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusUnauthorizedName), status)
+
+	status, err = c.open(suite, "monitor", "view", PrivLevelAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusUnauthorizedRole), status)
+	status, err = c.open(suite, "monitor", "view", PrivLevelUser)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusOK), status)
+	err = c.send(NetworkFunctionApp, CommandSetSessionPrivilegeLevel, &SessionPrivilegeLevelRequest{PrivLevel: PrivLevelAdmin}, &SessionPrivilegeLevelResponse{})
+	assert.Equal(t, ErrSessionPrivLimit, err)
+
+	// name and privilege lookup only finds users with the requested limit
+	c.privLookup = true
+	status, err = c.open(suite, "admin", "secret", PrivLevelUser)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusUnauthorizedName), status)
+	status, err = c.open(suite, "admin", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusOK), status)
+	c.privLookup = false
+
+	// a wrong password fails to authenticate the BMC, and the session is closed
+	_, err = c.open(suite, "admin", "wrong", PrivLevelAdmin)
+	assert.Equal(t, ErrAuthCode, err)
+	time.Sleep(10 * time.Millisecond)
+	rakp4 := &RAKPMessage4{}
+	err = c.setup(PayloadTypeRAKP3, &RAKPMessage3{BMCSessionID: c.rakp.bmcID}, rakp4)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusInvalidSessionID), rakp4.Status)
+
+	// as does a console that does not know the password
+	_, err = c.open(suite, "admin", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+	c.keys = nil
+	c.rakp.kuid = rakpKey("wrong")
+	open := &OpenSessionResponse{}
+	err = c.setup(PayloadTypeOpenSessionRequest, &OpenSessionRequest{
+		ConsoleSessionID: 1,
+		Auth:             AlgorithmPayload{Algorithm: suite.auth},
+		Integrity:        AlgorithmPayload{Algorithm: suite.integrity, Type: 1},
+		Confidentiality:  AlgorithmPayload{Algorithm: suite.confidentiality, Type: 2},
+	}, open)
+	assert.NoError(t, err)
+	rakp2 := &RAKPMessage2{}
+	err = c.setup(PayloadTypeRAKP1, &RAKPMessage1{BMCSessionID: open.BMCSessionID, Role: PrivLevelAdmin, UsernameLength: 5, Username: "admin"}, rakp2)
+	assert.NoError(t, err)
+	err = c.setup(PayloadTypeRAKP3, &RAKPMessage3{BMCSessionID: open.BMCSessionID, AuthCode: make([]byte, 20)}, rakp4)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusInvalidIntegrity), rakp4.Status)
+
+	err = c.setup(PayloadTypeRAKP1, &RAKPMessage1{BMCSessionID: 0x1234, Role: PrivLevelAdmin}, rakp2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(rakpStatusInvalidSessionID), rakp2.Status)
+
+	s.Stop()
+}
@@ -0,0 +1,341 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// Session defaults of the Simulator
+const (
+	// defaultSessionTimeout is the inactivity timeout per section 6.12.15
+	defaultSessionTimeout = 60 * time.Second
+	defaultMaxSessions    = 4
+	// maxPendingSessions limits the sessions awaiting activation,
+	// the least recently used is dropped to make room for another
+	maxPendingSessions = 16
+)
+
+type simSession struct {
+	username  string
+	password  [16]uint8
+	authType  uint8
+	challenge [16]byte
+	// limit is the privilege limit of the user, maxPriv the session limit
+	// requested on activation and priv the current session privilege level
+	limit   uint8
+	maxPriv uint8
+	priv    uint8
+	// authRequired is false if the authStatus disables per-message
+	// authentication for this session
+	authRequired bool
+	// inbound sequence number window, nil until the session is activated
+	inbound *sequenceWindow
+	outSeq  uint32
+	// lastActive is the time of the last authenticated message
+	lastActive time.Time
+	// plus is the state of an RMCP+ session, nil for IPMI v1.5
+	plus *simPlusSession
+}
+
+// SetSessionTimeout sets the interval of inactivity after which a session
+// expires, the default is 60 seconds per section 6.12.15. Messages of an
+// expired session are discarded, as are those of any unknown session ID.
+func (s *Simulator) SetSessionTimeout(timeout time.Duration) {
+	s.mu.Lock()
+	s.sessionTimeout = timeout
+	s.mu.Unlock()
+}
+
+// SetMaxSessions sets the number of sessions that can be active at the
+// same time, the default is 4. Activate Session fails with ErrNoSessionSlot
+// once the limit is reached.
+func (s *Simulator) SetMaxSessions(n int) {
+	s.mu.Lock()
+	s.maxSessions = n
+	s.mu.Unlock()
+}
+
+// SetPrivilege sets the privilege level the given command requires,
+// overriding the levels of Appendix G
+func (s *Simulator) SetPrivilege(netfn NetworkFunction, command Command, priv uint8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.privileges[netfn]; !ok {
+		s.privileges[netfn] = map[Command]uint8{}
+	}
+	s.privileges[netfn][command] = priv
+}
+
+// simPrivileges are the privilege levels required by the built-in commands
+// per Appendix G, any other command requires PrivLevelUser.
+var simPrivileges = map[NetworkFunction]map[Command]uint8{
+	NetworkFunctionApp: {
+		CommandGetAuthCapabilities:      PrivLevelNone,
+		CommandGetSessionChallenge:      PrivLevelNone,
+		CommandActivateSession:          PrivLevelNone,
+		CommandSetSessionPrivilegeLevel: PrivLevelCallback,
+		CommandCloseSession:             PrivLevelCallback,
+		CommandGetUserName:              PrivLevelOperator,
+		CommandSetUserName:              PrivLevelAdmin,
+		CommandGetChannelCipherSuites:   PrivLevelNone,
+	},
+	NetworkFunctionChassis: {
+		CommandChassisControl:       PrivLevelOperator,
+		CommandGetSystemBootOptions: PrivLevelOperator,
+		CommandSetSystemBootOptions: PrivLevelOperator,
+	},
+	NetworkFunctionStorage: {
+		CommandAddSELEntry:  PrivLevelOperator,
+		CommandClearSEL:     PrivLevelOperator,
+		CommandWriteFRUData: PrivLevelOperator,
+	},
+	NetworkFunctionTransport: {
+		CommandGetLANConfig: PrivLevelOperator,
+	},
+}
+
+// commandPrivilege must be called with the mutex held
+func (s *Simulator) commandPrivilege(netfn NetworkFunction, command Command) uint8 {
+	if priv, ok := s.privileges[netfn][command]; ok {
+		return priv
+	}
+	if priv, ok := simPrivileges[netfn][command]; ok {
+		return priv
+	}
+	return PrivLevelUser
+}
+
+// newSessionID returns a random ID, unique among the current sessions.
+// ID 0 is reserved for messages outside of a session.
+func (s *Simulator) newSessionID() uint32 {
+	buf := [4]uint8{}
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			panic(err)
+		}
+		id := binary.LittleEndian.Uint32(buf[:])
+		if _, ok := s.sessions[id]; id != 0 && !ok {
+			return id
+		}
+	}
+}
+
+// expireSessions removes the activated and pending sessions that have
+// been idle for longer than the timeout
+func (s *Simulator) expireSessions(now time.Time, timeout time.Duration) {
+	for id, session := range s.sessions {
+		if now.Sub(session.lastActive) > timeout {
+			s.logger.Debug("session expired", "user", session.username, "id", id)
+			s.removeSession(id)
+		}
+	}
+}
+
+// addSession adds a session awaiting activation, returning its ID
+func (s *Simulator) addSession(session *simSession) uint32 {
+	var oldest uint32
+	pending := 0
+	for id, other := range s.sessions {
+		if other.inbound != nil {
+			continue
+		}
+		pending++
+		if oldest == 0 || other.lastActive.Before(s.sessions[oldest].lastActive) {
+			oldest = id
+		}
+	}
+	if pending >= maxPendingSessions {
+		s.logger.Debug("dropped pending session", "user", s.sessions[oldest].username, "id", oldest)
+		s.removeSession(oldest)
+	}
+
+	id := s.newSessionID()
+	s.sessions[id] = session
+	return id
+}
+
+// removeSession closes the given session, deactivating its payloads
+func (s *Simulator) removeSession(id uint32) {
+	delete(s.sessions, id)
+	s.sol.deactivate(id)
+}
+
+func (s *Simulator) activeSessions() int {
+	n := 0
+	for _, session := range s.sessions {
+		if session.inbound != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Simulator) sessionChallenge(m *Message) Response {
+	// The temporary SessionID is propagated such that all requests for
+	// this session include the ID, which is used to dispatch requests.
+	req := &SessionChallengeRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+	if req.AuthType > AuthTypePassword || authTypeSupport&(1<<req.AuthType) == 0 {
+		return ErrInvalidPacket
+	}
+
+	username := bytes.TrimRight(req.Username[:], "\000")
+	session := &simSession{
+		username:   string(username),
+		authType:   req.AuthType,
+		lastActive: time.Now(),
+	}
+
+	s.mu.Lock()
+	user := s.lookupUser(session.username)
+	if user != nil && user.Enabled {
+		copy(session.password[:], user.Password)
+		session.limit = user.privilege()
+	}
+	s.mu.Unlock()
+
+	if session.limit == PrivLevelNone {
+		if session.username == "" {
+			return ErrNullUserDisabled
+		}
+		return ErrInvalidUsername
+	}
+
+	if _, err := rand.Read(session.challenge[:]); err != nil {
+		panic(err)
+	}
+	id := s.addSession(session)
+
+	return &SessionChallengeResponse{
+		CompletionCode:     CommandCompleted,
+		TemporarySessionID: id,
+		Challenge:          session.challenge,
+	}
+}
+
+func (s *Simulator) sessionActivate(m *Message) Response {
+	req := &ActivateSessionRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	session, ok := s.sessions[m.SessionID]
+	if !ok {
+		return ErrInvalidSessionID
+	}
+	if session.inbound != nil {
+		return ErrInvalidState
+	}
+	if req.AuthType != session.authType || req.AuthCode != session.challenge {
+		return ErrInvalidPacket
+	}
+	if req.PrivLevel == PrivLevelNone || req.PrivLevel > PrivLevelOEM {
+		return ErrInvalidPacket
+	}
+	if req.PrivLevel > session.limit {
+		return ErrPrivLimitExceeded
+	}
+
+	outSeq := binary.LittleEndian.Uint32(req.InSeq[:])
+	if outSeq == 0 {
+		return ErrSessionSeqRange
+	}
+
+	s.mu.Lock()
+	maxSessions := s.maxSessions
+	s.mu.Unlock()
+	if s.activeSessions() >= maxSessions {
+		return ErrNoSessionSlot
+	}
+
+	// sessions start at User level, or below if that is the session limit
+	session.maxPriv = req.PrivLevel
+	session.priv = min(req.PrivLevel, PrivLevelUser)
+
+	// the remote console picks our outbound sequence numbers, we pick theirs
+	session.outSeq = outSeq
+	inSeq := [4]uint8{}
+	if _, err := rand.Read(inSeq[:]); err != nil {
+		panic(err)
+	}
+	inSeq[0] |= 1
+	inboundSeq := binary.LittleEndian.Uint32(inSeq[:])
+	session.inbound = newSequenceWindow(seqWindowV15, inboundSeq)
+
+	// per section 22.13, authentication can be disabled after activation
+	session.authRequired = s.authStatus&authStatusPerMessageDisabled == 0 &&
+		(s.authStatus&authStatusUserLevelDisabled == 0 || session.maxPriv > PrivLevelUser)
+
+	return &ActivateSessionResponse{
+		CompletionCode: CommandCompleted,
+		AuthType:       m.AuthType,
+		SessionID:      m.SessionID,
+		InboundSeq:     inboundSeq,
+		MaxPriv:        session.maxPriv,
+	}
+}
+
+func (s *Simulator) sessionPrivilege(m *Message) Response {
+	req := &SessionPrivilegeLevelRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	session, ok := s.sessions[m.SessionID]
+	if !ok || session.inbound == nil {
+		return ErrInvalidState
+	}
+
+	// level 0 requests the current privilege level without changing it
+	if req.PrivLevel != PrivLevelNone {
+		if req.PrivLevel > session.maxPriv {
+			return ErrSessionPrivLimit
+		}
+		session.priv = req.PrivLevel
+	}
+
+	return &SessionPrivilegeLevelResponse{
+		CompletionCode:    CommandCompleted,
+		NewPrivilegeLevel: session.priv,
+	}
+}
+
+func (s *Simulator) sessionClose(m *Message) Response {
+	req := &CloseSessionRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+	if _, ok := s.sessions[req.SessionID]; !ok {
+		return ErrCloseInvalidSessionID
+	}
+
+	// closing another session requires administrator privilege
+	if req.SessionID != m.SessionID {
+		if session := s.sessions[m.SessionID]; session == nil || session.priv < PrivLevelAdmin {
+			return ErrPrivLevel
+		}
+	}
+
+	s.removeSession(req.SessionID)
+	return CommandCompleted
+}
@@ -0,0 +1,176 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorSessionLimit(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	s.SetMaxSessions(1)
+	err := s.Run()
+	assert.NoError(t, err)
+
+	l1 := newLanTransport(s.NewConnection()).(*lan)
+	err = l1.open()
+	assert.NoError(t, err)
+
+	l2 := newLanTransport(s.NewConnection()).(*lan)
+	err = l2.open()
+	assert.Equal(t, ErrNoSessionSlot, err)
+	_ = l2.close()
+
+	// sessions of the same user are distinct
+	_ = l1.close()
+	err = l2.open()
+	assert.NoError(t, err)
+	assert.NotEqual(t, l1.SessionID, l2.SessionID)
+	_ = l2.close()
+
+	s.Stop()
+}
+
+func TestSimulatorPendingSessions(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	// a flood of challenges does not grow the sessions without bound
+	var most atomic.Int32
+	challenge := s.handlers[NetworkFunctionApp][CommandGetSessionChallenge]
+	s.SetHandler(NetworkFunctionApp, CommandGetSessionChallenge, func(m *Message) Response {
+		res := challenge(m)
+		if n := int32(len(s.sessions)); n > most.Load() {
+			most.Store(n)
+		}
+		return res
+	})
+
+	l := newLanTransport(s.NewConnection()).(*lan)
+	err = l.connect()
+	assert.NoError(t, err)
+	for i := 0; i < maxPendingSessions+4; i++ {
+		_, err = l.getSessionChallenge()
+		assert.NoError(t, err)
+	}
+	_ = l.close()
+	assert.Equal(t, int32(maxPendingSessions), most.Load())
+
+	// the Activate Session response is authenticated with the session auth type
+	tracer := &testTracer{}
+	c := s.NewConnection()
+	c.Tracer = tracer
+	l = newLanTransport(c).(*lan)
+	err = l.open()
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(AuthTypeMD5), l.AuthType)
+	activated := false
+	for _, e := range tracer.events {
+		if e.Inbound && e.Message != nil && e.Message.Command == CommandActivateSession {
+			activated = true
+			assert.NoError(t, e.Message.verify(e.Data, l.authcode))
+			assert.NotEqual(t, [16]uint8{}, e.Message.AuthCode)
+		}
+	}
+	assert.True(t, activated)
+	_ = l.close()
+
+	s.Stop()
+}
+
+func TestSimulatorSessionTimeout(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	s.SetSessionTimeout(50 * time.Millisecond)
+	err := s.Run()
+	assert.NoError(t, err)
+
+	var challenges atomic.Int32
+	challenge := s.handlers[NetworkFunctionApp][CommandGetSessionChallenge]
+	s.SetHandler(NetworkFunctionApp, CommandGetSessionChallenge, func(m *Message) Response {
+		challenges.Add(1)
+		return challenge(m)
+	})
+
+	c := s.NewConnection()
+	c.Timeout = 100 * time.Millisecond
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	_, err = client.DeviceID()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), challenges.Load())
+
+	// the expired session is discarded and the client opens a new one
+	time.Sleep(100 * time.Millisecond)
+	_, err = client.DeviceID()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), challenges.Load())
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestSimulatorSessionErrors(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	s.SetPrivilege(NetworkFunctionApp, CommandGetDeviceID, PrivLevelAdmin)
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	c.Privilege = PrivLevelUser
+	l := newLanTransport(c).(*lan)
+	err = l.open()
+	assert.NoError(t, err)
+
+	err = l.send(&Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}, &DeviceIDResponse{})
+	assert.Equal(t, ErrPrivLevel, err)
+
+	err = l.send(&Request{NetworkFunctionApp, CommandCloseSession, &CloseSessionRequest{l.SessionID + 1}}, &CloseSessionResponse{})
+	assert.Equal(t, ErrCloseInvalidSessionID, err)
+
+	// closing another session requires administrator privilege
+	admin := newLanTransport(s.NewConnection()).(*lan)
+	err = admin.open()
+	assert.NoError(t, err)
+	err = l.send(&Request{NetworkFunctionApp, CommandCloseSession, &CloseSessionRequest{admin.SessionID}}, &CloseSessionResponse{})
+	assert.Equal(t, ErrPrivLevel, err)
+	err = admin.send(&Request{NetworkFunctionApp, CommandCloseSession, &CloseSessionRequest{l.SessionID}}, &CloseSessionResponse{})
+	assert.NoError(t, err)
+	_ = admin.close()
+	l.active = false // closed by admin
+	_ = l.close()
+
+	// activation of an unknown temporary session
+	l = newLanTransport(s.NewConnection()).(*lan)
+	err = l.connect()
+	assert.NoError(t, err)
+	l.SessionID = 0x01020304
+	err = l.activateSession(&SessionChallengeResponse{})
+	assert.Equal(t, ErrInvalidSessionID, err)
+	_ = l.close()
+
+	s.Stop()
+}
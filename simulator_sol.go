@@ -0,0 +1,272 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// simSOLPayloadSize is the largest SOL payload the Simulator sends or accepts
+const simSOLPayloadSize = 128
+
+// simSOLBuffer is the number of inbound SOL packets buffered for the
+// host console, packets beyond are NACKed until it catches up
+const simSOLBuffer = 16
+
+// simSOL is the Serial Over LAN payload of a Simulator. The host serial
+// console is one end of an in-process pipe, the other end is the remote
+// console of the RMCP+ session with the payload active. The pipe lives
+// as long as the Simulator, across Stop and Run.
+type simSOL struct {
+	// mu guards the active session and packet sequence numbers
+	mu sync.Mutex
+	// session is the ID of the session with the payload active, 0 if none
+	session uint32
+	plus    *simPlusSession
+	addr    net.Addr
+	conn    net.PacketConn
+	logger  Logger
+	outSeq  uint8
+	lastIn  uint8
+
+	host  net.Conn
+	bmc   net.Conn
+	input chan []byte
+	// done is closed to stop relaying, nil while stopped
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newSimSOL() *simSOL {
+	sol := &simSOL{input: make(chan []byte, simSOLBuffer)}
+	sol.host, sol.bmc = net.Pipe()
+	return sol
+}
+
+// HostConsole returns the host end of the simulated serial console.
+// Data written to it is sent to the remote console of the active SOL
+// payload, or discarded if there is none, and characters sent by the
+// remote console are read from it. The same Conn is returned for the
+// lifetime of the Simulator, while it is stopped writes block until it
+// is run again.
+func (s *Simulator) HostConsole() net.Conn {
+	return s.sol.host
+}
+
+// start relaying between the pipe and the session, sending on conn
+func (sol *simSOL) start(conn net.PacketConn, logger Logger) {
+	sol.mu.Lock()
+	sol.conn = conn
+	sol.logger = logger
+	sol.mu.Unlock()
+
+	sol.done = make(chan struct{})
+	_ = sol.bmc.SetDeadline(time.Time{})
+
+	sol.wg.Add(2)
+	go sol.output()
+	go sol.relayInput(sol.done)
+}
+
+// stop relaying and deactivate the payload, leaving the pipe open for
+// a restart. It must be called once no more packets are received, and
+// does nothing if already stopped.
+func (sol *simSOL) stop() {
+	if sol.done == nil {
+		return
+	}
+
+	sol.mu.Lock()
+	sol.conn = nil
+	sol.session = 0
+	sol.plus = nil
+	sol.addr = nil
+	sol.mu.Unlock()
+
+	close(sol.done)
+	sol.done = nil
+	// unblock a pending read or write of the bmc end
+	_ = sol.bmc.SetDeadline(time.Now())
+	sol.wg.Wait()
+}
+
+// output sends the data written to the host console
+func (sol *simSOL) output() {
+	defer sol.wg.Done()
+
+	buf := make([]byte, simSOLPayloadSize-solHeaderSize)
+	for {
+		n, err := sol.bmc.Read(buf)
+		if err != nil {
+			return // stopped
+		}
+		sol.send(&solPacket{Data: buf[:n]})
+	}
+}
+
+// relayInput writes the data received from the remote console to the host console
+func (sol *simSOL) relayInput(done chan struct{}) {
+	defer sol.wg.Done()
+
+	for {
+		select {
+		case data := <-sol.input:
+			if _, err := sol.bmc.Write(data); err != nil {
+				return // stopped
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// send a data packet to the remote console, without retransmission as
+// the loopback network is reliable. Without a session the data is lost,
+// as it would be on a serial port.
+func (sol *simSOL) send(p *solPacket) {
+	sol.mu.Lock()
+	defer sol.mu.Unlock()
+
+	if sol.session == 0 {
+		return
+	}
+	sol.outSeq = sol.outSeq%15 + 1
+	p.Sequence = sol.outSeq
+
+	buf, err := Marshal(p)
+	if err != nil {
+		sol.logger.Warn("invalid SOL packet", "err", err)
+		return
+	}
+	_, _ = sol.conn.WriteTo(sol.plus.message(PayloadTypeSOL, buf), sol.addr)
+}
+
+// activate the payload for the given session
+func (sol *simSOL) activate(id uint32, plus *simPlusSession) bool {
+	sol.mu.Lock()
+	defer sol.mu.Unlock()
+
+	if sol.session != 0 || sol.conn == nil {
+		return false
+	}
+	sol.session = id
+	sol.plus = plus
+	sol.addr = plus.addr
+	sol.outSeq = 0
+	sol.lastIn = 0
+
+	return true
+}
+
+// deactivate the payload if it is active for the given session
+func (sol *simSOL) deactivate(id uint32) bool {
+	sol.mu.Lock()
+	defer sol.mu.Unlock()
+
+	if id == 0 || sol.session != id {
+		return false
+	}
+	sol.session = 0
+	sol.plus = nil
+	sol.addr = nil
+
+	return true
+}
+
+// receive a packet of the given session, returning the acknowledgement
+// to send, if any
+func (sol *simSOL) receive(id uint32, buf []byte) []byte {
+	p := &solPacket{}
+	if err := Unmarshal(buf, p); err != nil {
+		return nil
+	}
+
+	sol.mu.Lock()
+	defer sol.mu.Unlock()
+
+	// packets without a sequence number acknowledge our output
+	if sol.session != id || p.Sequence == 0 {
+		return nil
+	}
+
+	ack := &solPacket{AckSequence: p.Sequence}
+	switch {
+	case p.Sequence == sol.lastIn:
+		// a retransmission of the last packet, already accepted
+		ack.Accepted = uint8(len(p.Data))
+	case len(p.Data) == 0:
+		sol.lastIn = p.Sequence
+	default:
+		select {
+		case sol.input <- append([]byte(nil), p.Data...):
+			ack.Accepted = uint8(len(p.Data))
+			sol.lastIn = p.Sequence
+		default:
+			ack.Status = solNack
+		}
+	}
+
+	buf, err := Marshal(ack)
+	if err != nil {
+		sol.logger.Warn("invalid SOL acknowledgement", "err", err)
+		return nil
+	}
+	return buf
+}
+
+func (s *Simulator) activatePayload(m *Message) Response {
+	req := &ActivatePayloadRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	// payloads other than IPMI require an RMCP+ session
+	session := s.sessions[m.SessionID]
+	if session == nil || session.plus == nil {
+		return ErrInvalidState
+	}
+	if req.PayloadType != PayloadTypeSOL || req.PayloadInstance != 1 {
+		return ErrInvalidPacket
+	}
+	if !s.sol.activate(m.SessionID, session.plus) {
+		return ErrPayloadActive
+	}
+
+	return &ActivatePayloadResponse{
+		CompletionCode:      CommandCompleted,
+		InboundPayloadSize:  simSOLPayloadSize,
+		OutboundPayloadSize: simSOLPayloadSize,
+		PayloadPort:         uint16(s.LocalAddr().Port),
+		PayloadVLAN:         0xffff,
+	}
+}
+
+func (s *Simulator) deactivatePayload(m *Message) Response {
+	req := &DeactivatePayloadRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+	if req.PayloadType != PayloadTypeSOL || req.PayloadInstance != 1 {
+		return ErrInvalidPacket
+	}
+	if !s.sol.deactivate(m.SessionID) {
+		return ErrPayloadInactive
+	}
+	return &DeactivatePayloadResponse{CompletionCode: CommandCompleted}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sol sends a SOL packet, returning the packet received in response
+func (c *plusConsole) sol(p *solPacket) (*solPacket, error) {
+	buf, err := Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write(c.message(PayloadTypeSOL, buf)); err != nil {
+		return nil, err
+	}
+	return c.readSOL()
+}
+
+func (c *plusConsole) readSOL() (*solPacket, error) {
+	m, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if m.PayloadType&payloadTypeMask != PayloadTypeSOL {
+		return nil, ErrInvalidPacket
+	}
+	p := &solPacket{}
+	return p, Unmarshal(m.Payload, p)
+}
+
+func TestSimulatorSOL(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	err := s.Run()
+	assert.NoError(t, err)
+	s.SetPassword("admin", "secret")
+	host := s.HostConsole()
+
+	// payloads other than IPMI require an RMCP+ session
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+	assert.NoError(t, client.Open())
+	activate := &ActivatePayloadRequest{PayloadType: PayloadTypeSOL, PayloadInstance: 1}
+	err = client.Send(&Request{NetworkFunctionApp, CommandActivatePayload, activate}, &ActivatePayloadResponse{})
+	assert.Equal(t, ErrInvalidState, err)
+	assert.NoError(t, client.Close())
+
+	c := newPlusConsole(t, s)
+	defer c.close()
+	_, err = c.open(cipherSuites[3], "admin", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+
+	err = c.send(NetworkFunctionApp, CommandActivatePayload, &ActivatePayloadRequest{PayloadType: PayloadTypeIPMI, PayloadInstance: 1}, &ActivatePayloadResponse{})
+	assert.Equal(t, ErrInvalidPacket, err)
+
+	res := &ActivatePayloadResponse{}
+	err = c.send(NetworkFunctionApp, CommandActivatePayload, activate, res)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(simSOLPayloadSize), res.InboundPayloadSize)
+	assert.Equal(t, uint16(simSOLPayloadSize), res.OutboundPayloadSize)
+	assert.Equal(t, uint16(s.LocalAddr().Port), res.PayloadPort)
+	err = c.send(NetworkFunctionApp, CommandActivatePayload, activate, res)
+	assert.Equal(t, ErrPayloadActive, err)
+
+	// host output is sent to the remote console
+	_, err = host.Write([]byte("login: "))
+	assert.NoError(t, err)
+	p, err := c.readSOL()
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(1), p.Sequence)
+	assert.Equal(t, []byte("login: "), p.Data)
+
+	// remote console input is acknowledged and read from the host console
+	ack, err := c.sol(&solPacket{Sequence: 1, AckSequence: p.Sequence, Accepted: uint8(len(p.Data)), Data: []byte("root\r")})
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0), ack.Sequence)
+	assert.Equal(t, uint8(1), ack.AckSequence)
+	assert.Equal(t, uint8(5), ack.Accepted)
+	buf := make([]byte, 16)
+	assert.NoError(t, host.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := host.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "root\r", string(buf[:n]))
+
+	// retransmissions are acknowledged again, but not delivered twice
+	ack, err = c.sol(&solPacket{Sequence: 1, Data: []byte("root\r")})
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(5), ack.Accepted)
+	assert.NoError(t, host.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = host.Read(buf)
+	assert.True(t, isTimeoutError(err))
+
+	// input beyond what the host console buffers is NACKed
+	seq := uint8(1)
+	for i := 0; i <= simSOLBuffer+1; i++ {
+		seq = seq%15 + 1
+		ack, err = c.sol(&solPacket{Sequence: seq, Data: []byte("x")})
+		assert.NoError(t, err)
+		if ack.Status&solNack != 0 {
+			break
+		}
+	}
+	assert.Equal(t, uint8(solNack), ack.Status)
+	assert.Equal(t, uint8(0), ack.Accepted)
+
+	err = c.send(NetworkFunctionApp, CommandDeactivatePayload, &DeactivatePayloadRequest{PayloadType: PayloadTypeSOL, PayloadInstance: 1}, &DeactivatePayloadResponse{})
+	assert.NoError(t, err)
+	err = c.send(NetworkFunctionApp, CommandDeactivatePayload, &DeactivatePayloadRequest{PayloadType: PayloadTypeSOL, PayloadInstance: 1}, &DeactivatePayloadResponse{})
+	assert.Equal(t, ErrPayloadInactive, err)
+
+	// without an active payload host output is lost
+	_, err = host.Write([]byte("lost"))
+	assert.NoError(t, err)
+	_, err = c.readSOL()
+	assert.True(t, isTimeoutError(err))
+
+	// closing the session deactivates the payload
+	err = c.send(NetworkFunctionApp, CommandActivatePayload, activate, res)
+	assert.NoError(t, err)
+	err = c.send(NetworkFunctionApp, CommandCloseSession, &CloseSessionRequest{SessionID: c.rakp.bmcID}, &CloseSessionResponse{})
+	assert.NoError(t, err)
+	other := newPlusConsole(t, s)
+	defer other.close()
+	_, err = other.open(cipherSuites[3], "admin", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+	err = other.send(NetworkFunctionApp, CommandActivatePayload, activate, res)
+	assert.NoError(t, err)
+
+	s.Stop()
+
+	// a stopped Simulator can be run again, with the same host console
+	assert.NoError(t, s.Run())
+	assert.Equal(t, host, s.HostConsole())
+	restarted := newPlusConsole(t, s)
+	defer restarted.close()
+	_, err = restarted.open(cipherSuites[3], "admin", "secret", PrivLevelAdmin)
+	assert.NoError(t, err)
+	err = restarted.send(NetworkFunctionApp, CommandActivatePayload, activate, res)
+	assert.NoError(t, err)
+	_, err = host.Write([]byte("login: "))
+	assert.NoError(t, err)
+	p, err = restarted.readSOL()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("login: "), p.Data)
+	s.Stop()
+
+	// stopping again, as a deferred Stop would, does nothing
+	assert.NotPanics(t, s.Stop)
+}
@@ -0,0 +1,596 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"math"
+	"time"
+)
+
+// simSELCapacity is the number of entries the simulated SEL can hold
+const simSELCapacity = 512
+
+// simSensor is the reading of a sensor in the SDR repository
+type simSensor struct {
+	sdr *SDR
+	// valid is false until a reading is set
+	valid bool
+	raw   uint8
+	state uint8
+	// wave computes the reading from the time elapsed since start
+	wave  SensorWaveform
+	start time.Time
+}
+
+// SensorWaveform returns the value of a simulated sensor in Units,
+// given the time elapsed since it was set with SetSensorWaveform.
+// It is called with the Simulator locked and must not call back into it.
+type SensorWaveform func(elapsed time.Duration) float64
+
+// SineWave oscillates around mean with the given amplitude and period
+func SineWave(mean, amplitude float64, period time.Duration) SensorWaveform {
+	return func(elapsed time.Duration) float64 {
+		return mean + amplitude*math.Sin(2*math.Pi*float64(elapsed)/float64(period))
+	}
+}
+
+// Ramp moves linearly from one value to another over d, then holds
+func Ramp(from, to float64, d time.Duration) SensorWaveform {
+	return func(elapsed time.Duration) float64 {
+		if elapsed >= d {
+			return to
+		}
+		return from + (to-from)*float64(elapsed)/float64(d)
+	}
+}
+
+// Steps reads each of values in turn for the given interval, repeating
+func Steps(interval time.Duration, values ...float64) SensorWaveform {
+	return func(elapsed time.Duration) float64 {
+		if len(values) == 0 {
+			return 0
+		}
+		return values[int(elapsed/interval)%len(values)]
+	}
+}
+
+// simReservation is the reservation of a repository per section 33.11,
+// which is cancelled by any change to its contents
+type simReservation struct {
+	id        uint16
+	cancelled bool
+}
+
+func (r *simReservation) reserve() uint16 {
+	r.id++
+	if r.id == 0 {
+		r.id++ // 0 is reserved
+	}
+	r.cancelled = false
+	return r.id
+}
+
+func (r *simReservation) cancel() {
+	r.cancelled = true
+}
+
+// valid returns true if id is the current reservation
+func (r *simReservation) valid(id uint16) bool {
+	return id != 0 && id == r.id && !r.cancelled
+}
+
+// SetDeviceID sets the response to Get Device ID
+func (s *Simulator) SetDeviceID(id DeviceIDResponse) {
+	id.CompletionCode = CommandCompleted
+	s.mu.Lock()
+	s.device = id
+	s.mu.Unlock()
+}
+
+// AddSDR appends a sensor record to the SDR repository, assigning the
+// next free RecordID if none is set. The sensor has no reading until
+// one is set with SetSensorReading.
+func (s *Simulator) AddSDR(sdr *SDR) error {
+	if _, err := sdr.MarshalBinary(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := *sdr
+	if record.RecordID == 0 {
+		for _, r := range s.sdrs {
+			record.RecordID = max(record.RecordID, r.RecordID)
+		}
+		record.RecordID++
+	}
+	s.sdrs = append(s.sdrs, &record)
+	s.sensors[record.SensorNumber] = &simSensor{sdr: &record}
+	s.sdrResv.cancel()
+
+	return nil
+}
+
+// SetSensorReading sets the value in Units and the threshold state bits
+// of the given sensor. ErrNoObj is returned if there is no such sensor.
+func (s *Simulator) SetSensorReading(number uint8, value float64, state uint8) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sensor, ok := s.sensors[number]
+	if !ok {
+		return ErrNoObj
+	}
+	sensor.valid = true
+	sensor.raw = sensor.sdr.raw(value)
+	sensor.state = state
+	sensor.wave = nil
+
+	return nil
+}
+
+// SetSensorWaveform sets the given sensor to read the value of wave,
+// with the threshold state bits cleared, until its reading is next set.
+// ErrNoObj is returned if there is no such sensor.
+func (s *Simulator) SetSensorWaveform(number uint8, wave SensorWaveform) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sensor, ok := s.sensors[number]
+	if !ok {
+		return ErrNoObj
+	}
+	sensor.valid = true
+	sensor.state = 0
+	sensor.wave = wave
+	sensor.start = time.Now()
+
+	return nil
+}
+
+// AddSELEntry appends an entry to the SEL, assigning the next RecordID.
+// The Timestamp defaults to the current time.
+func (s *Simulator) AddSELEntry(entry *SELEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := *entry
+	if e.RecordType == 0 {
+		e.RecordType = 0x02 // system event
+	}
+	if e.Timestamp.IsZero() && e.RecordType < 0xe0 {
+		e.Timestamp = time.Now().UTC().Truncate(time.Second)
+	}
+	_, err := s.appendSEL(&e)
+	return err
+}
+
+// appendSEL must be called with the mutex held
+func (s *Simulator) appendSEL(e *SELEntry) (uint16, error) {
+	if len(s.sel) >= simSELCapacity {
+		return 0, ErrOutOfSpace
+	}
+
+	s.selNextID++
+	if s.selNextID == 0 || s.selNextID == 0xffff {
+		s.selNextID = 1 // 0 and ffffh are the first and last entry
+	}
+	e.RecordID = s.selNextID
+	s.sel = append(s.sel, e)
+	s.selAddTime = time.Now()
+
+	return e.RecordID, nil
+}
+
+// SELEntries returns a copy of the entries in the SEL
+func (s *Simulator) SELEntries() []*SELEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]*SELEntry, len(s.sel))
+	for i, e := range s.sel {
+		entry := *e
+		entries[i] = &entry
+	}
+	return entries
+}
+
+// ClearSEL erases all entries in the SEL, cancelling its reservation
+func (s *Simulator) ClearSEL() {
+	s.mu.Lock()
+	s.eraseSEL()
+	s.mu.Unlock()
+}
+
+// eraseSEL must be called with the mutex held
+func (s *Simulator) eraseSEL() {
+	s.sel = nil
+	s.selEraseTime = time.Now()
+	s.selResv.cancel()
+}
+
+// SetFRU sets the inventory data of the given FRU device
+func (s *Simulator) SetFRU(id uint8, info *FRUInfo) error {
+	data, err := info.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	s.SetFRUData(id, data)
+	return nil
+}
+
+// SetFRUData sets the raw inventory area of the given FRU device
+func (s *Simulator) SetFRUData(id uint8, data []byte) {
+	s.mu.Lock()
+	s.frus[id] = append([]byte(nil), data...)
+	s.mu.Unlock()
+}
+
+// FRUData returns a copy of the inventory area of the given FRU device,
+// including any changes written with Write FRU Data
+func (s *Simulator) FRUData(id uint8) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.frus[id]
+	return append([]byte(nil), data...), ok
+}
+
+// SetLANConfig sets the data of the given LAN Configuration Parameter
+func (s *Simulator) SetLANConfig(param uint8, data []byte) {
+	s.mu.Lock()
+	s.lanConfig[param] = data
+	s.mu.Unlock()
+}
+
+func (s *Simulator) deviceID(*Message) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.device
+	return &id
+}
+
+func (s *Simulator) sdrRepositoryInfo(*Message) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &SDRRepositoryInfoResponse{
+		CompletionCode:   CommandCompleted,
+		Version:          0x51,
+		Records:          uint16(len(s.sdrs)),
+		FreeSpace:        0xffff, // unspecified
+		OperationSupport: 0x02,   // Reserve SDR Repository supported
+	}
+}
+
+func (s *Simulator) reserveSDRRepository(*Message) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &ReserveSDRRepositoryResponse{
+		CompletionCode: CommandCompleted,
+		ReservationID:  s.sdrResv.reserve(),
+	}
+}
+
+func (s *Simulator) getSDR(m *Message) Response {
+	req := &GetSDRRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a reservation is required to read part of a record
+	if (req.Offset != 0 || req.ReservationID != 0) && !s.sdrResv.valid(req.ReservationID) {
+		return ErrInvalidResv
+	}
+
+	i := 0
+	if req.RecordID != 0 {
+		for i < len(s.sdrs) && s.sdrs[i].RecordID != req.RecordID {
+			i++
+		}
+	}
+	if i >= len(s.sdrs) {
+		return ErrNoObj
+	}
+
+	buf, err := s.sdrs[i].MarshalBinary()
+	if err != nil {
+		return ErrUnspecified
+	}
+	if int(req.Offset) > len(buf) {
+		return ErrParamRange
+	}
+	end := min(int(req.Offset)+int(req.Length), len(buf))
+
+	next := uint16(0xffff)
+	if i+1 < len(s.sdrs) {
+		next = s.sdrs[i+1].RecordID
+	}
+
+	return &GetSDRResponse{
+		CompletionCode: CommandCompleted,
+		NextRecordID:   next,
+		Data:           buf[req.Offset:end],
+	}
+}
+
+func (s *Simulator) sensorReading(m *Message) Response {
+	req := &SensorReadingRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sensor, ok := s.sensors[req.SensorNumber]
+	if !ok {
+		return ErrNoObj
+	}
+
+	res := &SensorReadingResponse{
+		CompletionCode: CommandCompleted,
+		Flags:          0x40, // sensor scanning enabled
+	}
+	if !sensor.valid {
+		res.Flags |= 0x20 // reading unavailable
+		return res
+	}
+	res.Reading = sensor.raw
+	if sensor.wave != nil {
+		res.Reading = sensor.sdr.raw(sensor.wave(time.Since(sensor.start)))
+	}
+	res.State[0] = sensor.state
+
+	return res
+}
+
+func (s *Simulator) selInfo(*Message) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := &SELInfoResponse{
+		CompletionCode:   CommandCompleted,
+		Version:          0x51,
+		Entries:          uint16(len(s.sel)),
+		FreeSpace:        uint16((simSELCapacity - len(s.sel)) * selRecordSize),
+		OperationSupport: 0x02, // Reserve SEL supported
+	}
+	if !s.selAddTime.IsZero() {
+		res.LastAddTimestamp = uint32(s.selAddTime.Unix())
+	}
+	if !s.selEraseTime.IsZero() {
+		res.LastEraseTimestamp = uint32(s.selEraseTime.Unix())
+	}
+
+	return res
+}
+
+func (s *Simulator) reserveSEL(*Message) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &ReserveSELResponse{
+		CompletionCode: CommandCompleted,
+		ReservationID:  s.selResv.reserve(),
+	}
+}
+
+func (s *Simulator) getSELEntry(m *Message) Response {
+	req := &GetSELEntryRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a reservation is required to read part of a record
+	if (req.Offset != 0 || req.ReservationID != 0) && !s.selResv.valid(req.ReservationID) {
+		return ErrInvalidResv
+	}
+
+	// record IDs 0 and ffffh are the first and last entry
+	i := 0
+	switch req.RecordID {
+	case 0:
+	case 0xffff:
+		i = len(s.sel) - 1
+	default:
+		for i < len(s.sel) && s.sel[i].RecordID != req.RecordID {
+			i++
+		}
+	}
+	if i < 0 || i >= len(s.sel) {
+		return ErrNoObj
+	}
+
+	buf, err := s.sel[i].MarshalBinary()
+	if err != nil {
+		return ErrUnspecified
+	}
+	if int(req.Offset) > len(buf) {
+		return ErrParamRange
+	}
+	end := min(int(req.Offset)+int(req.Length), len(buf))
+
+	next := uint16(0xffff)
+	if i+1 < len(s.sel) {
+		next = s.sel[i+1].RecordID
+	}
+
+	return &GetSELEntryResponse{
+		CompletionCode: CommandCompleted,
+		NextRecordID:   next,
+		Data:           buf[req.Offset:end],
+	}
+}
+
+func (s *Simulator) addSELEntry(m *Message) Response {
+	req := &AddSELEntryRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	e := &SELEntry{}
+	if err := e.UnmarshalBinary(req.Record[:]); err != nil {
+		return ErrInvalidPacket
+	}
+	// the BMC timestamps all but OEM non-timestamped records
+	if e.RecordType < 0xe0 {
+		e.Timestamp = time.Now().UTC().Truncate(time.Second)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.appendSEL(e)
+	if err != nil {
+		return err.(CompletionCode)
+	}
+
+	return &AddSELEntryResponse{
+		CompletionCode: CommandCompleted,
+		RecordID:       id,
+	}
+}
+
+func (s *Simulator) clearSEL(m *Message) Response {
+	req := &ClearSELRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+	if req.Signature != clearSELSignature {
+		return ErrInvalidPacket
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.selResv.valid(req.ReservationID) {
+		return ErrInvalidResv
+	}
+
+	switch req.Action {
+	case ClearSELInitiate:
+		s.eraseSEL()
+	case ClearSELGetStatus:
+	default:
+		return ErrInvalidPacket
+	}
+
+	// erasure is immediate
+	return &ClearSELResponse{
+		CompletionCode: CommandCompleted,
+		Progress:       ClearSELCompleted,
+	}
+}
+
+func (s *Simulator) fruInventoryAreaInfo(m *Message) Response {
+	req := &FRUInventoryAreaInfoRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.frus[req.DeviceID]
+	if !ok {
+		return ErrNoObj
+	}
+
+	return &FRUInventoryAreaInfoResponse{
+		CompletionCode: CommandCompleted,
+		AreaSize:       uint16(len(data)),
+	}
+}
+
+func (s *Simulator) readFRUData(m *Message) Response {
+	req := &ReadFRUDataRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.frus[req.DeviceID]
+	if !ok {
+		return ErrNoObj
+	}
+	if int(req.Offset) > len(data) {
+		return ErrParamRange
+	}
+	end := min(int(req.Offset)+int(req.Count), len(data))
+
+	return &ReadFRUDataResponse{
+		CompletionCode: CommandCompleted,
+		Count:          uint8(end - int(req.Offset)),
+		Data:           data[req.Offset:end],
+	}
+}
+
+func (s *Simulator) writeFRUData(m *Message) Response {
+	req := &WriteFRUDataRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.frus[req.DeviceID]
+	if !ok {
+		return ErrNoObj
+	}
+	if int(req.Offset)+len(req.Data) > len(data) {
+		return ErrParamRange
+	}
+	copy(data[req.Offset:], req.Data)
+
+	return &WriteFRUDataResponse{
+		CompletionCode: CommandCompleted,
+		Count:          uint8(len(req.Data)),
+	}
+}
+
+func (s *Simulator) lanConfigParam(m *Message) Response {
+	req := &LANConfigRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.lanConfig[req.Param]
+	if !ok {
+		return ErrParamNotSupported
+	}
+
+	res := &LANConfigResponse{
+		CompletionCode: CommandCompleted,
+		Revision:       0x11,
+	}
+	if req.ChannelNumber&lanConfigRevisionOnly == 0 {
+		res.Data = data
+	}
+
+	return res
+}
@@ -0,0 +1,323 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorStorage(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	// empty repositories
+	sensors, err := client.Sensors()
+	assert.Equal(t, ErrNoObj, err)
+	assert.Empty(t, sensors)
+	entries, err := client.SELEntries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	_, err = client.FRU(0)
+	assert.Equal(t, ErrNoObj, err)
+
+	s.SetDeviceID(DeviceIDResponse{ManufacturerID: OemDell, ProductID: 0x100})
+	id, err := client.DeviceID()
+	assert.NoError(t, err)
+	assert.Equal(t, OemDell, id.ManufacturerID)
+	assert.Equal(t, uint16(0x100), id.ProductID)
+
+	// a sensor record is longer than a single Get SDR read
+	sdr := &SDR{RecordType: SDRTypeFullSensor, SensorNumber: 0x30, SensorType: 0x01, EventType: EventTypeThreshold, BaseUnit: 1, M: 2, RExp: -1, Name: "CPU Temp"}
+	assert.NoError(t, s.AddSDR(sdr))
+	assert.NoError(t, s.AddSDR(&SDR{RecordType: SDRTypeCompactSensor, SensorNumber: 0x31, SensorType: 0x04, EventType: EventTypeThreshold, Name: "Fan"}))
+	assert.Error(t, s.AddSDR(&SDR{RecordType: 0x12}))
+	assert.NoError(t, s.SetSensorReading(0x30, 9, ThresholdUpperNonCritical))
+	assert.Equal(t, ErrNoObj, s.SetSensorReading(0x40, 0, 0))
+
+	records, err := client.SDRs()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, uint16(1), records[0].RecordID)
+	assert.Equal(t, uint16(2), records[1].RecordID)
+	assert.Equal(t, "CPU Temp", records[0].Name)
+
+	sensors, err = client.Sensors()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(sensors))
+	assert.InDelta(t, 9.0, sensors[0].Value, 0.001)
+	assert.Equal(t, "nc", sensors[0].Status)
+	assert.False(t, sensors[1].Available())
+
+	stamp := time.Unix(1589443200, 0).UTC()
+	assert.NoError(t, s.AddSELEntry(&SELEntry{Timestamp: stamp, SensorType: 0x08, SensorNumber: 0x62, EventType: EventTypeSensorSpecific}))
+	assert.NoError(t, s.AddSELEntry(&SELEntry{SensorType: 0x08, SensorNumber: 0x62, EventType: EventTypeSensorSpecific, Deassertion: true}))
+
+	entries, err = client.SELEntries()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, uint16(1), entries[0].RecordID)
+	assert.Equal(t, stamp, entries[0].Timestamp)
+	assert.Equal(t, uint8(0x02), entries[0].RecordType)
+	assert.True(t, entries[1].Deassertion)
+	assert.WithinDuration(t, time.Now(), entries[1].Timestamp, time.Minute)
+
+	// the last entry
+	res := &GetSELEntryResponse{}
+	err = client.Send(&Request{NetworkFunctionStorage, CommandGetSELEntry, &GetSELEntryRequest{RecordID: 0xffff, Length: 0xff}}, res)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0xffff), res.NextRecordID)
+	err = client.Send(&Request{NetworkFunctionStorage, CommandGetSELEntry, &GetSELEntryRequest{RecordID: 3, Length: 0xff}}, res)
+	assert.Equal(t, ErrNoObj, err)
+
+	fru := &FRUInfo{ChassisType: 0x17, BoardManufacturer: "VMware", ProductName: "goipmi"}
+	assert.NoError(t, s.SetFRU(0, fru))
+	info, err := client.FRU(0)
+	assert.NoError(t, err)
+	assert.Equal(t, fru, info)
+
+	s.SetLANConfig(LANParamIPAddress, []byte{10, 0, 0, 1})
+	lanConfig := &LANConfigResponse{}
+	err = client.Send(&Request{NetworkFunctionTransport, CommandGetLANConfig, &LANConfigRequest{ChannelNumber: lanChannelE, Param: LANParamIPAddress}}, lanConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{10, 0, 0, 1}, lanConfig.Data)
+	err = client.Send(&Request{NetworkFunctionTransport, CommandGetLANConfig, &LANConfigRequest{ChannelNumber: lanChannelE | lanConfigRevisionOnly, Param: LANParamIPAddress}}, lanConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0x11), lanConfig.Revision)
+	assert.Empty(t, lanConfig.Data)
+	err = client.Send(&Request{NetworkFunctionTransport, CommandGetLANConfig, &LANConfigRequest{ChannelNumber: lanChannelE, Param: LANParamMACAddress}}, lanConfig)
+	assert.Equal(t, ErrParamNotSupported, err)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestSimulatorReservations(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.AddSDR(&SDR{RecordType: SDRTypeFullSensor, SensorNumber: 0x30, EventType: EventTypeThreshold, M: 1, Name: "Inlet Temp"}))
+
+	getSDR := func(req *GetSDRRequest) error {
+		return client.Send(&Request{NetworkFunctionStorage, CommandGetSDR, req}, &GetSDRResponse{})
+	}
+	reserve := func() uint16 {
+		res := &ReserveSDRRepositoryResponse{}
+		assert.NoError(t, client.Send(&Request{NetworkFunctionStorage, CommandReserveSDRRepository, &ReserveSDRRepositoryRequest{}}, res))
+		return res.ReservationID
+	}
+
+	// a partial read requires the current reservation
+	assert.NoError(t, getSDR(&GetSDRRequest{Length: sdrHeaderSize}))
+	assert.Equal(t, ErrInvalidResv, getSDR(&GetSDRRequest{Offset: sdrHeaderSize, Length: 8}))
+	resv := reserve()
+	assert.NoError(t, getSDR(&GetSDRRequest{ReservationID: resv, Offset: sdrHeaderSize, Length: 8}))
+	assert.Equal(t, ErrInvalidResv, getSDR(&GetSDRRequest{ReservationID: resv - 1, Offset: sdrHeaderSize, Length: 8}))
+
+	// adding a record cancels the reservation
+	assert.NoError(t, s.AddSDR(&SDR{RecordType: SDRTypeCompactSensor, SensorNumber: 0x31, EventType: EventTypeThreshold, Name: "Exhaust Temp"}))
+	assert.Equal(t, ErrInvalidResv, getSDR(&GetSDRRequest{ReservationID: resv, Offset: sdrHeaderSize, Length: 8}))
+	assert.NotEqual(t, resv, reserve())
+
+	records, err := client.SDRs()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(records))
+
+	// clearing the SEL cancels its reservation
+	assert.NoError(t, s.AddSELEntry(&SELEntry{SensorNumber: 0x30}))
+	selResv := &ReserveSELResponse{}
+	assert.NoError(t, client.Send(&Request{NetworkFunctionStorage, CommandReserveSEL, &ReserveSELRequest{}}, selResv))
+	getSEL := &GetSELEntryRequest{ReservationID: selResv.ReservationID, Offset: 4, Length: 4}
+	assert.NoError(t, client.Send(&Request{NetworkFunctionStorage, CommandGetSELEntry, getSEL}, &GetSELEntryResponse{}))
+	s.ClearSEL()
+	assert.Equal(t, ErrInvalidResv, client.Send(&Request{NetworkFunctionStorage, CommandGetSELEntry, getSEL}, &GetSELEntryResponse{}))
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestSimulatorSEL(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	// the BMC assigns the record ID and timestamp of added entries
+	entry := &SELEntry{RecordID: 0x55, RecordType: 0x02, SensorType: 0x01, SensorNumber: 0x30, EventType: EventTypeThreshold}
+	buf, _ := entry.MarshalBinary()
+	req := &AddSELEntryRequest{}
+	copy(req.Record[:], buf)
+	res := &AddSELEntryResponse{}
+	err = client.Send(&Request{NetworkFunctionStorage, CommandAddSELEntry, req}, res)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), res.RecordID)
+	assert.NoError(t, s.AddSELEntry(&SELEntry{RecordType: 0xe0}))
+
+	entries, err := client.SELEntries()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, uint16(1), entries[0].RecordID)
+	assert.Equal(t, uint8(0x30), entries[0].SensorNumber)
+	assert.WithinDuration(t, time.Now(), entries[0].Timestamp, time.Minute)
+	assert.True(t, entries[1].Timestamp.IsZero())
+	assert.Equal(t, entries, s.SELEntries())
+
+	// Clear SEL requires the 'CLR' signature and a reservation
+	clearReq := &ClearSELRequest{Signature: clearSELSignature, Action: ClearSELInitiate}
+	err = client.Send(&Request{NetworkFunctionStorage, CommandClearSEL, clearReq}, &ClearSELResponse{})
+	assert.Equal(t, ErrInvalidResv, err)
+	clearReq.Signature = [3]uint8{'C', 'L', 'X'}
+	err = client.Send(&Request{NetworkFunctionStorage, CommandClearSEL, clearReq}, &ClearSELResponse{})
+	assert.Equal(t, ErrInvalidPacket, err)
+
+	err = client.ClearSEL()
+	assert.NoError(t, err)
+	assert.Empty(t, s.SELEntries())
+
+	info := &SELInfoResponse{}
+	err = client.Send(&Request{NetworkFunctionStorage, CommandGetSELInfo, &SELInfoRequest{}}, info)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), info.Entries)
+	assert.NotZero(t, info.LastEraseTimestamp)
+
+	// record IDs continue after a clear
+	assert.NoError(t, s.AddSELEntry(&SELEntry{}))
+	assert.Equal(t, uint16(3), s.SELEntries()[0].RecordID)
+
+	for i := 1; i < simSELCapacity; i++ {
+		assert.NoError(t, s.AddSELEntry(&SELEntry{}))
+	}
+	err = client.Send(&Request{NetworkFunctionStorage, CommandAddSELEntry, req}, res)
+	assert.Equal(t, ErrOutOfSpace, err)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestSimulatorFRUWrite(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	err = client.WriteFRUData(1, 0, []byte{1})
+	assert.Equal(t, ErrNoObj, err)
+
+	s.SetFRUData(1, make([]byte, 64))
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	err = client.WriteFRUData(1, 8, data)
+	assert.NoError(t, err)
+	area, ok := s.FRUData(1)
+	assert.True(t, ok)
+	assert.Equal(t, data, area[8:8+len(data)])
+	assert.Equal(t, make([]byte, 8), area[:8])
+
+	// writes past the end of the area are rejected
+	err = client.WriteFRUData(1, 60, data[:8])
+	assert.Equal(t, ErrParamRange, err)
+
+	// inventory written by the client is read back
+	fru := &FRUInfo{ChassisType: 0x17, ChassisSerial: "CZ1234", ProductName: "goipmi"}
+	buf, err := fru.MarshalBinary()
+	assert.NoError(t, err)
+	s.SetFRUData(0, make([]byte, len(buf)))
+	err = client.WriteFRUData(0, 0, buf)
+	assert.NoError(t, err)
+	info, err := client.FRU(0)
+	assert.NoError(t, err)
+	assert.Equal(t, fru, info)
+
+	_, ok = s.FRUData(2)
+	assert.False(t, ok)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
+
+func TestSensorWaveform(t *testing.T) {
+	sine := SineWave(40, 10, 4*time.Second)
+	assert.InDelta(t, 40.0, sine(0), 0.001)
+	assert.InDelta(t, 50.0, sine(time.Second), 0.001)
+	assert.InDelta(t, 30.0, sine(3*time.Second), 0.001)
+
+	ramp := Ramp(20, 60, 4*time.Second)
+	assert.InDelta(t, 20.0, ramp(0), 0.001)
+	assert.InDelta(t, 30.0, ramp(time.Second), 0.001)
+	assert.InDelta(t, 60.0, ramp(time.Minute), 0.001)
+
+	steps := Steps(time.Second, 1, 2, 3)
+	assert.Equal(t, 1.0, steps(0))
+	assert.Equal(t, 3.0, steps(2500*time.Millisecond))
+	assert.Equal(t, 1.0, steps(3*time.Second))
+	assert.Equal(t, 0.0, Steps(time.Second)(time.Second))
+
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.AddSDR(&SDR{RecordType: SDRTypeFullSensor, SensorNumber: 0x30, EventType: EventTypeThreshold, BaseUnit: 1, M: 1, Name: "Inlet Temp"}))
+	assert.Equal(t, ErrNoObj, s.SetSensorWaveform(0x40, steps))
+	assert.NoError(t, s.SetSensorWaveform(0x30, Steps(time.Hour, 25)))
+
+	sensors, err := client.Sensors()
+	assert.NoError(t, err)
+	assert.InDelta(t, 25.0, sensors[0].Value, 0.001)
+	assert.Equal(t, "ok", sensors[0].Status)
+
+	// a reading set by API replaces the waveform
+	assert.NoError(t, s.SetSensorReading(0x30, 90, ThresholdUpperCritical))
+	sensors, err = client.Sensors()
+	assert.NoError(t, err)
+	assert.InDelta(t, 90.0, sensors[0].Value, 0.001)
+	assert.Equal(t, "cr", sensors[0].Status)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}
@@ -70,3 +70,84 @@ func TestSimulator(t *testing.T) {
 	client.Close()
 	s.Stop()
 }
+
+func TestSimulatorIPv6(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{IP: net.IPv6loopback})
+	if err := s.Run(); err != nil {
+		t.Skipf("IPv6 not available: %s", err)
+	}
+
+	c := s.NewConnection()
+	assert.Equal(t, "::1", c.Hostname)
+
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	_, err = client.DeviceID()
+	assert.NoError(t, err)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+
+	// without an IP the Simulator accepts both IPv4 and IPv6 clients
+	s = NewSimulator(net.UDPAddr{})
+	assert.NoError(t, s.Run())
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		c := s.NewConnection()
+		c.Hostname = host
+		client, err := NewClient(c)
+		assert.NoError(t, err)
+		assert.NoError(t, client.Open(), host)
+		_, err = client.DeviceID()
+		assert.NoError(t, err, host)
+		assert.NoError(t, client.Close())
+	}
+	s.Stop()
+}
+
+func FuzzSimulator(f *testing.F) {
+	m := &Message{
+		rmcpHeader:  &rmcpHeader{Version: rmcpVersion1, Class: rmcpClassIPMI, RMCPSequenceNumber: 0xff},
+		ipmiSession: &ipmiSession{},
+		ipmiHeader:  &ipmiHeader{RsAddr: 0x20, NetFnRsLUN: uint8(NetworkFunctionApp) << 2, Command: CommandGetSessionChallenge},
+	}
+	f.Add(mustBytes(m.toBytes(&SessionChallengeRequest{AuthType: AuthTypeMD5})))
+	m.Command = CommandGetUserName
+	f.Add(mustBytes(m.toBytes(&GetUserNameRequest{UserID: 0xff})))
+	m.NetFnRsLUN = uint8(NetworkFunctionChassis) << 2
+	m.Command = CommandGetSystemBootOptions
+	f.Add(mustBytes(m.toBytes(&SystemBootOptionsRequest{Param: 0xff})))
+	m.NetFnRsLUN = uint8(NetworkFunctionStorage) << 2
+	m.Command = CommandWriteFRUData
+	f.Add(mustBytes(m.toBytes(&WriteFRUDataRequest{Offset: 0x3f, Data: []uint8{1, 2}})))
+	m.Command = CommandClearSEL
+	f.Add(mustBytes(m.toBytes(&ClearSELRequest{ReservationID: 1, Signature: clearSELSignature, Action: ClearSELInitiate})))
+	m.NetFnRsLUN = uint8(NetworkFunctionApp) << 2
+	m.Command = CommandGetChannelCipherSuites
+	plus := &rmcpPlusMessage{PayloadType: PayloadTypeIPMI, Payload: mustBytes(m.payloadBytes(&ChannelCipherSuitesRequest{ChannelNumber: 0x0e}))}
+	f.Add(plus.toBytes(nil))
+	plus = &rmcpPlusMessage{PayloadType: PayloadTypeOpenSessionRequest, Payload: mustBytes(messageDataToBytes(&OpenSessionRequest{ConsoleSessionID: 1}))}
+	f.Add(plus.toBytes(nil))
+
+	s := NewSimulator(net.UDPAddr{})
+	s.SetFRUData(0, make([]byte, 64))
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		if len(buf) > rmcpHeaderSize && buf[rmcpHeaderSize] == authTypeRMCPPlus {
+			_, _ = s.plusCommand(buf, &net.UDPAddr{})
+			return
+		}
+		m, err := messageFromBytes(buf)
+		if err != nil {
+			return
+		}
+		_ = s.ipmiCommand(m, buf)
+		// handlers are reached without a privileged session as well
+		if handler, ok := s.handlers[m.NetFn()][m.Command]; ok {
+			_ = handler(m)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+// simMaxUsers is the number of user IDs of the simulated BMC
+const simMaxUsers = 10
+
+// SimulatorUser is an entry of the Simulator user table
+type SimulatorUser struct {
+	Name     string
+	Password string
+	// Privilege is the highest privilege level the user can activate a
+	// session with, PrivLevelNone defaults to PrivLevelAdmin
+	Privilege uint8
+	Enabled   bool
+}
+
+func (u *SimulatorUser) privilege() uint8 {
+	if u.Privilege == PrivLevelNone {
+		return PrivLevelAdmin
+	}
+	return u.Privilege
+}
+
+// defaultSimUsers enables the null user (ID 1) and an admin user (ID 2),
+// both without password
+func defaultSimUsers() [simMaxUsers]SimulatorUser {
+	return [simMaxUsers]SimulatorUser{
+		{Name: "", Privilege: PrivLevelAdmin, Enabled: true},
+		{Name: "admin", Privilege: PrivLevelAdmin, Enabled: true},
+	}
+}
+
+// SetUser sets the user table entry with the given ID.
+// ID 1 is the null user, sessions with an empty username authenticate as this user.
+func (s *Simulator) SetUser(id uint8, user SimulatorUser) error {
+	if id == 0 || id > simMaxUsers {
+		return ErrParamRange
+	}
+	s.mu.Lock()
+	s.users[id-1] = user
+	s.mu.Unlock()
+	return nil
+}
+
+// User returns the user table entry with the given ID
+func (s *Simulator) User(id uint8) (SimulatorUser, bool) {
+	if id == 0 || id > simMaxUsers {
+		return SimulatorUser{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users[id-1], true
+}
+
+// SetPassword sets the password of the given user, adding an enabled
+// Administrator user to the first free user ID if there is no such user.
+func (s *Simulator) SetPassword(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user := s.lookupUser(username); user != nil {
+		user.Password = password
+		return
+	}
+
+	for i := 1; i < simMaxUsers; i++ {
+		if user := &s.users[i]; user.Name == "" && !user.Enabled {
+			*user = SimulatorUser{Name: username, Password: password, Privilege: PrivLevelAdmin, Enabled: true}
+			return
+		}
+	}
+
+	s.logger.Warn("simulator user table is full", "user", username)
+}
+
+// lookupUser by name, the empty name is the null user.
+// Must be called with the mutex held.
+func (s *Simulator) lookupUser(name string) *SimulatorUser {
+	if name == "" {
+		if s.users[0].Name == "" {
+			return &s.users[0]
+		}
+		return nil
+	}
+	for i := range s.users {
+		if s.users[i].Name == name {
+			return &s.users[i]
+		}
+	}
+	return nil
+}
+
+func (s *Simulator) getUserName(m *Message) Response {
+	req := &GetUserNameRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+	user, ok := s.User(req.UserID)
+	if !ok {
+		return ErrParamRange
+	}
+	return &GetUserNameResponse{
+		CompletionCode: CommandCompleted,
+		Username:       user.Name,
+	}
+}
+
+func (s *Simulator) setUserName(m *Message) Response {
+	req := &SetUserNameRequest{}
+	if err := m.Request(req); err != nil {
+		return err
+	}
+	if req.UserID == 0 || req.UserID > simMaxUsers {
+		return ErrParamRange
+	}
+	s.mu.Lock()
+	s.users[req.UserID-1].Name = req.Username
+	s.mu.Unlock()
+	return &SetUserNameResponse{
+		CompletionCode: CommandCompleted,
+	}
+}
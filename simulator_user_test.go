@@ -0,0 +1,161 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorUsers(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+
+	user, ok := s.User(1)
+	assert.True(t, ok)
+	assert.Equal(t, "", user.Name)
+	assert.True(t, user.Enabled)
+
+	_, ok = s.User(0)
+	assert.False(t, ok)
+	_, ok = s.User(simMaxUsers + 1)
+	assert.False(t, ok)
+
+	assert.Equal(t, ErrParamRange, s.SetUser(0, SimulatorUser{}))
+	assert.NoError(t, s.SetUser(simMaxUsers, SimulatorUser{Name: "last"}))
+
+	s.SetPassword("admin", "secret")
+	user, _ = s.User(2)
+	assert.Equal(t, "secret", user.Password)
+
+	s.SetPassword("vmware", "cow")
+	user, _ = s.User(3)
+	assert.Equal(t, SimulatorUser{Name: "vmware", Password: "cow", Privilege: PrivLevelAdmin, Enabled: true}, user)
+}
+
+func TestSimulatorAuthentication(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	assert.NoError(t, s.SetUser(3, SimulatorUser{Name: "vmware", Password: "cow", Enabled: true}))
+	assert.NoError(t, s.SetUser(4, SimulatorUser{Name: "monitor", Password: "cow", Privilege: PrivLevelUser, Enabled: true}))
+	assert.NoError(t, s.SetUser(5, SimulatorUser{Name: "disabled", Password: "cow"}))
+	err := s.Run()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		should    string
+		username  string
+		password  string
+		authType  uint8
+		privilege uint8
+		err       error
+	}{
+		{"should authenticate with MD5", "vmware", "cow", AuthTypeMD5, 0, nil},
+		{"should authenticate with a password", "vmware", "cow", AuthTypePassword, 0, nil},
+		{"should authenticate without auth", "vmware", "", AuthTypeNone, 0, nil},
+		{"should authenticate the null user", "", "", AuthTypeMD5, 0, nil},
+		{"should reject an unknown user", "nobody", "cow", AuthTypeMD5, 0, ErrInvalidUsername},
+		{"should reject a disabled user", "disabled", "cow", AuthTypeMD5, 0, ErrInvalidUsername},
+		{"should limit the user privilege", "monitor", "cow", AuthTypeMD5, PrivLevelAdmin, ErrPrivLimitExceeded},
+		{"should allow the user privilege", "monitor", "cow", AuthTypeMD5, PrivLevelUser, nil},
+	}
+
+	for _, test := range tests {
+		c := s.NewConnection()
+		c.Username = test.username
+		c.Password = test.password
+		c.Privilege = test.privilege
+		c.AuthTypes = []uint8{test.authType}
+
+		l := newLanTransport(c).(*lan)
+		err = l.open()
+		assert.Equal(t, test.err, err, test.should)
+		if err == nil {
+			err = l.send(&Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}, &DeviceIDResponse{})
+			assert.NoError(t, err, test.should)
+		}
+		_ = l.close()
+	}
+
+	// messages failing authentication are discarded
+	for _, authType := range []uint8{AuthTypeMD5, AuthTypeMD2, AuthTypePassword} {
+		c := s.NewConnection()
+		c.Username = "vmware"
+		c.Password = "horse"
+		c.AuthTypes = []uint8{authType}
+		c.Timeout = 50 * time.Millisecond
+
+		l := newLanTransport(c).(*lan)
+		err = l.open()
+		assert.Error(t, err)
+		assert.True(t, isTimeout(err), "auth type %d", authType)
+		_ = l.close()
+	}
+
+	// the null user is disabled
+	assert.NoError(t, s.SetUser(1, SimulatorUser{}))
+	l := newLanTransport(s.NewConnection()).(*lan)
+	err = l.open()
+	assert.Equal(t, ErrNullUserDisabled, err)
+	_ = l.close()
+
+	s.Stop()
+}
+
+func TestSimulatorPrivilege(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	s.SetPassword("vmware", "cow")
+	err := s.Run()
+	assert.NoError(t, err)
+
+	c := s.NewConnection()
+	c.Username = "vmware"
+	c.Password = "cow"
+	c.Privilege = PrivLevelUser
+	l := newLanTransport(c).(*lan)
+	err = l.open()
+	assert.NoError(t, err)
+
+	err = l.send(&Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}, &DeviceIDResponse{})
+	assert.NoError(t, err)
+
+	err = l.send(&Request{NetworkFunctionChassis, CommandChassisControl, &ChassisControlRequest{ControlPowerCycle}}, &ChassisControlResponse{})
+	assert.Equal(t, ErrPrivLevel, err)
+
+	// above the limit requested on activation
+	res := &SessionPrivilegeLevelResponse{}
+	err = l.send(&Request{NetworkFunctionApp, CommandSetSessionPrivilegeLevel, &SessionPrivilegeLevelRequest{PrivLevelAdmin}}, res)
+	assert.Equal(t, ErrSessionPrivLimit, err)
+
+	err = l.send(&Request{NetworkFunctionApp, CommandSetSessionPrivilegeLevel, &SessionPrivilegeLevelRequest{PrivLevelNone}}, res)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(PrivLevelUser), res.NewPrivilegeLevel)
+
+	_ = l.close()
+
+	// commands require a session
+	c = s.NewConnection()
+	l = newLanTransport(c).(*lan)
+	err = l.connect()
+	assert.NoError(t, err)
+	err = l.send(&Request{NetworkFunctionApp, CommandGetDeviceID, &DeviceIDRequest{}}, &DeviceIDResponse{})
+	assert.Equal(t, ErrPrivLevel, err)
+	_ = l.close()
+
+	s.Stop()
+}
@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+// ActivatePayloadRequest per section 24.1
+type ActivatePayloadRequest struct {
+	PayloadType     uint8
+	PayloadInstance uint8
+	AuxData         [4]uint8
+}
+
+// ActivatePayloadResponse per section 24.1
+type ActivatePayloadResponse struct {
+	CompletionCode
+	AuxData             [4]uint8
+	InboundPayloadSize  uint16
+	OutboundPayloadSize uint16
+	PayloadPort         uint16
+	// PayloadVLAN is ffffh if VLANs are not in use
+	PayloadVLAN uint16
+}
+
+// DeactivatePayloadRequest per section 24.2
+type DeactivatePayloadRequest struct {
+	PayloadType     uint8
+	PayloadInstance uint8
+	AuxData         [4]uint8
+}
+
+// DeactivatePayloadResponse per section 24.2
+type DeactivatePayloadResponse struct {
+	CompletionCode
+}
+
+// ChannelCipherSuitesRequest per section 22.15
+type ChannelCipherSuitesRequest struct {
+	ChannelNumber uint8
+	PayloadType   uint8
+	// ListIndex selects the 16 byte block of records, bit 7 lists by cipher suite
+	ListIndex uint8
+}
+
+// ChannelCipherSuitesResponse per section 22.15
+type ChannelCipherSuitesResponse struct {
+	CompletionCode
+	ChannelNumber uint8
+	Records       []uint8
+}
+
+// cipherSuiteRecords returns the cipher suite records of the given suites
+// per section 22.15.1, with a start of record byte and tagged algorithms
+func cipherSuiteRecords(suites []cipherSuite) []uint8 {
+	var records []uint8
+	for _, suite := range suites {
+		records = append(records, 0xc0, suite.id,
+			suite.auth, 0x40|suite.integrity, 0x80|suite.confidentiality)
+	}
+	return records
+}
+
+// solHeaderSize is the size of the SOL payload header
+const solHeaderSize = 4
+
+// solNack is the SOL status bit of a packet that was not accepted, per section 15.9
+const solNack = 0x40
+
+// solPacket is the Serial Over LAN payload per section 15.9.
+// Sequence 0 is reserved for packets that only acknowledge.
+type solPacket struct {
+	Sequence    uint8 `ipmi:"bits=4"`
+	_           uint8 `ipmi:"bits=4"`
+	AckSequence uint8 `ipmi:"bits=4"`
+	_           uint8 `ipmi:"bits=4"`
+	// Accepted is the number of characters accepted from the acknowledged packet
+	Accepted uint8
+	Status   uint8
+	Data     []uint8
+}
@@ -0,0 +1,53 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSOLPacket(t *testing.T) {
+	p := &solPacket{Sequence: 3, AckSequence: 2, Accepted: 5, Status: solNack, Data: []byte("ok")}
+	buf, err := Marshal(p)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x03, 0x02, 0x05, 0x40, 'o', 'k'}, buf)
+
+	q := &solPacket{}
+	assert.NoError(t, Unmarshal(buf, q))
+	assert.Equal(t, p, q)
+}
+
+func TestActivatePayload(t *testing.T) {
+	buf, err := Marshal(&ActivatePayloadRequest{PayloadType: PayloadTypeSOL, PayloadInstance: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x00}, buf)
+
+	res := &ActivatePayloadResponse{}
+	err = Unmarshal([]byte{0x00, 0, 0, 0, 0, 0x80, 0x00, 0x80, 0x00, 0x6f, 0x02, 0xff, 0xff}, res)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(128), res.InboundPayloadSize)
+	assert.Equal(t, uint16(128), res.OutboundPayloadSize)
+	assert.Equal(t, uint16(623), res.PayloadPort)
+	assert.Equal(t, uint16(0xffff), res.PayloadVLAN)
+}
+
+func TestCipherSuiteRecords(t *testing.T) {
+	records := cipherSuiteRecords([]cipherSuite{{id: 17, auth: authRAKPHMACSHA256, integrity: integrityHMACSHA256, confidentiality: confidentialityAESCBC128}})
+	assert.Equal(t, []byte{0xc0, 17, 0x03, 0x44, 0x81}, records)
+}
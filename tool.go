@@ -19,11 +19,14 @@ package ipmi
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type tool struct {
@@ -44,11 +47,14 @@ func (t *tool) close() error {
 
 func (t *tool) send(req *Request, res Response) error {
 	// ipmitool ... raw .. .. ..
-	args := append([]string{"raw"}, requestToStrings(req)...)
+	raw, err := requestToStrings(req)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"raw"}, raw...)
 
 	output, err := t.run(args...)
 	if err != nil {
-		// TODO: parse CompletionCode from stderr
 		return err
 	}
 
@@ -69,30 +75,82 @@ func (t *tool) options() []string {
 		intf = "lanplus"
 	}
 
+	// keep the password out of the process table,
+	// -E reads it from the IPMI_PASSWORD environment variable
+	password := []string{"-E"}
+	if t.PasswordFile != "" {
+		password = []string{"-f", t.PasswordFile}
+	}
+
 	options := []string{
-		"-H", t.Hostname,
+		"-H", t.host(),
 		"-U", t.Username,
-		"-P", t.Password,
-		"-I", intf,
 	}
+	options = append(options, password...)
+	options = append(options, "-I", intf)
 
 	if t.Port != 0 {
 		options = append(options, "-p", strconv.Itoa(t.Port))
 	}
 
+	if t.CipherSuite != 0 {
+		options = append(options, "-C", strconv.Itoa(t.CipherSuite))
+	}
+
+	if name, ok := toolPrivLevels[t.Privilege]; ok {
+		options = append(options, "-L", name)
+	}
+
+	if t.BMCKey != "" {
+		options = append(options, "-y", hex.EncodeToString([]byte(t.BMCKey)))
+	}
+
+	if t.Retries != 0 {
+		options = append(options, "-R", strconv.Itoa(t.Retries))
+	}
+
+	if t.Timeout != 0 {
+		// whole seconds, rounded up
+		seconds := (t.Timeout + time.Second - 1) / time.Second
+		options = append(options, "-N", strconv.Itoa(int(seconds)))
+	}
+
+	if t.TargetAddress != 0 {
+		options = append(options, "-t", fmt.Sprintf("0x%02x", t.TargetAddress))
+		if t.TargetChannel != 0 {
+			options = append(options, "-b", strconv.Itoa(int(t.TargetChannel)))
+		}
+	}
+
 	return options
 }
 
+// ipmitool -L privilege level names
+var toolPrivLevels = map[uint8]string{
+	PrivLevelCallback: "CALLBACK",
+	PrivLevelUser:     "USER",
+	PrivLevelOperator: "OPERATOR",
+	PrivLevelAdmin:    "ADMINISTRATOR",
+	PrivLevelOEM:      "OEM",
+}
+
+// toolPath returns the ipmitool command of the Connection
+func toolPath(c *Connection) string {
+	if c.Path == "" {
+		return "ipmitool"
+	}
+	return c.Path
+}
+
 func (t *tool) cmd(args ...string) *exec.Cmd {
-	path := t.Path
 	opts := append(t.options(), args...)
 
-	if path == "" {
-		path = "ipmitool"
+	cmd := exec.Command(toolPath(t.Connection), opts...)
+	if t.PasswordFile == "" {
+		cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+t.Password)
 	}
 
-	return exec.Command(path, opts...)
-
+	return cmd
 }
 
 func (t *tool) run(args ...string) (string, error) {
@@ -104,25 +162,107 @@ func (t *tool) run(args ...string) (string, error) {
 
 	err := cmd.Run()
 	if err != nil {
-		return "", fmt.Errorf("run %s %s: %s (%s)",
-			cmd.Path, strings.Join(cmd.Args, " "), stderr.String(), err)
+		return "", toolError(cmd, stderr.String(), err)
 	}
 
 	return stdout.String(), err
 }
 
-func requestToBytes(r *Request) []byte {
-	data := messageDataToBytes(r.Data)
+// Errors parsed from ipmitool failures that do not include a CompletionCode
+var (
+	ErrAuthFailed  = errors.New("authentication failed")
+	ErrTimeout     = errors.New("timeout")
+	ErrUnreachable = errors.New("BMC unreachable")
+)
+
+// ToolError is returned when ipmitool fails for a reason other than a
+// CompletionCode, which is returned as is, the same as the lan transport.
+type ToolError struct {
+	// Err is one of ErrAuthFailed, ErrTimeout, ErrUnreachable or the exec error
+	Err    error
+	Path   string
+	Args   []string
+	Stderr string
+}
+
+func (e *ToolError) Error() string {
+	return fmt.Sprintf("run %s %s: %s (%s)",
+		e.Path, strings.Join(e.Args, " "), e.Stderr, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout returns true if ipmitool got no response from the BMC
+func (e *ToolError) Timeout() bool {
+	return e.Err == ErrTimeout
+}
+
+// ipmitool raw failures: "Unable to send RAW command (... rsp=0xc1): Invalid command"
+var toolCompletionCode = regexp.MustCompile(`rsp=0x([0-9a-fA-F]{1,2})\b`)
+
+// ipmitool failure messages, checked in order. Only messages of the
+// BMC rejecting the credentials are ErrAuthFailed, not local failures
+// such as reading the password file.
+var toolErrors = []struct {
+	match *regexp.Regexp
+	err   error
+}{
+	{regexp.MustCompile(`(?i)invalid user name`), ErrAuthFailed},
+	{regexp.MustCompile(`(?i)null user name`), ErrAuthFailed},
+	{regexp.MustCompile(`(?i)unauthorized name`), ErrAuthFailed},
+	{regexp.MustCompile(`(?i)RAKP \d HMAC is invalid`), ErrAuthFailed},
+	{regexp.MustCompile(`(?i)invalid integrity check`), ErrAuthFailed},
+	{regexp.MustCompile(`(?i)authentication type \S+ not supported`), ErrAuthFailed},
+	{regexp.MustCompile(`(?i)no response`), ErrTimeout},
+	{regexp.MustCompile(`(?i)timeout`), ErrTimeout},
+	{regexp.MustCompile(`(?i)timed out`), ErrTimeout},
+	{regexp.MustCompile(`(?i)address lookup`), ErrUnreachable},
+	{regexp.MustCompile(`(?i)unreachable`), ErrUnreachable},
+	{regexp.MustCompile(`(?i)unable to establish`), ErrUnreachable},
+}
+
+func toolError(cmd *exec.Cmd, stderr string, err error) error {
+	if m := toolCompletionCode.FindStringSubmatch(stderr); m != nil {
+		code, _ := strconv.ParseUint(m[1], 16, 8)
+		return CompletionCode(code)
+	}
+
+	for _, e := range toolErrors {
+		if e.match.MatchString(stderr) {
+			err = e.err
+			break
+		}
+	}
+
+	return &ToolError{
+		Err:    err,
+		Path:   cmd.Path,
+		Args:   cmd.Args,
+		Stderr: stderr,
+	}
+}
+
+func requestToBytes(r *Request) ([]byte, error) {
+	data, err := messageDataToBytes(r.Data)
+	if err != nil {
+		return nil, err
+	}
 	msg := make([]byte, 2+len(data))
 	msg[0] = uint8(r.NetworkFunction)
 	msg[1] = uint8(r.Command)
 	copy(msg[2:], data)
-	return msg
+	return msg, nil
 }
 
-func requestToStrings(r *Request) []string {
-	msg := requestToBytes(r)
-	return rawEncode(msg)
+func requestToStrings(r *Request) ([]string, error) {
+	msg, err := requestToBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	return rawEncode(msg), nil
 }
 
 func responseFromBytes(msg []byte, r Response) error {
@@ -133,26 +273,27 @@ func responseFromBytes(msg []byte, r Response) error {
 }
 
 func responseFromString(s string, r Response) error {
-	msg := rawDecode(strings.TrimSpace(s))
+	msg, err := rawDecode(s)
+	if err != nil {
+		return err
+	}
 	return responseFromBytes(msg, r)
 }
 
-func rawDecode(data string) []byte {
+// rawDecode ipmitool raw output, which wraps every 16 bytes
+func rawDecode(data string) ([]byte, error) {
 	var buf bytes.Buffer
 
-	for _, s := range strings.Split(data, " ") {
+	for _, s := range strings.Fields(data) {
 		b, err := hex.DecodeString(s)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("invalid ipmitool raw output %q: %s", data, err)
 		}
 
-		_, err = buf.Write(b)
-		if err != nil {
-			panic(err)
-		}
+		_, _ = buf.Write(b)
 	}
 
-	return buf.Bytes()
+	return buf.Bytes(), nil
 }
 
 func rawEncode(data []byte) []string {
@@ -0,0 +1,225 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// High level operations run as ipmitool subcommands,
+// with the output parsed into the same types as the Client uses.
+
+func (t *tool) selEntries() ([]*SELEntry, error) {
+	// -v prints every field of the entries
+	output, err := t.run("-v", "sel", "list")
+	if err != nil {
+		return nil, err
+	}
+	return parseToolSEL(output)
+}
+
+func (t *tool) sensors() ([]*SensorReading, error) {
+	output, err := t.run("sensor", "list")
+	if err != nil {
+		return nil, err
+	}
+	return parseToolSensors(output)
+}
+
+func (t *tool) fru(id uint8) (*FRUInfo, error) {
+	output, err := t.run("fru", "print", strconv.Itoa(int(id)))
+	if err != nil {
+		return nil, err
+	}
+	return parseToolFRU(output)
+}
+
+// toolFields splits "Name : Value" lines into blocks separated by blank lines
+func toolFields(output string) []map[string]string {
+	var blocks []map[string]string
+	var block map[string]string
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			block = nil
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		if block == nil {
+			block = map[string]string{}
+			blocks = append(blocks, block)
+		}
+		block[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+
+	return blocks
+}
+
+func parseHex(s string, bits int) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, bits)
+}
+
+// ipmitool event type names of the codes that have a single name
+var toolEventTypes = map[string]uint8{
+	"Threshold":                EventTypeThreshold,
+	"Sensor-specific Discrete": EventTypeSensorSpecific,
+}
+
+// parseToolSEL parses the output of ipmitool -v sel list
+func parseToolSEL(output string) ([]*SELEntry, error) {
+	var entries []*SELEntry
+
+	for _, fields := range toolFields(output) {
+		id, ok := fields["SEL Record ID"]
+		if !ok {
+			continue
+		}
+
+		e := &SELEntry{}
+		v, err := parseHex(id, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SEL record ID %q", id)
+		}
+		e.RecordID = uint16(v)
+
+		if v, err := parseHex(fields["Record Type"], 8); err == nil {
+			e.RecordType = uint8(v)
+		}
+		if v, err := parseHex(fields["Generator ID"], 16); err == nil {
+			e.GeneratorID = uint16(v)
+		}
+		if v, err := parseHex(fields["EvM Revision"], 8); err == nil {
+			e.EvMRev = uint8(v)
+		}
+		if v, err := parseHex(fields["Sensor Number"], 8); err == nil {
+			e.SensorNumber = uint8(v)
+		}
+		if ts, err := time.Parse("01/02/2006 15:04:05", strings.TrimSuffix(fields["Timestamp"], " UTC")); err == nil {
+			e.Timestamp = ts
+		}
+		for code, name := range sensorTypeStrings {
+			if name == fields["Sensor Type"] {
+				e.SensorType = code
+			}
+		}
+		e.EventType = toolEventTypes[fields["Event Type"]]
+		e.Deassertion = strings.HasPrefix(fields["Event Direction"], "Deassertion")
+		if data, err := hex.DecodeString(fields["Event Data"]); err == nil {
+			copy(e.EventData[:], data)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// parseToolSensors parses the output of ipmitool sensor list
+func parseToolSensors(output string) ([]*SensorReading, error) {
+	var sensors []*SensorReading
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), "|")
+		if len(cols) < 4 {
+			continue
+		}
+		for i := range cols {
+			cols[i] = strings.TrimSpace(cols[i])
+		}
+
+		s := &SensorReading{
+			Name:   cols[0],
+			Units:  cols[2],
+			Status: cols[3],
+		}
+
+		switch {
+		case cols[1] == "na":
+			s.Status = "na"
+		case strings.HasPrefix(cols[1], "0x"):
+			v, err := parseHex(cols[1], 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sensor %q value %q", s.Name, cols[1])
+			}
+			s.Value = float64(v)
+			// the state bytes of a discrete sensor, in the order received
+			state, err := parseHex(s.Status, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sensor %q state %q", s.Name, s.Status)
+			}
+			s.State = uint16(state>>8) | uint16(state&0xff)<<8
+		default:
+			v, err := strconv.ParseFloat(cols[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sensor %q value %q", s.Name, cols[1])
+			}
+			s.Value = v
+		}
+
+		sensors = append(sensors, s)
+	}
+
+	return sensors, nil
+}
+
+// parseToolFRU parses the output of ipmitool fru print
+func parseToolFRU(output string) (*FRUInfo, error) {
+	blocks := toolFields(output)
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("invalid ipmitool fru output %q", output)
+	}
+	fields := blocks[0]
+
+	f := &FRUInfo{
+		ChassisPartNumber:   fields["Chassis Part Number"],
+		ChassisSerial:       fields["Chassis Serial"],
+		BoardManufacturer:   fields["Board Mfg"],
+		BoardProduct:        fields["Board Product"],
+		BoardSerial:         fields["Board Serial"],
+		BoardPartNumber:     fields["Board Part Number"],
+		ProductManufacturer: fields["Product Manufacturer"],
+		ProductName:         fields["Product Name"],
+		ProductPartNumber:   fields["Product Part Number"],
+		ProductVersion:      fields["Product Version"],
+		ProductSerial:       fields["Product Serial"],
+		ProductAssetTag:     fields["Product Asset Tag"],
+	}
+
+	for i, name := range chassisTypeStrings {
+		if name == fields["Chassis Type"] {
+			f.ChassisType = ChassisType(i)
+		}
+	}
+
+	date := strings.TrimSuffix(fields["Board Mfg Date"], " UTC")
+	if ts, err := time.Parse("Mon Jan _2 15:04:05 2006", date); err == nil {
+		f.BoardMfgDate = ts
+	}
+
+	return f, nil
+}
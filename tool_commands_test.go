@@ -0,0 +1,168 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseToolSEL(t *testing.T) {
+	output := `SEL Record ID          : 0001
+ Record Type           : 02
+ Timestamp             : 05/14/2020 08:00:00
+ Generator ID          : 0020
+ EvM Revision          : 04
+ Sensor Type           : Temperature
+ Sensor Number         : 30
+ Event Type            : Threshold
+ Event Direction       : Deassertion Event
+ Event Data            : 570000
+ Description           : Upper Critical going high
+
+SEL Record ID          : 0002
+ Record Type           : 02
+ Timestamp             : 05/14/2020 08:01:00
+ Generator ID          : 0020
+ EvM Revision          : 04
+ Sensor Type           : Power Supply
+ Sensor Number         : 61
+ Event Type            : Sensor-specific Discrete
+ Event Direction       : Assertion Event
+ Event Data            : 01ffff
+ Description           : Presence detected
+`
+
+	entries, err := parseToolSEL(output)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+
+	e := entries[0]
+	assert.Equal(t, uint16(1), e.RecordID)
+	assert.Equal(t, uint8(2), e.RecordType)
+	assert.Equal(t, time.Date(2020, time.May, 14, 8, 0, 0, 0, time.UTC), e.Timestamp)
+	assert.Equal(t, uint16(0x20), e.GeneratorID)
+	assert.Equal(t, SensorType(0x01), e.SensorType)
+	assert.Equal(t, uint8(0x30), e.SensorNumber)
+	assert.Equal(t, uint8(EventTypeThreshold), e.EventType)
+	assert.True(t, e.Deassertion)
+	assert.Equal(t, [3]uint8{0x57, 0, 0}, e.EventData)
+
+	e = entries[1]
+	assert.Equal(t, uint16(2), e.RecordID)
+	assert.Equal(t, "Power Supply", e.SensorType.String())
+	assert.Equal(t, uint8(EventTypeSensorSpecific), e.EventType)
+	assert.False(t, e.Deassertion)
+
+	_, err = parseToolSEL("SEL Record ID : xyz\n")
+	assert.Error(t, err)
+}
+
+func TestParseToolSensors(t *testing.T) {
+	output := `CPU Temp         | 45.000     | degrees C  | ok    | na        | 5.000     | 10.000    | 85.000    | 90.000    | na
+Fan1             | na         | RPM        | na    | na        | 300.000   | 500.000   | na        | na        | na
+PS Status        | 0x1        | discrete   | 0x0100| na        | na        | na        | na        | na        | na
+`
+
+	sensors, err := parseToolSensors(output)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(sensors))
+
+	assert.Equal(t, "CPU Temp", sensors[0].Name)
+	assert.Equal(t, 45.0, sensors[0].Value)
+	assert.Equal(t, "degrees C", sensors[0].Units)
+	assert.Equal(t, "ok", sensors[0].Status)
+	assert.True(t, sensors[0].Available())
+
+	assert.Equal(t, "Fan1", sensors[1].Name)
+	assert.False(t, sensors[1].Available())
+
+	assert.Equal(t, 1.0, sensors[2].Value)
+	assert.Equal(t, "0x0100", sensors[2].Status)
+	assert.Equal(t, uint16(0x0001), sensors[2].State)
+
+	// a discrete sensor reads the same natively
+	sdr := &SDR{Name: "PS Status", EventType: EventTypeSensorSpecific}
+	native := newSensorReading(sdr, &SensorReadingResponse{Reading: 1, Flags: 0xc0, State: [2]uint8{0x01, 0x00}})
+	assert.Equal(t, native, sensors[2])
+
+	_, err = parseToolSensors("CPU Temp | hot | degrees C | ok\n")
+	assert.Error(t, err)
+	_, err = parseToolSensors("PS Status | 0x1 | discrete | ok\n")
+	assert.Error(t, err)
+}
+
+func TestParseToolFRU(t *testing.T) {
+	output := `FRU Device Description : Builtin FRU Device (ID 0)
+ Chassis Type          : Rack Mount Chassis
+ Chassis Part Number   : CPN-1
+ Chassis Serial        : CSN-1
+ Board Mfg Date        : Fri Sep 21 06:09:00 2018 UTC
+ Board Mfg             : Dell Inc.
+ Board Product         : PowerEdge R640
+ Board Serial          : BSN-1
+ Board Part Number     : BPN-1
+ Product Manufacturer  : Dell Inc.
+ Product Name          : PowerEdge R640
+ Product Version       : 01
+ Product Serial        : PSN-1
+ Product Asset Tag     : asset
+`
+
+	fru, err := parseToolFRU(output)
+	assert.NoError(t, err)
+	assert.Equal(t, ChassisType(0x17), fru.ChassisType)
+	assert.Equal(t, "CPN-1", fru.ChassisPartNumber)
+	assert.Equal(t, time.Date(2018, time.September, 21, 6, 9, 0, 0, time.UTC), fru.BoardMfgDate)
+	assert.Equal(t, "Dell Inc.", fru.BoardManufacturer)
+	assert.Equal(t, "PowerEdge R640", fru.ProductName)
+	assert.Equal(t, "asset", fru.ProductAssetTag)
+
+	_, err = parseToolFRU("")
+	assert.Error(t, err)
+}
+
+func TestRawDecode(t *testing.T) {
+	data, err := rawDecode(" 00 01 02 03 04 05 06 07 08 09 0a 0b 0c 0d 0e 0f\n 10 11\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 18, len(data))
+	assert.Equal(t, uint8(0x11), data[17])
+
+	for _, s := range []string{"0", "zz", "000"} {
+		_, err = rawDecode(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func FuzzToolOutput(f *testing.F) {
+	f.Add("SEL Record ID : 0001\n Timestamp : 05/14/2020 08:00:00\n Event Data : 570000\n")
+	f.Add("CPU Temp | 45.000 | degrees C | ok | na\nPS | 0x1 | discrete | 0x0100\n")
+	f.Add(" Chassis Type : Rack Mount Chassis\n Board Mfg Date : Fri Sep 21 06:09:00 2018 UTC\n")
+	f.Add(" 00 01 02\n 03\n")
+
+	f.Fuzz(func(t *testing.T, output string) {
+		_, _ = parseToolSEL(output)
+		_, _ = parseToolSensors(output)
+		_, _ = parseToolFRU(output)
+		_, _ = rawDecode(output)
+		_ = toolError(exec.Command("ipmitool"), output, errors.New("exit status 1"))
+	})
+}
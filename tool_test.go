@@ -17,8 +17,11 @@ limitations under the License.
 package ipmi
 
 import (
+	"errors"
 	"net"
+	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -39,7 +42,7 @@ func TestOptions(t *testing.T) {
 				Password:  "p",
 				Interface: "",
 			},
-			[]string{"-H", "h", "-U", "u", "-P", "p", "-I", "lanplus"},
+			[]string{"-H", "h", "-U", "u", "-E", "-I", "lanplus"},
 		},
 		{
 			"should append port",
@@ -51,7 +54,7 @@ func TestOptions(t *testing.T) {
 				Password:  "p",
 				Interface: "",
 			},
-			[]string{"-H", "h", "-U", "u", "-P", "p", "-I", "lanplus", "-p", "1623"},
+			[]string{"-H", "h", "-U", "u", "-E", "-I", "lanplus", "-p", "1623"},
 		},
 		{
 			"should override default interface",
@@ -63,7 +66,45 @@ func TestOptions(t *testing.T) {
 				Password:  "p",
 				Interface: "lan",
 			},
-			[]string{"-H", "h", "-U", "u", "-P", "p", "-I", "lan"},
+			[]string{"-H", "h", "-U", "u", "-E", "-I", "lan"},
+		},
+		{
+			"should read the password from a file",
+			&Connection{
+				Hostname:     "h",
+				Username:     "u",
+				Password:     "p",
+				PasswordFile: "/etc/bmc/password",
+				Interface:    "lanplus",
+			},
+			[]string{"-H", "h", "-U", "u", "-f", "/etc/bmc/password", "-I", "lanplus"},
+		},
+		{
+			"should append session options",
+			&Connection{
+				Hostname:    "h",
+				Username:    "u",
+				Password:    "p",
+				Interface:   "lanplus",
+				CipherSuite: 17,
+				Privilege:   PrivLevelOperator,
+				BMCKey:      "kg",
+				Retries:     2,
+				Timeout:     1500 * time.Millisecond,
+			},
+			[]string{"-H", "h", "-U", "u", "-E", "-I", "lanplus",
+				"-C", "17", "-L", "OPERATOR", "-y", "6b67", "-R", "2", "-N", "2"},
+		},
+		{
+			"should append bridging options",
+			&Connection{
+				Hostname:      "h",
+				Username:      "u",
+				Interface:     "lan",
+				TargetAddress: 0x82,
+				TargetChannel: 7,
+			},
+			[]string{"-H", "h", "-U", "u", "-E", "-I", "lan", "-t", "0x82", "-b", "7"},
 		},
 	}
 
@@ -73,12 +114,66 @@ func TestOptions(t *testing.T) {
 	}
 }
 
+func TestToolPassword(t *testing.T) {
+	c := &Connection{Hostname: "h", Username: "u", Password: "secret"}
+	cmd := newToolTransport(c).(*tool).cmd("raw", "0x06", "0x01")
+	assert.NotContains(t, cmd.Args, "secret")
+	assert.Contains(t, cmd.Env, "IPMI_PASSWORD=secret")
+
+	c.PasswordFile = "/etc/bmc/password"
+	cmd = newToolTransport(c).(*tool).cmd("raw", "0x06", "0x01")
+	assert.NotContains(t, cmd.Args, "secret")
+	assert.Nil(t, cmd.Env)
+}
+
+func TestToolError(t *testing.T) {
+	tests := []struct {
+		stderr string
+		expect error
+	}{
+		{"Unable to send RAW command (channel=0x0 netfn=0x6 lun=0x0 cmd=0xff rsp=0xc1): Invalid command", ErrInvalidCommand},
+		{"Unable to send RAW command (channel=0x0 netfn=0x0 lun=0x0 cmd=0x2 rsp=0xd4): Insufficient privilege level", ErrPrivLevel},
+		{"Error: Unable to establish IPMI v2 / RMCP+ session", ErrUnreachable},
+		{"RAKP 2 message indicates an error : unauthorized name\nError: Unable to establish IPMI v2 / RMCP+ session", ErrAuthFailed},
+		{"RAKP 2 HMAC is invalid\nError: Unable to establish IPMI v2 / RMCP+ session", ErrAuthFailed},
+		{"Activate Session error:\n\tInvalid user name\nError: Unable to establish LAN session", ErrAuthFailed},
+		{"Authentication type NONE not supported\nError: Unable to establish LAN session", ErrAuthFailed},
+		{"RAKP 4 message has invalid integrity check\nError: Unable to establish IPMI v2 / RMCP+ session", ErrAuthFailed},
+		{"No response from remote controller", ErrTimeout},
+		{"Address lookup for bmc01 failed", ErrUnreachable},
+	}
+
+	cmd := exec.Command("ipmitool", "raw")
+	exitErr := errors.New("exit status 1")
+
+	for _, test := range tests {
+		err := toolError(cmd, test.stderr, exitErr)
+		if cc, ok := test.expect.(CompletionCode); ok {
+			assert.Equal(t, cc, err, test.stderr)
+			continue
+		}
+		assert.IsType(t, &ToolError{}, err, test.stderr)
+		assert.True(t, errors.Is(err, test.expect), test.stderr)
+		assert.Equal(t, test.expect == ErrTimeout, err.(*ToolError).Timeout(), test.stderr)
+	}
+
+	err := toolError(cmd, "something else", exitErr)
+	assert.Equal(t, exitErr, errors.Unwrap(err))
+
+	// local configuration errors are not authentication failures
+	stderr := "Unable to read password from file /etc/bmc.pass"
+	err = toolError(cmd, stderr, exitErr)
+	assert.Equal(t, exitErr, errors.Unwrap(err))
+	assert.Equal(t, stderr, err.(*ToolError).Stderr)
+}
+
 func TestTool(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping tool tests")
 	}
 
 	s := NewSimulator(net.UDPAddr{Port: 0})
+	s.SetPassword("vmware", "cow")
 	err := s.Run()
 	assert.NoError(t, err)
 
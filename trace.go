@@ -0,0 +1,267 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Tracer receives the RMCP datagrams sent and received by a Client
+type Tracer interface {
+	Trace(*TraceEvent)
+}
+
+// TraceEvent is a single datagram, raw and decoded
+type TraceEvent struct {
+	Time time.Time
+	// Inbound is true for datagrams received from the BMC
+	Inbound bool
+	Local   net.Addr
+	Remote  net.Addr
+	// Data is the raw RMCP datagram
+	Data []byte
+	// Class is the RMCP message class, ASF or IPMI
+	Class uint8
+	// Message is the decoded IPMI message, nil for ASF messages
+	Message *Message
+	// Err is set if the datagram could not be decoded
+	Err error
+}
+
+func newTraceEvent(inbound bool, local, remote net.Addr, buf []byte) *TraceEvent {
+	e := &TraceEvent{
+		Time:    time.Now(),
+		Inbound: inbound,
+		Local:   local,
+		Remote:  remote,
+		Data:    append([]byte(nil), buf...),
+	}
+
+	h, err := rmcpHeaderFromBytes(buf)
+	if err != nil {
+		e.Err = err
+		return e
+	}
+	e.Class = h.Class
+
+	switch h.Class {
+	case rmcpClassASF:
+		_, e.Err = asfMessageFromBytes(buf)
+	case rmcpClassIPMI:
+		e.Message, e.Err = messageFromBytes(buf)
+	default:
+		e.Err = h.unsupportedClass()
+	}
+
+	return e
+}
+
+// String summarizes the decoded datagram
+func (e *TraceEvent) String() string {
+	src, dst := e.Local, e.Remote
+	if e.Inbound {
+		src, dst = dst, src
+	}
+	s := fmt.Sprintf("%s %s > %s", e.Time.UTC().Format("15:04:05.000000"), src, dst)
+
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("%s invalid: %s", s, e.Err)
+	case e.Class == rmcpClassASF:
+		return fmt.Sprintf("%s ASF type=0x%02x", s, e.Data[rmcpHeaderSize+4])
+	default:
+		m := e.Message
+		return fmt.Sprintf("%s IPMI auth=%d session=0x%08x seq=%d netfn=0x%02x cmd=0x%02x rqseq=%d len=%d",
+			s, m.AuthType, m.SessionID, m.Sequence, uint8(m.NetFn()), uint8(m.Command), m.RqSeq>>2, len(m.Data))
+	}
+}
+
+func (l *lan) trace(inbound bool, buf []byte) {
+	if l.Tracer == nil || l.conn == nil {
+		return
+	}
+	l.Tracer.Trace(newTraceEvent(inbound, l.conn.LocalAddr(), l.conn.RemoteAddr(), buf))
+}
+
+// HexdumpTracer writes a summary and hex dump of each datagram
+type HexdumpTracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewHexdumpTracer returns a Tracer writing to w
+func NewHexdumpTracer(w io.Writer) *HexdumpTracer {
+	return &HexdumpTracer{w: w}
+}
+
+// Trace implements the Tracer interface
+func (t *HexdumpTracer) Trace(e *TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, _ = fmt.Fprintf(t.w, "%s\n%s\n", e, hex.Dump(e.Data))
+}
+
+// pcap file format constants
+const (
+	pcapMagic     = 0xa1b2c3d4
+	pcapSnapLen   = 65535
+	pcapLinkRaw   = 101 // LINKTYPE_RAW, IPv4 or IPv6 without a link layer
+	ipv4HeaderLen = 20
+	ipv6HeaderLen = 40
+	udpHeaderLen  = 8
+	ipProtoUDP    = 17
+)
+
+// PcapTracer writes datagrams to a pcap file, encapsulated in the UDP
+// and IP headers they were sent with, such that tools like wireshark
+// decode them as RMCP on port 623.
+type PcapTracer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewPcapTracer writes the pcap file header to w and returns a Tracer
+// writing records to w. Write errors are returned by Err.
+func NewPcapTracer(w io.Writer) (*PcapTracer, error) {
+	header := struct {
+		Magic        uint32
+		VersionMajor uint16
+		VersionMinor uint16
+		ThisZone     int32
+		SigFigs      uint32
+		SnapLen      uint32
+		Network      uint32
+	}{pcapMagic, 2, 4, 0, 0, pcapSnapLen, pcapLinkRaw}
+
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+
+	return &PcapTracer{w: w}, nil
+}
+
+// Err returns the first error writing a record
+func (t *PcapTracer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Trace implements the Tracer interface
+func (t *PcapTracer) Trace(e *TraceEvent) {
+	src, _ := e.Local.(*net.UDPAddr)
+	dst, _ := e.Remote.(*net.UDPAddr)
+	if src == nil || dst == nil {
+		return
+	}
+	if e.Inbound {
+		src, dst = dst, src
+	}
+
+	packet := ipPacket(src, dst, e.Data)
+	ts := e.Time.UnixNano() / int64(time.Microsecond)
+	record := []uint32{
+		uint32(ts / 1e6),
+		uint32(ts % 1e6),
+		uint32(len(packet)),
+		uint32(len(packet)),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return
+	}
+	if err := binary.Write(t.w, binary.LittleEndian, record); err != nil {
+		t.err = err
+		return
+	}
+	_, t.err = t.w.Write(packet)
+}
+
+// ipPacket encapsulates payload in UDP and IPv4 or IPv6 headers
+func ipPacket(src, dst *net.UDPAddr, payload []byte) []byte {
+	udp := make([]byte, udpHeaderLen, udpHeaderLen+len(payload))
+	binary.BigEndian.PutUint16(udp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderLen+len(payload)))
+	udp = append(udp, payload...)
+
+	src4, dst4 := src.IP.To4(), dst.IP.To4()
+	if src4 != nil && dst4 != nil {
+		// the UDP checksum is optional over IPv4
+		ip := make([]byte, ipv4HeaderLen, ipv4HeaderLen+len(udp))
+		ip[0] = 0x45 // version 4, 5 words
+		binary.BigEndian.PutUint16(ip[2:], uint16(ipv4HeaderLen+len(udp)))
+		ip[8] = 64 // TTL
+		ip[9] = ipProtoUDP
+		copy(ip[12:], src4)
+		copy(ip[16:], dst4)
+		binary.BigEndian.PutUint16(ip[10:], inetChecksum(0, ip))
+		return append(ip, udp...)
+	}
+
+	ip := make([]byte, ipv6HeaderLen, ipv6HeaderLen+len(udp))
+	ip[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(udp)))
+	ip[6] = ipProtoUDP
+	ip[7] = 64 // hop limit
+	copy(ip[8:], src.IP.To16())
+	copy(ip[24:], dst.IP.To16())
+
+	// the UDP checksum is mandatory over IPv6, computed with the pseudo header
+	pseudo := make([]byte, 40)
+	copy(pseudo, ip[8:40])
+	binary.BigEndian.PutUint32(pseudo[32:], uint32(len(udp)))
+	pseudo[39] = ipProtoUDP
+	sum := inetChecksum(inetSum(0, pseudo), udp)
+	if sum == 0 {
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:], sum)
+
+	return append(ip, udp...)
+}
+
+// inetSum adds buf to the one's complement sum per RFC 1071
+func inetSum(sum uint32, buf []byte) uint32 {
+	for i := 0; i+1 < len(buf); i += 2 {
+		sum += uint32(buf[i])<<8 | uint32(buf[i+1])
+	}
+	if len(buf)%2 == 1 {
+		sum += uint32(buf[len(buf)-1]) << 8
+	}
+	return sum
+}
+
+// inetChecksum completes the RFC 1071 checksum of buf
+func inetChecksum(sum uint32, buf []byte) uint16 {
+	sum = inetSum(sum, buf)
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
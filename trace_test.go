@@ -0,0 +1,144 @@
+/*
+Copyright (c) 2014 VMware, Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipmi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testTracer struct {
+	mu     sync.Mutex
+	events []*TraceEvent
+}
+
+func (t *testTracer) Trace(e *TraceEvent) {
+	t.mu.Lock()
+	t.events = append(t.events, e)
+	t.mu.Unlock()
+}
+
+func TestTracer(t *testing.T) {
+	s := NewSimulator(net.UDPAddr{})
+	err := s.Run()
+	assert.NoError(t, err)
+
+	tracer := &testTracer{}
+	var dump bytes.Buffer
+	hexdump := NewHexdumpTracer(&dump)
+
+	c := s.NewConnection()
+	c.Tracer = tracer
+	client, err := NewClient(c)
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	c.Tracer = hexdump
+	_, err = client.DeviceID()
+	assert.NoError(t, err)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+
+	// ping, pong, then requests and responses
+	assert.True(t, len(tracer.events) >= 4)
+	ping, pong := tracer.events[0], tracer.events[1]
+	assert.False(t, ping.Inbound)
+	assert.True(t, pong.Inbound)
+	assert.Equal(t, uint8(rmcpClassASF), ping.Class)
+	assert.Nil(t, ping.Message)
+	assert.NoError(t, ping.Err)
+	assert.Contains(t, ping.String(), "ASF type=0x80")
+	assert.Contains(t, pong.String(), "ASF type=0x40")
+
+	req, res := tracer.events[2], tracer.events[3]
+	assert.Equal(t, uint8(rmcpClassIPMI), req.Class)
+	assert.Equal(t, CommandGetAuthCapabilities, req.Message.Command)
+	assert.Equal(t, CommandGetAuthCapabilities, res.Message.Command)
+	assert.True(t, res.Inbound)
+	assert.Equal(t, c.Port, req.Remote.(*net.UDPAddr).Port)
+
+	out := dump.String()
+	assert.Equal(t, 2, strings.Count(out, "cmd=0x01 "), out)
+	assert.Contains(t, out, "00000000  06 00 ff 07")
+
+	e := newTraceEvent(true, nil, nil, []byte{0x06, 0x00, 0xff})
+	assert.Equal(t, ErrShortPacket, e.Err)
+	assert.Contains(t, e.String(), "invalid")
+}
+
+func TestPcapTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer, err := NewPcapTracer(&buf)
+	assert.NoError(t, err)
+
+	local := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 50000}
+	remote := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 623}
+	payload := []byte{0x06, 0x00, 0xff, 0x06, 0x00, 0x00, 0x11, 0xbe, 0x80, 0x00, 0x00, 0x00}
+	tracer.Trace(newTraceEvent(false, local, remote, payload))
+	tracer.Trace(newTraceEvent(true, local, remote, payload))
+
+	local6 := &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 50000}
+	remote6 := &net.UDPAddr{IP: net.ParseIP("fe80::2"), Port: 623}
+	tracer.Trace(newTraceEvent(false, local6, remote6, payload))
+	assert.NoError(t, tracer.Err())
+
+	data := buf.Bytes()
+	assert.Equal(t, uint32(pcapMagic), binary.LittleEndian.Uint32(data))
+	assert.Equal(t, uint32(pcapLinkRaw), binary.LittleEndian.Uint32(data[20:]))
+	data = data[24:]
+
+	packet := func() []byte {
+		n := binary.LittleEndian.Uint32(data[8:])
+		p := data[16 : 16+n]
+		data = data[16+n:]
+		return p
+	}
+
+	p := packet()
+	assert.Equal(t, ipv4HeaderLen+udpHeaderLen+len(payload), len(p))
+	assert.Equal(t, uint8(0x45), p[0])
+	assert.Equal(t, uint16(0), inetChecksum(0, p[:ipv4HeaderLen]))
+	assert.Equal(t, []byte{10, 0, 0, 1, 10, 0, 0, 2}, p[12:20])
+	assert.Equal(t, uint16(50000), binary.BigEndian.Uint16(p[20:]))
+	assert.Equal(t, uint16(623), binary.BigEndian.Uint16(p[22:]))
+	assert.Equal(t, payload, p[28:])
+
+	p = packet()
+	assert.Equal(t, []byte{10, 0, 0, 2, 10, 0, 0, 1}, p[12:20])
+	assert.Equal(t, uint16(623), binary.BigEndian.Uint16(p[20:]))
+
+	p = packet()
+	assert.Equal(t, ipv6HeaderLen+udpHeaderLen+len(payload), len(p))
+	assert.Equal(t, uint8(0x60), p[0])
+	assert.Equal(t, uint16(623), binary.BigEndian.Uint16(p[42:]))
+	// the checksum of the pseudo header and UDP datagram including its checksum is 0
+	pseudo := make([]byte, 40)
+	copy(pseudo, p[8:40])
+	binary.BigEndian.PutUint32(pseudo[32:], uint32(len(p)-ipv6HeaderLen))
+	pseudo[39] = ipProtoUDP
+	assert.Equal(t, uint16(0), inetChecksum(inetSum(0, pseudo), p[ipv6HeaderLen:]))
+	assert.Empty(t, data)
+}
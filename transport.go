@@ -26,6 +26,22 @@ type transport interface {
 	Console() error
 }
 
+// commander is implemented by transports that run high level operations
+// natively, rather than as the sequence of Requests the Client sends
+type commander interface {
+	selEntries() ([]*SELEntry, error)
+	sensors() ([]*SensorReading, error)
+	fru(id uint8) (*FRUInfo, error)
+}
+
+func nativeCommands(t transport) (commander, bool) {
+	if a, ok := t.(*auto); ok {
+		t = a.transport
+	}
+	c, ok := t.(commander)
+	return c, ok
+}
+
 func newTransport(c *Connection) (transport, error) {
 	switch c.Interface {
 	case "lan":
@@ -35,6 +51,10 @@ func newTransport(c *Connection) (transport, error) {
 		return newToolTransport(c), nil
 	case "lanplus":
 		return newToolTransport(c), nil
+	case "auto":
+		return newAutoTransport(c), nil
+	case "open":
+		return newOpenTransport(c), nil
 	default:
 		return nil, fmt.Errorf("unsupported interface: %s", c.Interface)
 	}
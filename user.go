@@ -16,8 +16,6 @@ limitations under the License.
 
 package ipmi
 
-import "strings"
-
 const MaxUsernameLen = 16
 
 // GetUserNameRequest per section 22.29
@@ -28,13 +26,13 @@ type GetUserNameRequest struct {
 // GetUserNameRequest per section 22.29
 type GetUserNameResponse struct {
 	CompletionCode
-	Username string
+	Username string `ipmi:"len=16"`
 }
 
 // SetUserNameRequest per section 22.29
 type SetUserNameRequest struct {
 	UserID   byte
-	Username string
+	Username string `ipmi:"len=16"`
 }
 
 // SetUserNameRequest per section 22.29
@@ -59,38 +57,6 @@ func (r *GetUserNameRequest) UnmarshalBinary(buf []byte) error {
 	return nil
 }
 
-func (r *GetUserNameResponse) MarshalBinary() ([]byte, error) {
-	buf := make([]byte, 1+MaxUsernameLen)
-	buf[0] = byte(r.CompletionCode)
-	copy(buf[1:], r.Username)
-	return buf, nil
-}
-
-func (r *GetUserNameResponse) UnmarshalBinary(buf []byte) error {
-	if len(buf) < 1+MaxUsernameLen {
-		return ErrShortPacket
-	}
-	r.CompletionCode = CompletionCode(buf[0])
-	r.Username = strings.Trim(string(buf[1:]), "\000")
-	return nil
-}
-
-func (r *SetUserNameRequest) MarshalBinary() ([]byte, error) {
-	buf := make([]byte, 1+MaxUsernameLen)
-	buf[0] = r.UserID
-	copy(buf[1:], r.Username)
-	return buf, nil
-}
-
-func (r *SetUserNameRequest) UnmarshalBinary(buf []byte) error {
-	if len(buf) > 1+MaxUsernameLen {
-		return ErrLongPacket
-	}
-	r.UserID = buf[0]
-	r.Username = string(buf[1:])
-	return nil
-}
-
 func (r *SetUserNameResponse) MarshalBinary() ([]byte, error) {
 	buf := make([]byte, 1)
 	buf[0] = byte(r.CompletionCode)
@@ -98,6 +64,9 @@ func (r *SetUserNameResponse) MarshalBinary() ([]byte, error) {
 }
 
 func (r *SetUserNameResponse) UnmarshalBinary(buf []byte) error {
+	if len(buf) == 0 {
+		return ErrShortPacket
+	}
 	if len(buf) > 1 {
 		return ErrLongPacket
 	}
@@ -15,3 +15,53 @@ limitations under the License.
 */
 
 package ipmi
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserNameUnmarshal(t *testing.T) {
+	err := (&SetUserNameResponse{}).UnmarshalBinary(nil)
+	assert.Equal(t, ErrShortPacket, err)
+
+	err = messageDataFromBytes(nil, &SetUserNameRequest{})
+	assert.Error(t, err)
+
+	res := &GetUserNameResponse{}
+	err = messageDataFromBytes(append([]byte{0x00}, "admin"...), res)
+	assert.Equal(t, ErrShortPacket, err)
+}
+
+func TestUserNameTooLong(t *testing.T) {
+	_, err := messageDataToBytes(&SetUserNameRequest{UserID: 2, Username: "seventeen-letters"})
+	assert.Equal(t, ErrLongPacket, err)
+
+	s := NewSimulator(net.UDPAddr{})
+	err = s.Run()
+	assert.NoError(t, err)
+
+	client, err := NewClient(s.NewConnection())
+	assert.NoError(t, err)
+	err = client.Open()
+	assert.NoError(t, err)
+
+	_, err = client.SetUserName(2, "seventeen-letters")
+	assert.Equal(t, ErrLongPacket, err)
+
+	_, err = client.SetUserName(2, "sixteen-letters!")
+	assert.NoError(t, err)
+
+	// the simulator replaces responses it cannot encode
+	s.SetHandler(NetworkFunctionApp, CommandGetUserName, func(*Message) Response {
+		return &GetUserNameResponse{CompletionCode: CommandCompleted, Username: "seventeen-letters"}
+	})
+	_, err = client.GetUserName(2)
+	assert.Equal(t, ErrUnspecified, err)
+
+	err = client.Close()
+	assert.NoError(t, err)
+	s.Stop()
+}